@@ -7,6 +7,7 @@ toolchain go1.24.1
 require (
 	github.com/mark3labs/mcp-go v0.32.0
 	github.com/urfave/cli/v2 v2.27.1
+	golang.org/x/sys v0.15.0
 )
 
 require (
@@ -17,7 +18,6 @@ require (
 	github.com/rivo/uniseg v0.4.7-0.20240127222946-601bbb3750c2 // indirect
 	github.com/spf13/cast v1.7.1 // indirect
 	github.com/yosida95/uritemplate/v3 v3.0.2 // indirect
-	golang.org/x/sys v0.15.0 // indirect
 	golang.org/x/term v0.15.0 // indirect
 	golang.org/x/text v0.14.0 // indirect
 )
@@ -1,14 +1,28 @@
 package main
 
 import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"debug/buildinfo"
 	"encoding/json"
 	"fmt"
+	"net"
 	"os"
+	"os/signal"
+	"regexp"
+	"slices"
+	"strconv"
 	"strings"
+	"syscall"
+	"text/tabwriter"
+	"time"
 
 	"github.com/urfave/cli/v2"
 
 	"github.com/monsterxx03/gospy/pkg/api"
+	bin "github.com/monsterxx03/gospy/pkg/binary"
+	"github.com/monsterxx03/gospy/pkg/pprof"
 	"github.com/monsterxx03/gospy/pkg/proc"
 	"github.com/monsterxx03/gospy/pkg/termui"
 )
@@ -24,77 +38,133 @@ func main() {
 				Usage:   "Show dead goroutines in output",
 				Value:   false,
 			},
+			&cli.StringSliceFlag{
+				Name:  "debug-dir",
+				Usage: "Extra directory to search for separate debug info of stripped binaries (default /usr/lib/debug)",
+			},
+		},
+		Before: func(c *cli.Context) error {
+			bin.AddDebugDirs(c.StringSlice("debug-dir")...)
+			return nil
 		},
 		Commands: []*cli.Command{
 			{
 				Name:    "summary",
 				Aliases: []string{"s"},
 				Usage:   "Get process summary information",
-				Flags: []cli.Flag{
-					&cli.IntFlag{
-						Name:     "pid",
-						Aliases:  []string{"p"},
-						Usage:    "Target process ID",
-						Required: true,
+				Flags: slices.Concat([]cli.Flag{
+					&cli.IntSliceFlag{
+						Name:    "pid",
+						Aliases: []string{"p"},
+						Usage:   "Target process ID, several (--pid 1,2,3) produce a merged report",
 					},
+					containerFlag,
 					&cli.StringFlag{
-						Name:    "bin",
-						Aliases: []string{"b"},
-						Usage:   "Path to binary file (optional)",
+						Name:  "name",
+						Usage: "Target Go processes with this executable name instead of --pid, several produce a merged report",
+					},
+					&cli.StringFlag{
+						Name:  "match",
+						Usage: "Target Go processes whose command line matches this regexp instead of --pid, several produce a merged report",
+					},
+					&cli.BoolFlag{
+						Name:  "check-consistency",
+						Usage: "Read goroutines twice and report whether the reads were torn",
+					},
+					&cli.BoolFlag{
+						Name:  "env",
+						Usage: "Show the values of environment variables, only their names are shown by default",
 					},
 					&cli.BoolFlag{
 						Name:    "json",
 						Aliases: []string{"j"},
 						Usage:   "Output in JSON format",
 					},
-				},
+				}, offlineFlags, binaryFlags, freezeFlags, remoteFlags),
 				Action: func(c *cli.Context) error {
-					if os.Geteuid() != 0 {
-						return fmt.Errorf("must be run as root")
+					pids, err := summaryPids(c)
+					if err != nil {
+						return err
+					}
+					if len(pids) > 1 {
+						if c.String("remote") != "" {
+							return fmt.Errorf("--remote takes a single --pid")
+						}
+						return aggregateSummary(c, pids)
 					}
-					pid := c.Int("pid")
-					binPath := c.String("bin")
 
 					// Create memory reader
-					memReader, err := proc.NewProcessMemReader(pid, binPath)
+					memReader, err := openMemReader(c)
 					if err != nil {
 						return fmt.Errorf("failed to create memory reader: %w", err)
 					}
 					defer memReader.Close()
+					pid := memReader.Pid()
 
-					// Get Go version
-					// Get runtime info
-					rt, err := memReader.RuntimeInfo()
-					if err != nil {
-						return fmt.Errorf("failed to get runtime info: %w (is this a Go program?)", err)
-					}
+					var (
+						rt          *proc.Runtime
+						ps          []proc.P
+						goroutines  []proc.G
+						modules     []proc.LoadedModule
+						consistency *proc.ConsistencyReport
+					)
+					err = memReader.Frozen(func() error {
+						// Get runtime info
+						rt, err = memReader.RuntimeInfo()
+						if err != nil {
+							return fmt.Errorf("failed to get runtime info: %w (is this a Go program?)", err)
+						}
 
-					// Get processor info
-					ps, err := memReader.Ps()
+						// Get processor info
+						ps, err = memReader.Ps()
+						if err != nil {
+							return fmt.Errorf("failed to get processor info: %w", err)
+						}
+
+						// Get goroutines
+						goroutines, err = memReader.Goroutines(c.Bool("show-dead"))
+						if err != nil {
+							return fmt.Errorf("failed to get goroutines: %w", err)
+						}
+						// best effort, only the executable is listed without moduledata DWARF
+						modules, _ = memReader.Modules()
+
+						if c.Bool("check-consistency") {
+							consistency, err = proc.CheckConsistency(memReader)
+							if err != nil {
+								return fmt.Errorf("failed to check consistency: %w", err)
+							}
+						}
+						return nil
+					})
 					if err != nil {
-						return fmt.Errorf("failed to get processor info: %w", err)
+						return err
 					}
 
-					// Get goroutines
-					goroutines, err := memReader.Goroutines(c.Bool("show-dead"))
-					if err != nil {
-						return fmt.Errorf("failed to get goroutines: %w", err)
+					if !c.Bool("env") {
+						rt.RedactEnv()
 					}
 
 					// Output format
 					jsonOutput := c.Bool("json")
 					if jsonOutput {
 						type Summary struct {
-							PID        int      `json:"pid"`
-							GoVersion  string   `json:"go_version"`
-							Processors []proc.P `json:"processors"`
-							Goroutines []proc.G `json:"goroutines"`
+							PID         int                     `json:"pid"`
+							GoVersion   string                  `json:"go_version"`
+							Runtime     *proc.Runtime           `json:"runtime"`
+							Processors  []proc.P                `json:"processors"`
+							Goroutines  []proc.G                `json:"goroutines"`
+							Modules     []proc.LoadedModule     `json:"modules"`
+							Consistency *proc.ConsistencyReport `json:"consistency,omitempty"`
 						}
 						summary := Summary{
-							PID:        pid,
-							GoVersion:  rt.GoVersion,
-							Processors: ps,
-							Goroutines: goroutines,
+							PID:         pid,
+							GoVersion:   rt.GoVersion,
+							Runtime:     rt,
+							Processors:  ps,
+							Goroutines:  goroutines,
+							Modules:     modules,
+							Consistency: consistency,
 						}
 						enc := json.NewEncoder(os.Stdout)
 						enc.SetIndent("", "  ")
@@ -107,6 +177,45 @@ func main() {
 					if !strings.HasPrefix(rt.GoVersion, "go") {
 						fmt.Printf("  Warning: Unexpected version format: %q\n", rt.GoVersion)
 					}
+					for _, w := range rt.Warnings {
+						fmt.Printf("  Warning: %s\n", w)
+					}
+					if bi := rt.BuildInfo; bi != nil {
+						fmt.Printf("  Main Module: %s %s\n", bi.Main.Path, bi.Main.Version)
+						if rev := bi.Setting("vcs.revision"); rev != "" {
+							fmt.Printf("  VCS Revision: %s (modified=%s)\n", rev, bi.Setting("vcs.modified"))
+						}
+					}
+					fmt.Printf("  GOMAXPROCS: %d (ncpu=%d)\n", rt.GOMAXPROCS, rt.NumCPU)
+					if len(modules) > 1 {
+						// shared libraries and plugins, modules[0] is the executable
+						fmt.Printf("  Modules:\n")
+						for _, m := range modules[1:] {
+							fmt.Printf("    %s [0x%x-0x%x]\n", m.Path, m.MinPC, m.MaxPC)
+						}
+					}
+					if consistency != nil {
+						fmt.Printf("  Consistency: %s\n", consistency)
+					}
+					fmt.Printf("  Args: %s\n", strings.Join(rt.Args, " "))
+					if rt.GODEBUG != "" {
+						fmt.Printf("  GODEBUG: %s\n", rt.GODEBUG)
+					}
+					// the defaults of debug vars are set in code, only GODEBUG tells which were changed
+					var set []string
+					for _, v := range rt.DebugVars {
+						if _, ok := rt.GODEBUGSettings[v.Name]; ok {
+							set = append(set, fmt.Sprintf("%s=%d", v.Name, v.Value))
+						}
+					}
+					if len(set) > 0 {
+						fmt.Printf("  Runtime Debug Vars (set by GODEBUG): %s\n", strings.Join(set, ","))
+					}
+
+					fmt.Printf("\nEnvironment (%d):\n", len(rt.Env))
+					for _, kv := range rt.Env {
+						fmt.Printf("  %s\n", kv)
+					}
 
 					// Print processor summary
 					fmt.Printf("\nProcessors (%d):\n", len(ps))
@@ -146,7 +255,7 @@ func main() {
 				Name:    "serve",
 				Aliases: []string{"api"},
 				Usage:   "Start API server to expose process information",
-				Flags: []cli.Flag{
+				Flags: append([]cli.Flag{
 					&cli.IntFlag{
 						Name:    "port",
 						Aliases: []string{"p"},
@@ -158,36 +267,169 @@ func main() {
 						Usage: "Enable MCP protocol support",
 						Value: false,
 					},
-				},
+					&cli.StringSliceFlag{
+						Name:  "core",
+						Usage: "Serve an ELF core file (repeatable), queried with its pid and source=core:<path>",
+					},
+					&cli.StringSliceFlag{
+						Name:  "snapshot",
+						Usage: "Serve a snapshot file (repeatable), queried with its pid and source=snapshot:<path>",
+					},
+					&cli.IntFlag{
+						Name:  "max-start-funcs",
+						Usage: "Export at most this many start functions per process in /metrics, the rest are summed as \"other\" (0 for no limit)",
+						Value: api.DefaultMetricsLimits.StartFuncs,
+					},
+					&cli.IntFlag{
+						Name:  "max-wait-reasons",
+						Usage: "Export at most this many wait reasons per process in /metrics (0 for no limit)",
+						Value: api.DefaultMetricsLimits.WaitReasons,
+					},
+				}, apiServerFlags...),
 				Action: func(c *cli.Context) error {
-					if os.Geteuid() != 0 {
+					cores := c.StringSlice("core")
+					snapshots := c.StringSlice("snapshot")
+					if len(cores) == 0 && len(snapshots) == 0 && os.Geteuid() != 0 {
 						return fmt.Errorf("must be run as root")
 					}
 					port := c.Int("port")
 					enableMCP := c.Bool("enable-mcp")
 					apiServer := api.NewServer(port, c.Bool("show-dead"), enableMCP)
-					fmt.Printf("Starting API server on port %d\n", port)
+					apiServer.SetMetricsLimits(metricsLimits(c))
+					for _, corePath := range cores {
+						memReader, err := proc.NewCoreMemReader(corePath, "")
+						if err != nil {
+							return fmt.Errorf("failed to open core %s: %w", corePath, err)
+						}
+						source := "core:" + corePath
+						apiServer.AddReader(source, memReader)
+						fmt.Printf("Serving core %s as pid %d, query with ?pid=%d&source=%s\n", corePath, memReader.Pid(), memReader.Pid(), source)
+					}
+					for _, snapshotPath := range snapshots {
+						memReader, err := proc.NewSnapshotMemReader(snapshotPath, "")
+						if err != nil {
+							return fmt.Errorf("failed to open snapshot %s: %w", snapshotPath, err)
+						}
+						source := "snapshot:" + snapshotPath
+						apiServer.AddReader(source, memReader)
+						fmt.Printf("Serving snapshot %s as pid %d, query with ?pid=%d&source=%s\n", snapshotPath, memReader.Pid(), memReader.Pid(), source)
+					}
+					l, err := apiListener(c, apiServer)
+					if err != nil {
+						return err
+					}
 					fmt.Printf("Endpoints:\n")
 					fmt.Printf("  GET /runtime?pid=<PID>     - Get runtime info\n")
-					fmt.Printf("  GET /goroutines?pid=<PID> - Get goroutines list\n")
+					fmt.Printf("  GET /goroutines?pid=<PID> - Get goroutines list, filtered and paginated\n")
+					fmt.Printf("  GET /goroutines/{goid}?pid=<PID>           - One goroutine with its stack\n")
+					fmt.Printf("  GET /stack?pid=<PID>&goid=<GOID>           - Stack of one goroutine\n")
+					fmt.Printf("  GET /dump?pid=<PID>&format=json|text       - All goroutines with stacks\n")
+					fmt.Printf("  GET /groups?pid=<PID>&by=start_func        - Goroutine counts by start_func, wait_reason, status or creator\n")
+					fmt.Printf("  GET /processors?pid=<PID>                  - Processor (P) info\n")
+					fmt.Printf("  GET /threads?pid=<PID>                     - Goroutine running on each thread (M)\n")
+					fmt.Printf("  GET /ps                                    - Go processes on the host\n")
 					fmt.Printf("  GET /memstats?pid=<PID>   - Get memory stats\n")
+					fmt.Printf("  GET /aggregate?pid=<PID>,<PID>|name=<NAME> - Merged report of several processes\n")
+					fmt.Printf("  GET /aggregate/dump?pid=<PID>,<PID>&format=json|text - Goroutines of several processes merged by stack\n")
+					fmt.Printf("  GET /metrics?pid=<PID>,<PID>|name=<NAME>   - Prometheus metrics\n")
+					fmt.Printf("  GET /debug/pprof/goroutine?pid=<PID>       - Goroutine profile for go tool pprof\n")
+					fmt.Printf("  GET /stream?pid=<PID>&interval=1s          - Periodic snapshots and deltas (SSE or WebSocket)\n")
+					fmt.Printf("  GET /openapi.json                          - OpenAPI 3 description of the endpoints\n")
 					if enableMCP {
 						fmt.Printf("  GET /mcp   - MCP http endpoint\n")
 					}
-					return apiServer.Start()
+					return apiServer.Serve(l)
+				},
+			},
+			{
+				Name:  "agent",
+				Usage: "Serve raw memory and binaries of allowed processes to gospy on other hosts (--remote)",
+				Flags: append(append([]cli.Flag{
+					&cli.StringFlag{
+						Name:     "listen",
+						Usage:    "unix:/path/to/socket, or host:port for TCP with mutual TLS",
+						Required: true,
+					},
+				}, allowFlags...), listenerFlags...),
+				Action: func(c *cli.Context) error {
+					allow := allowlist(c)
+					if allow.Empty() {
+						return fmt.Errorf("at least one --allow-pid, --allow-exe or --allow-cgroup is required")
+					}
+					if err := allow.Validate(); err != nil {
+						return err
+					}
+					addr := c.String("listen")
+					if !strings.HasPrefix(addr, "unix:") && (c.String("cert") == "" || c.String("client-ca") == "") {
+						return fmt.Errorf("a TCP agent requires --cert, --key and --client-ca")
+					}
+					l, err := listen(c, addr)
+					if err != nil {
+						return err
+					}
+					defer l.Close()
+					fmt.Printf("Agent listening on %s\n", addr)
+					return proc.ServeAgent(l, allow)
+				},
+			},
+			{
+				Name:  "exporter",
+				Usage: "Serve Prometheus metrics of Go processes that aren't instrumented themselves",
+				Flags: append([]cli.Flag{
+					&cli.IntSliceFlag{
+						Name:    "pid",
+						Aliases: []string{"p"},
+						Usage:   "Target process IDs (--pid 1,2,3)",
+					},
+					&cli.StringFlag{
+						Name:  "name",
+						Usage: "Export every Go process with this executable name, re-resolved on each scrape",
+					},
+					&cli.StringFlag{
+						Name:  "match",
+						Usage: "Export every Go process whose command line matches this regexp, re-resolved on each scrape",
+					},
+					&cli.IntFlag{
+						Name:  "port",
+						Usage: "Port to listen on",
+						Value: 9974,
+					},
+					&cli.IntFlag{
+						Name:  "max-start-funcs",
+						Usage: "Export at most this many start functions per process, the rest are summed as \"other\" (0 for no limit)",
+						Value: api.DefaultMetricsLimits.StartFuncs,
+					},
+					&cli.IntFlag{
+						Name:  "max-wait-reasons",
+						Usage: "Export at most this many wait reasons per process (0 for no limit)",
+						Value: api.DefaultMetricsLimits.WaitReasons,
+					},
+				}, apiServerFlags...),
+				Action: func(c *cli.Context) error {
+					if os.Geteuid() != 0 {
+						return fmt.Errorf("must be run as root")
+					}
+					resolve, err := exporterTargets(c)
+					if err != nil {
+						return err
+					}
+					port := c.Int("port")
+					apiServer := api.NewServer(port, c.Bool("show-dead"), false)
+					apiServer.SetMetricsLimits(metricsLimits(c))
+					apiServer.SetMetricsTargets(resolve)
+					l, err := apiListener(c, apiServer)
+					if err != nil {
+						return err
+					}
+					fmt.Printf("Serving metrics on /metrics\n")
+					return apiServer.Serve(l)
 				},
 			},
 			{
 				Name:    "top",
 				Aliases: []string{"t"},
 				Usage:   "Monitor goroutines in a top-like interface",
-				Flags: []cli.Flag{
-					&cli.IntFlag{
-						Name:     "pid",
-						Aliases:  []string{"p"},
-						Usage:    "Target process ID",
-						Required: true,
-					},
+				Flags: slices.Concat(processFlags, offlineFlags, []cli.Flag{
 					&cli.IntFlag{
 						Name:    "interval",
 						Aliases: []string{"i"},
@@ -199,23 +441,20 @@ func main() {
 						Usage: "Enable debug mode (wait for dlv attach)",
 						Value: false,
 					},
-				},
+				}, binaryFlags, freezeFlags, remoteFlags),
 				Action: func(c *cli.Context) error {
-					if os.Geteuid() != 0 {
-						return fmt.Errorf("must be run as root")
-					}
-					pid := c.Int("pid")
 					interval := c.Int("interval")
 					if interval <= 0 {
 						interval = 2
 					}
 
 					// Create memory reader
-					memReader, err := proc.NewProcessMemReader(pid, "")
+					memReader, err := openMemReader(c)
 					if err != nil {
 						return fmt.Errorf("failed to create memory reader: %w", err)
 					}
 					defer memReader.Close()
+					pid := memReader.Pid()
 
 					// Wait for debugger if debug flag is set
 					if c.Bool("debug") {
@@ -236,13 +475,7 @@ func main() {
 				Name:    "stack",
 				Aliases: []string{"st"},
 				Usage:   "Get stack trace for a specific goroutine(experimental)",
-				Flags: []cli.Flag{
-					&cli.IntFlag{
-						Name:     "pid",
-						Aliases:  []string{"p"},
-						Usage:    "Target process ID",
-						Required: true,
-					},
+				Flags: slices.Concat(processFlags, offlineFlags, []cli.Flag{
 					&cli.Int64Flag{
 						Name:     "goid",
 						Aliases:  []string{"g"},
@@ -250,32 +483,52 @@ func main() {
 						Required: true,
 					},
 					&cli.StringFlag{
-						Name:    "bin",
-						Aliases: []string{"b"},
-						Usage:   "Path to binary file (optional)",
+						Name:  "format",
+						Usage: "Output format: text or " + strings.Join(pprof.Formats, ", "),
+						Value: "text",
 					},
-				},
+					&cli.StringFlag{
+						Name:    "output",
+						Aliases: []string{"o"},
+						Usage:   "Profile file to write with a non-text --format (default goroutine-<goid>.<format extension>)",
+					},
+				}, binaryFlags, freezeFlags, remoteFlags),
 				Action: func(c *cli.Context) error {
-					if os.Geteuid() != 0 {
-						return fmt.Errorf("must be run as root")
-					}
-					pid := c.Int("pid")
 					goid := c.Int64("goid")
-					binPath := c.String("bin")
+					format := c.String("format")
+					var output string
+					if format != "text" {
+						var err error
+						if output, err = profileOutput(c, fmt.Sprintf("goroutine-%d", goid), format); err != nil {
+							return err
+						}
+					}
 
 					// Create memory reader
-					memReader, err := proc.NewProcessMemReader(pid, binPath)
+					memReader, err := openMemReader(c)
 					if err != nil {
 						return fmt.Errorf("failed to create memory reader: %w", err)
 					}
 					defer memReader.Close()
 
 					// Get stack trace
-					frames, err := memReader.GetGoroutineStackTraceByGoID(goid)
+					var frames []proc.StackFrame
+					err = memReader.Frozen(func() error {
+						frames, err = memReader.GetGoroutineStackTraceByGoID(goid)
+						return err
+					})
 					if err != nil {
 						return fmt.Errorf("failed to get stack trace for goroutine %d: %w", goid, err)
 					}
 
+					if format != "text" {
+						if err := writeProfile(pprof.StackProfile(memReader, goid, frames), output, format); err != nil {
+							return err
+						}
+						fmt.Printf("Wrote stack of goroutine %d (%d frames) to %s\n", goid, len(frames), output)
+						return nil
+					}
+
 					// Print stack trace
 					fmt.Printf("\nStack trace for goroutine %d:\n", goid)
 					for i, frame := range frames {
@@ -288,6 +541,372 @@ func main() {
 					return nil
 				},
 			},
+			{
+				Name:  "snapshot",
+				Usage: "Capture process state into a file for offline analysis",
+				Flags: slices.Concat(processFlags, []cli.Flag{
+					&cli.StringFlag{
+						Name:     "output",
+						Aliases:  []string{"o"},
+						Usage:    "Snapshot file to write, e.g. incident.gospy",
+						Required: true,
+					},
+					&cli.BoolFlag{
+						Name:  "no-binary",
+						Usage: "Don't embed the executable, it must then be passed with --bin when reading the snapshot",
+					},
+				}, binaryFlags, freezeFlags, remoteFlags),
+				Action: func(c *cli.Context) error {
+					memReader, err := openMemReader(c)
+					if err != nil {
+						return fmt.Errorf("failed to create memory reader: %w", err)
+					}
+					defer memReader.Close()
+
+					out, err := os.Create(c.String("output"))
+					if err != nil {
+						return fmt.Errorf("failed to create snapshot file: %w", err)
+					}
+					defer out.Close()
+
+					h, err := proc.CaptureSnapshot(memReader, out, !c.Bool("no-binary"))
+					if err != nil {
+						return fmt.Errorf("failed to capture snapshot: %w", err)
+					}
+					fmt.Printf("Captured %d regions (%d bytes) of pid %d (%s) into %s\n",
+						h.Regions, h.Bytes, h.PID, h.GoVersion, c.String("output"))
+					return nil
+				},
+			},
+			{
+				Name:  "pprof",
+				Usage: "Write a goroutine profile readable by go tool pprof, no net/http/pprof needed in the target",
+				Flags: slices.Concat(processFlags, offlineFlags, []cli.Flag{
+					&cli.StringFlag{
+						Name:  "format",
+						Usage: "Output format: " + strings.Join(pprof.Formats, ", "),
+						Value: pprof.FormatPprof,
+					},
+					&cli.StringFlag{
+						Name:    "output",
+						Aliases: []string{"o"},
+						Usage:   "Profile file to write (default goroutine.<format extension>)",
+					},
+				}, binaryFlags, freezeFlags, remoteFlags),
+				Action: func(c *cli.Context) error {
+					format := c.String("format")
+					output, err := profileOutput(c, "goroutine", format)
+					if err != nil {
+						return err
+					}
+
+					memReader, err := openMemReader(c)
+					if err != nil {
+						return fmt.Errorf("failed to create memory reader: %w", err)
+					}
+					defer memReader.Close()
+
+					profile, err := pprof.GoroutineProfile(memReader, c.Bool("show-dead"))
+					if err != nil {
+						return fmt.Errorf("failed to build goroutine profile: %w", err)
+					}
+					if err := writeProfile(profile, output, format); err != nil {
+						return err
+					}
+					fmt.Printf("Wrote goroutine profile of pid %d (%d unique stacks) to %s\n",
+						memReader.Pid(), len(profile.Samples), output)
+					return nil
+				},
+			},
+			{
+				Name:  "record",
+				Usage: "Sample the target and write a CPU or off-CPU (blocking) profile (Linux only)",
+				Flags: slices.Concat(processFlags, []cli.Flag{
+					&cli.DurationFlag{
+						Name:  "duration",
+						Usage: "How long to record, Ctrl-C stops early and still writes the profile",
+						Value: 10 * time.Second,
+					},
+					&cli.StringFlag{
+						Name:  "mode",
+						Usage: "What to sample: cpu (goroutines on CPU) or offcpu (blocked goroutines, weighted by time and grouped by wait reason)",
+						Value: "cpu",
+					},
+					&cli.StringFlag{
+						Name:  "rate",
+						Usage: "Samples per second (default 100hz for cpu, 10hz for offcpu which reads all goroutines per sample)",
+					},
+					&cli.StringFlag{
+						Name:  "format",
+						Usage: "Output format: " + strings.Join(pprof.Formats, ", "),
+						Value: pprof.FormatPprof,
+					},
+					&cli.StringFlag{
+						Name:    "output",
+						Aliases: []string{"o"},
+						Usage:   "Profile file to write (default <mode>.<format extension>)",
+					},
+				}, binaryFlags, remoteFlags),
+				Action: func(c *cli.Context) error {
+					mode := pprof.Mode(c.String("mode"))
+					rateFlag := c.String("rate")
+					switch mode {
+					case pprof.ModeCPU:
+						if rateFlag == "" {
+							rateFlag = "100hz"
+						}
+					case pprof.ModeOffCPU:
+						if rateFlag == "" {
+							rateFlag = "10hz"
+						}
+					default:
+						return fmt.Errorf("unknown mode %q, want cpu or offcpu", mode)
+					}
+					rate, err := pprof.ParseRate(rateFlag)
+					if err != nil {
+						return err
+					}
+					format := c.String("format")
+					output, err := profileOutput(c, string(mode), format)
+					if err != nil {
+						return err
+					}
+
+					memReader, err := openMemReader(c)
+					if err != nil {
+						return fmt.Errorf("failed to create memory reader: %w", err)
+					}
+					defer memReader.Close()
+
+					ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+					defer stop()
+					fmt.Fprintf(os.Stderr, "Recording pid %d at %dhz for %s, Ctrl-C to stop\n", memReader.Pid(), rate, c.Duration("duration"))
+					profile, err := pprof.Record(ctx, memReader, pprof.RecordOptions{Duration: c.Duration("duration"), Rate: rate, Mode: mode})
+					if err != nil {
+						return fmt.Errorf("failed to record: %w", err)
+					}
+
+					if err := writeProfile(profile, output, format); err != nil {
+						return err
+					}
+					for _, comment := range profile.Comments[1:] {
+						fmt.Fprintf(os.Stderr, "Note: %s\n", comment)
+					}
+					fmt.Printf("Wrote %s profile of pid %d (%d unique stacks) to %s\n",
+						mode, memReader.Pid(), len(profile.Samples), output)
+					if mode == pprof.ModeOffCPU {
+						fmt.Println()
+						printWaitReasons(pprof.WaitReasons(profile))
+					}
+					return nil
+				},
+			},
+			{
+				Name:    "buildinfo",
+				Aliases: []string{"bi"},
+				Usage:   "Show main module, dependency versions and build settings",
+				Flags: slices.Concat(processFlags, offlineFlags, []cli.Flag{
+					&cli.StringFlag{
+						Name:    "bin",
+						Aliases: []string{"b"},
+						Usage:   "Path to binary file, read offline when --pid is not given",
+					},
+					allowMismatchFlag,
+					&cli.BoolFlag{
+						Name:    "json",
+						Aliases: []string{"j"},
+						Usage:   "Output in JSON format",
+					},
+				}, remoteFlags),
+				Action: func(c *cli.Context) error {
+					binPath := c.String("bin")
+
+					var bi *proc.BuildInfo
+					switch {
+					case hasTarget(c) || c.String("core") != "" || c.String("snapshot") != "":
+						memReader, err := openMemReader(c)
+						if err != nil {
+							return fmt.Errorf("failed to create memory reader: %w", err)
+						}
+						defer memReader.Close()
+						rt, err := memReader.RuntimeInfo()
+						if err != nil {
+							return fmt.Errorf("failed to get runtime info: %w", err)
+						}
+						if rt.BuildInfo == nil {
+							return fmt.Errorf("no build info found in process %d", memReader.Pid())
+						}
+						bi = rt.BuildInfo
+					case binPath != "":
+						var err error
+						bi, err = proc.ReadBuildInfoFile(binPath)
+						if err != nil {
+							return fmt.Errorf("failed to read build info: %w", err)
+						}
+					default:
+						return fmt.Errorf("one of --pid, --container, --name, --match, --core, --snapshot or --bin is required")
+					}
+
+					if c.Bool("json") {
+						enc := json.NewEncoder(os.Stdout)
+						enc.SetIndent("", "  ")
+						return enc.Encode(bi)
+					}
+					printBuildInfo(bi)
+					return nil
+				},
+			},
+			{
+				Name:  "ps",
+				Usage: "List running Go processes",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  "name",
+						Usage: "Only list processes with this executable name",
+					},
+					&cli.StringFlag{
+						Name:  "match",
+						Usage: "Only list processes whose command line matches this regexp",
+					},
+					&cli.BoolFlag{
+						Name:  "goroutines",
+						Usage: "Attach to every process to count its goroutines (slow, needs root)",
+					},
+					&cli.BoolFlag{
+						Name:    "json",
+						Aliases: []string{"j"},
+						Usage:   "Output in JSON format",
+					},
+				},
+				Action: func(c *cli.Context) error {
+					var re *regexp.Regexp
+					if match := c.String("match"); match != "" {
+						var err error
+						if re, err = regexp.Compile(match); err != nil {
+							return fmt.Errorf("invalid --match: %w", err)
+						}
+					}
+					countGoroutines := c.Bool("goroutines")
+					if countGoroutines && os.Geteuid() != 0 {
+						return fmt.Errorf("--goroutines needs root to attach to other processes")
+					}
+					procs, err := proc.FindGoProcesses()
+					if err != nil {
+						return fmt.Errorf("failed to list processes: %w", err)
+					}
+					matched := make([]proc.GoProcess, 0, len(procs))
+					for _, p := range procs {
+						if p.Matches(c.String("name"), re) {
+							if countGoroutines {
+								p.Goroutines = proc.CountGoroutines(p.PID)
+							}
+							matched = append(matched, p)
+						}
+					}
+
+					if c.Bool("json") {
+						enc := json.NewEncoder(os.Stdout)
+						enc.SetIndent("", "  ")
+						return enc.Encode(matched)
+					}
+
+					w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+					fmt.Fprintln(w, "PID\tGO\tGOROUTINES\tRSS\tUPTIME\tMODULE\tCOMMAND")
+					for _, p := range matched {
+						goroutines := "-"
+						if p.Goroutines >= 0 {
+							goroutines = fmt.Sprint(p.Goroutines)
+						}
+						goVersion := p.GoVersion
+						if goVersion == "" {
+							goVersion = "?"
+						}
+						fmt.Fprintf(w, "%d\t%s\t%s\t%.1fM\t%s\t%s\t%s\n",
+							p.PID, goVersion, goroutines, float64(p.RSS)/(1<<20),
+							proc.FormatDuration(p.Uptime.Truncate(time.Second)), p.ModulePath, p.Command)
+					}
+					return w.Flush()
+				},
+			},
+			{
+				Name:      "gen-layouts",
+				Usage:     "Generate versioned runtime struct layout tables from reference binaries",
+				ArgsUsage: "<binary>...",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:    "output",
+						Aliases: []string{"o"},
+						Usage:   "Write generated Go source to file instead of stdout",
+					},
+					&cli.StringFlag{
+						Name:  "package",
+						Usage: "Package name of generated source",
+						Value: "proc",
+					},
+					&cli.StringFlag{
+						Name:  "var",
+						Usage: "Variable name of generated layout table",
+						Value: "runtimeLayouts",
+					},
+				},
+				Action: func(c *cli.Context) error {
+					if c.NArg() == 0 {
+						return fmt.Errorf("at least one reference binary is required")
+					}
+
+					var layouts []*bin.Layout
+					seen := make(map[string]string) // go version -> binary path
+					for _, path := range c.Args().Slice() {
+						info, err := buildinfo.ReadFile(path)
+						if err != nil {
+							return fmt.Errorf("failed to read build info of %s: %w", path, err)
+						}
+						if prev, ok := seen[info.GoVersion]; ok {
+							fmt.Fprintf(os.Stderr, "Skipping %s: %s already covered by %s\n", path, info.GoVersion, prev)
+							continue
+						}
+						seen[info.GoVersion] = path
+						loader := bin.NewBinaryLoader()
+						if err := loader.Load(path); err != nil {
+							return fmt.Errorf("failed to load %s: %w", path, err)
+						}
+						dwarfLoader, err := loader.GetDWARFLoader()
+						if err != nil {
+							loader.Close()
+							return fmt.Errorf("failed to get DWARF loader for %s: %w", path, err)
+						}
+						layout, err := bin.ExtractLayout(dwarfLoader, info.GoVersion, bin.RuntimeStructSpecs)
+						loader.Close()
+						if err != nil {
+							return fmt.Errorf("failed to extract layout from %s: %w", path, err)
+						}
+						layouts = append(layouts, layout)
+					}
+					bin.SortLayouts(layouts)
+
+					out := os.Stdout
+					report := os.Stderr
+					if path := c.String("output"); path != "" {
+						f, err := os.Create(path)
+						if err != nil {
+							return fmt.Errorf("failed to create %s: %w", path, err)
+						}
+						defer f.Close()
+						out = f
+						report = os.Stdout
+					}
+					if err := bin.WriteLayoutSource(out, c.String("package"), c.String("var"), layouts); err != nil {
+						return err
+					}
+
+					changes := bin.DiffLayouts(layouts)
+					fmt.Fprintf(report, "Layout changes across %d binaries (%d):\n", len(layouts), len(changes))
+					for _, change := range changes {
+						fmt.Fprintf(report, "  %s\n", change)
+					}
+					return nil
+				},
+			},
 		},
 		Action: func(c *cli.Context) error {
 			fmt.Println("Welcome to gospy! Use 'summary --pid' to get process info")
@@ -300,3 +919,537 @@ func main() {
 		os.Exit(1)
 	}
 }
+
+// readerOptions builds proc reader options from command flags
+func readerOptions(c *cli.Context) []proc.Option {
+	var opts []proc.Option
+	if c.Bool("allow-mismatch") {
+		opts = append(opts, proc.WithAllowBinaryMismatch())
+	}
+	if c.Bool("freeze") {
+		opts = append(opts, proc.WithFreeze(c.Duration("freeze-budget")))
+	}
+	return opts
+}
+
+// profileOutput returns --output, or name plus the extension of format
+func profileOutput(c *cli.Context, name, format string) (string, error) {
+	ext, err := pprof.FormatExt(format)
+	if err != nil {
+		return "", err
+	}
+	if output := c.String("output"); output != "" {
+		return output, nil
+	}
+	return name + ext, nil
+}
+
+func writeProfile(profile *pprof.Profile, output, format string) error {
+	out, err := os.Create(output)
+	if err != nil {
+		return fmt.Errorf("failed to create profile file: %w", err)
+	}
+	if err := profile.WriteFormat(out, format); err != nil {
+		out.Close()
+		return fmt.Errorf("failed to write profile: %w", err)
+	}
+	return out.Close()
+}
+
+func printWaitReasons(stats []pprof.WaitReasonStat) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "WAIT REASON\tBLOCKED\tSHARE\tAVG GOROUTINES\tTOP CALLER")
+	for _, st := range stats {
+		fmt.Fprintf(w, "%s\t%s\t%.1f%%\t%.1f\t%s\n",
+			st.Reason, st.Blocked.Round(time.Millisecond), st.Share*100, st.AvgGoroutines, st.TopCaller)
+	}
+	w.Flush()
+}
+
+func printBuildInfo(bi *proc.BuildInfo) {
+	fmt.Printf("Go Version: %s\n", bi.GoVersion)
+	fmt.Printf("Path: %s\n", bi.Path)
+	fmt.Printf("Main Module: %s %s %s\n", bi.Main.Path, bi.Main.Version, bi.Main.Sum)
+
+	fmt.Printf("\nDependencies (%d):\n", len(bi.Deps))
+	for _, dep := range bi.Deps {
+		fmt.Printf("  %s %s %s\n", dep.Path, dep.Version, dep.Sum)
+		if dep.Replace != nil {
+			fmt.Printf("    => %s %s %s\n", dep.Replace.Path, dep.Replace.Version, dep.Replace.Sum)
+		}
+	}
+
+	fmt.Printf("\nBuild Settings (%d):\n", len(bi.Settings))
+	for _, setting := range bi.Settings {
+		fmt.Printf("  %s=%s\n", setting.Key, setting.Value)
+	}
+}
+
+// allowFlags restrict the processes a server reads, see allowlist
+var allowFlags = []cli.Flag{
+	&cli.IntSliceFlag{
+		Name:  "allow-pid",
+		Usage: "Allow reading these process IDs (--allow-pid 1,2,3)",
+	},
+	&cli.StringSliceFlag{
+		Name:  "allow-exe",
+		Usage: "Allow reading processes whose full executable path, as seen in their container, matches this glob (repeatable, * doesn't match /)",
+	},
+	&cli.StringSliceFlag{
+		Name:  "allow-cgroup",
+		Usage: "Allow reading processes in this cgroup or below it, a path as in /proc/<pid>/cgroup (repeatable)",
+	},
+}
+
+func allowlist(c *cli.Context) *proc.Allowlist {
+	return &proc.Allowlist{
+		PIDs:    c.IntSlice("allow-pid"),
+		Exes:    c.StringSlice("allow-exe"),
+		Cgroups: c.StringSlice("allow-cgroup"),
+	}
+}
+
+// processFlags select a single live target, see targetPid
+var processFlags = []cli.Flag{
+	&cli.IntFlag{
+		Name:    "pid",
+		Aliases: []string{"p"},
+		Usage:   "Target process ID",
+	},
+	containerFlag,
+	&cli.StringFlag{
+		Name:  "name",
+		Usage: "Target the Go process with this executable name instead of --pid",
+	},
+	&cli.StringFlag{
+		Name:  "match",
+		Usage: "Target the Go process whose command line matches this regexp instead of --pid",
+	},
+}
+
+// containerFlag is shared with the multi-process summary
+var containerFlag = &cli.StringFlag{
+	Name:  "container",
+	Usage: "Target the Go process in this container (id or prefix, as in docker ps/crictl ps)",
+}
+
+// offlineFlags read a core file or snapshot instead of a live process, see openMemReader
+var offlineFlags = []cli.Flag{
+	&cli.StringFlag{
+		Name:  "core",
+		Usage: "Analyze an ELF core file instead of a live process (use --bin if the executable moved)",
+	},
+	&cli.StringFlag{
+		Name:  "snapshot",
+		Usage: "Analyze a snapshot file written by 'gospy snapshot'",
+	},
+}
+
+// binaryFlags pick the executable to read symbols from, see readerOptions
+var binaryFlags = []cli.Flag{
+	&cli.StringFlag{
+		Name:    "bin",
+		Aliases: []string{"b"},
+		Usage:   "Path to binary file (optional)",
+	},
+	allowMismatchFlag,
+}
+
+// allowMismatchFlag is read by readerOptions
+var allowMismatchFlag = &cli.BoolFlag{
+	Name:  "allow-mismatch",
+	Usage: "Only warn when --bin doesn't match the running process or core",
+}
+
+// freezeFlags stop the target while reading, see readerOptions
+var freezeFlags = []cli.Flag{
+	&cli.BoolFlag{
+		Name:  "freeze",
+		Usage: "Stop the target while reading for a consistent point-in-time view (Linux only)",
+	},
+	&cli.DurationFlag{
+		Name:  "freeze-budget",
+		Usage: "Resume a frozen target after this long even if reading isn't done",
+		Value: 500 * time.Millisecond,
+	},
+}
+
+// listenerFlags configure the socket of a server, see listen
+var listenerFlags = []cli.Flag{
+	&cli.StringFlag{
+		Name:  "cert",
+		Usage: "TLS certificate (PEM) of the server",
+	},
+	&cli.StringFlag{
+		Name:  "key",
+		Usage: "TLS private key (PEM) of --cert",
+	},
+	&cli.StringFlag{
+		Name:  "client-ca",
+		Usage: "Require client certificates signed by these CA certificates (PEM)",
+	},
+	&cli.StringFlag{
+		Name:  "socket-mode",
+		Usage: "Permissions of the unix socket",
+		Value: "0600",
+	},
+}
+
+// apiServerFlags secure the API server, see apiListener
+var apiServerFlags = append(append([]cli.Flag{
+	&cli.StringFlag{
+		Name:  "bind",
+		Usage: "Address to listen on with --port, 0.0.0.0 for all interfaces (requires --token-file or --client-ca), or unix:/path/to/socket",
+		Value: "127.0.0.1",
+	},
+	&cli.StringFlag{
+		Name:  "token-file",
+		Usage: "Require a bearer token from this file, one per line to allow rotating them",
+	},
+	&cli.BoolFlag{
+		Name:  "expose-env",
+		Usage: "Serve the values of environment variables in runtime info, only their names are by default",
+	},
+	&cli.StringSliceFlag{
+		Name:  "allow-origin",
+		Usage: "Let browser pages at this origin (repeatable, e.g. https://dash.example.com, * for any) open /stream WebSockets, only the server's own origin may by default",
+	},
+}, allowFlags...), listenerFlags...)
+
+// apiListener configures authentication, the allowlist, the allowed
+// WebSocket origins and environment redaction of s and listens on --bind and --port
+func apiListener(c *cli.Context, s *api.Server) (net.Listener, error) {
+	if allow := allowlist(c); !allow.Empty() {
+		if err := allow.Validate(); err != nil {
+			return nil, err
+		}
+		s.SetAllowlist(allow)
+	}
+	if tokenFile := c.String("token-file"); tokenFile != "" {
+		data, err := os.ReadFile(tokenFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read --token-file: %w", err)
+		}
+		tokens := strings.Fields(string(data))
+		if len(tokens) == 0 {
+			return nil, fmt.Errorf("no token in --token-file %s", tokenFile)
+		}
+		s.SetBearerTokens(tokens)
+	}
+	s.SetAllowedOrigins(c.StringSlice("allow-origin"))
+	s.SetExposeEnv(c.Bool("expose-env"))
+
+	addr := c.String("bind")
+	if !strings.HasPrefix(addr, "unix:") {
+		if !net.ParseIP(addr).IsLoopback() && addr != "localhost" && c.String("token-file") == "" && c.String("client-ca") == "" {
+			return nil, fmt.Errorf("anyone who can reach --bind %s could read process memory, use --token-file or --client-ca", addr)
+		}
+		addr = net.JoinHostPort(addr, strconv.Itoa(c.Int("port")))
+	}
+	l, err := listen(c, addr)
+	if err != nil {
+		return nil, err
+	}
+	fmt.Printf("Listening on %s\n", addr)
+	return l, nil
+}
+
+// remoteFlags select a process on another host, read through `gospy agent`
+var remoteFlags = []cli.Flag{
+	&cli.StringFlag{
+		Name:  "remote",
+		Usage: "Read --pid through the gospy agent at host:port or unix:/path/to/socket",
+	},
+	&cli.StringFlag{
+		Name:  "remote-cert",
+		Usage: "Client certificate (PEM) presented to the agent",
+	},
+	&cli.StringFlag{
+		Name:  "remote-key",
+		Usage: "Private key (PEM) of --remote-cert",
+	},
+	&cli.StringFlag{
+		Name:  "remote-ca",
+		Usage: "CA certificates (PEM) the agent's certificate must be signed by, system roots if unset",
+	},
+}
+
+// remoteTLSConfig returns the TLS config for --remote, nil for unix sockets
+func remoteTLSConfig(c *cli.Context) (*tls.Config, error) {
+	if strings.HasPrefix(c.String("remote"), "unix:") {
+		return nil, nil
+	}
+	cfg := &tls.Config{MinVersion: tls.VersionTLS12}
+	if certFile := c.String("remote-cert"); certFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, c.String("remote-key"))
+		if err != nil {
+			return nil, fmt.Errorf("failed to load --remote-cert: %w", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+	if caFile := c.String("remote-ca"); caFile != "" {
+		pool, err := loadCertPool(caFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load --remote-ca: %w", err)
+		}
+		cfg.RootCAs = pool
+	}
+	return cfg, nil
+}
+
+// listen listens on addr, a unix socket as unix:/path created with
+// --socket-mode, or TCP with TLS if --cert is set and mutual TLS if
+// --client-ca is set too
+func listen(c *cli.Context, addr string) (net.Listener, error) {
+	if path, ok := strings.CutPrefix(addr, "unix:"); ok {
+		mode, err := strconv.ParseUint(c.String("socket-mode"), 8, 32)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --socket-mode: %w", err)
+		}
+		os.Remove(path) // a stale socket of a previous run
+		l, err := net.Listen("unix", path)
+		if err != nil {
+			return nil, err
+		}
+		if err := os.Chmod(path, os.FileMode(mode)); err != nil {
+			l.Close()
+			return nil, err
+		}
+		return l, nil
+	}
+
+	certFile, keyFile, caFile := c.String("cert"), c.String("key"), c.String("client-ca")
+	if certFile == "" {
+		if caFile != "" {
+			return nil, fmt.Errorf("--client-ca requires --cert and --key")
+		}
+		return net.Listen("tcp", addr)
+	}
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load --cert: %w", err)
+	}
+	cfg := &tls.Config{MinVersion: tls.VersionTLS12, Certificates: []tls.Certificate{cert}}
+	if caFile != "" {
+		pool, err := loadCertPool(caFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load --client-ca: %w", err)
+		}
+		cfg.ClientAuth = tls.RequireAndVerifyClientCert
+		cfg.ClientCAs = pool
+	}
+	return tls.Listen("tcp", addr, cfg)
+}
+
+// loadCertPool reads PEM encoded certificates
+func loadCertPool(path string) (*x509.CertPool, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("no certificates found in %s", path)
+	}
+	return pool, nil
+}
+
+// openMemReader opens a reader for --core or --snapshot if given, otherwise for
+// the live process --pid, on another host with --remote
+func openMemReader(c *cli.Context) (proc.ProcessMemReader, error) {
+	if corePath := c.String("core"); corePath != "" {
+		return proc.NewCoreMemReader(corePath, c.String("bin"), readerOptions(c)...)
+	}
+	if snapshotPath := c.String("snapshot"); snapshotPath != "" {
+		return proc.NewSnapshotMemReader(snapshotPath, c.String("bin"))
+	}
+	if addr := c.String("remote"); addr != "" {
+		// the selectors would run on this host, only a pid means the same there
+		if pidArg(c) == 0 || c.String("container") != "" || c.String("name") != "" || c.String("match") != "" {
+			return nil, fmt.Errorf("--remote requires --pid")
+		}
+		tlsConfig, err := remoteTLSConfig(c)
+		if err != nil {
+			return nil, err
+		}
+		return proc.NewRemoteMemReader(addr, tlsConfig, pidArg(c), c.String("bin"), readerOptions(c)...)
+	}
+	pid, err := targetPid(c)
+	if err != nil {
+		return nil, err
+	}
+	if pid == 0 {
+		return nil, fmt.Errorf("one of --pid, --container, --name, --match, --core or --snapshot is required")
+	}
+	if os.Geteuid() != 0 {
+		return nil, fmt.Errorf("must be run as root")
+	}
+	return proc.NewProcessMemReader(pid, c.String("bin"), readerOptions(c)...)
+}
+
+// targetPid returns --pid, or the Go process selected by --container or
+// --name/--match, 0 if none is set
+func targetPid(c *cli.Context) (int, error) {
+	id := c.String("container")
+	name, match := c.String("name"), c.String("match")
+	selectors := 0
+	for _, set := range []bool{pidArg(c) != 0, id != "", name != "" || match != ""} {
+		if set {
+			selectors++
+		}
+	}
+	if selectors > 1 {
+		return 0, fmt.Errorf("--pid, --container and --name/--match are mutually exclusive")
+	}
+
+	switch {
+	case id != "":
+		pid, err := proc.FindContainerPid(id)
+		if err != nil {
+			return 0, fmt.Errorf("failed to find process in container: %w", err)
+		}
+		return pid, nil
+	case name != "" || match != "":
+		var re *regexp.Regexp
+		if match != "" {
+			var err error
+			if re, err = regexp.Compile(match); err != nil {
+				return 0, fmt.Errorf("invalid --match: %w", err)
+			}
+		}
+		pid, err := proc.FindGoProcessPid(name, re)
+		if err != nil {
+			return 0, fmt.Errorf("failed to find process: %w", err)
+		}
+		return pid, nil
+	}
+	return pidArg(c), nil
+}
+
+// pidArg returns --pid, summary takes it as a list and uses the first one here
+func pidArg(c *cli.Context) int {
+	if pids := c.IntSlice("pid"); len(pids) > 0 {
+		return pids[0]
+	}
+	return c.Int("pid")
+}
+
+// hasTarget reports whether any live process selector flag is set
+func hasTarget(c *cli.Context) bool {
+	return pidArg(c) != 0 || c.String("container") != "" || c.String("name") != "" || c.String("match") != ""
+}
+
+// summaryPids returns the pids for a merged summary: all --pid values or every
+// Go process matching --name/--match. A single pid means a regular summary.
+func summaryPids(c *cli.Context) ([]int, error) {
+	if pids := c.IntSlice("pid"); len(pids) > 1 {
+		return pids, nil
+	}
+	name, match := c.String("name"), c.String("match")
+	if name == "" && match == "" {
+		return nil, nil
+	}
+	var re *regexp.Regexp
+	if match != "" {
+		var err error
+		if re, err = regexp.Compile(match); err != nil {
+			return nil, fmt.Errorf("invalid --match: %w", err)
+		}
+	}
+	pids, err := proc.FindGoProcessPids(name, re)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find process: %w", err)
+	}
+	return pids, nil
+}
+
+// metricsLimits returns the /metrics label cardinality limits set by flags
+func metricsLimits(c *cli.Context) api.MetricsLimits {
+	return api.MetricsLimits{
+		StartFuncs:  c.Int("max-start-funcs"),
+		WaitReasons: c.Int("max-wait-reasons"),
+	}
+}
+
+// exporterTargets returns a func listing the processes to export: the fixed
+// --pid list, or the Go processes matching --name/--match at call time
+func exporterTargets(c *cli.Context) (func() ([]int, error), error) {
+	if pids := c.IntSlice("pid"); len(pids) > 0 {
+		if c.String("name") != "" || c.String("match") != "" {
+			return nil, fmt.Errorf("--pid and --name/--match are mutually exclusive")
+		}
+		return func() ([]int, error) { return pids, nil }, nil
+	}
+	name, match := c.String("name"), c.String("match")
+	if name == "" && match == "" {
+		return nil, fmt.Errorf("one of --pid, --name or --match is required")
+	}
+	var re *regexp.Regexp
+	if match != "" {
+		var err error
+		if re, err = regexp.Compile(match); err != nil {
+			return nil, fmt.Errorf("invalid --match: %w", err)
+		}
+	}
+	return func() ([]int, error) {
+		pids, err := proc.FindGoProcessPids(name, re)
+		if err != nil {
+			return nil, fmt.Errorf("failed to find process: %w", err)
+		}
+		return pids, nil
+	}, nil
+}
+
+// aggregateSummary prints a merged summary of several processes
+func aggregateSummary(c *cli.Context, pids []int) error {
+	if os.Geteuid() != 0 {
+		return fmt.Errorf("must be run as root")
+	}
+	var readers []proc.ProcessMemReader
+	for _, pid := range pids {
+		reader, err := proc.NewProcessMemReader(pid, c.String("bin"), readerOptions(c)...)
+		if err != nil {
+			return fmt.Errorf("failed to create memory reader for pid %d: %w", pid, err)
+		}
+		defer reader.Close()
+		readers = append(readers, reader)
+	}
+	report := proc.Aggregate(readers, c.Bool("show-dead"))
+
+	if c.Bool("json") {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(report)
+	}
+
+	fmt.Printf("\nSummary of %d processes:\n", len(report.Processes))
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "  PID\tGO\tGOROUTINES\tNUM GC\tLAST GC\tGC PAUSE TOTAL")
+	for _, p := range report.Processes {
+		if p.Error != "" {
+			fmt.Fprintf(w, "  %d\terror: %s\n", p.PID, p.Error)
+			continue
+		}
+		lastGC := "never"
+		if p.MemStat.LastGC > 0 {
+			lastGC = proc.FormatDuration(time.Since(time.Unix(0, int64(p.MemStat.LastGC)))) + " ago"
+		}
+		fmt.Fprintf(w, "  %d\t%s\t%d\t%d\t%s\t%s\n", p.PID, p.GoVersion, p.Goroutines,
+			p.MemStat.NumGC, lastGC, proc.FormatDuration(time.Duration(p.MemStat.PauseTotalNs)))
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	fmt.Printf("\nGoroutine Groups (%d):\n", len(report.Groups))
+	w = tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "  TOTAL\tPER PID\tFUNCTION")
+	for _, g := range report.Groups {
+		perPID := make([]string, 0, len(report.Processes))
+		for _, p := range report.Processes {
+			perPID = append(perPID, fmt.Sprintf("%d:%d", p.PID, g.PerPID[p.PID]))
+		}
+		fmt.Fprintf(w, "  %d\t%s\t%s\n", g.Total, strings.Join(perPID, " "), g.Function)
+	}
+	return w.Flush()
+}
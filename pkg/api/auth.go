@@ -0,0 +1,100 @@
+package api
+
+import (
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/monsterxx03/gospy/pkg/proc"
+)
+
+// SetBearerTokens requires every request to send one of tokens as
+// "Authorization: Bearer <token>", several tokens allow rotating them.
+// Client certificates are verified by the listener, see Serve.
+func (s *Server) SetBearerTokens(tokens []string) {
+	s.tokens = nil
+	for _, t := range tokens {
+		if t = strings.TrimSpace(t); t != "" {
+			s.tokens = append(s.tokens, []byte(t))
+		}
+	}
+}
+
+// SetAllowlist restricts the live processes the server reads, nil allows all.
+// Readers added with AddReader are served regardless.
+func (s *Server) SetAllowlist(allow *proc.Allowlist) {
+	s.allow = allow
+}
+
+// SetAllowedOrigins lets browser pages at origins (e.g.
+// "https://dash.example.com", "*" for any) open WebSocket streams, by default
+// only pages served from the server's own host may.
+func (s *Server) SetAllowedOrigins(origins []string) {
+	s.origins = origins
+}
+
+// SetExposeEnv serves the values of the targets' environment variables in
+// runtime info, by default only their names are, the values are often secrets
+func (s *Server) SetExposeEnv(expose bool) {
+	s.exposeEnv = expose
+}
+
+// withAuth rejects requests without a valid bearer token, if tokens are set
+func (s *Server) withAuth(next http.Handler) http.Handler {
+	if len(s.tokens) == 0 {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || !s.validToken([]byte(token)) {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="gospy"`)
+			http.Error(w, "missing or invalid bearer token", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (s *Server) validToken(token []byte) bool {
+	valid := 0
+	for _, t := range s.tokens {
+		valid |= subtle.ConstantTimeCompare(t, token) // no early return, all tokens take as long
+	}
+	return valid == 1
+}
+
+// checkPid returns an error wrapping proc.ErrNotAllowed unless the server may
+// read the live process pid
+func (s *Server) checkPid(pid int) error {
+	if s.allow == nil {
+		return nil
+	}
+	return s.allow.Check(pid)
+}
+
+// allowedPids drops the processes the server may not read, for selections by
+// name where the others just don't match
+func (s *Server) allowedPids(pids []int) []int {
+	allowed := pids[:0]
+	for _, pid := range pids {
+		if s.checkPid(pid) == nil {
+			allowed = append(allowed, pid)
+		}
+	}
+	return allowed
+}
+
+// errUnknownSource is returned for a source no reader was added for
+var errUnknownSource = errors.New("unknown source")
+
+// readerErrorStatus is the status of a getReader error
+func readerErrorStatus(err error) int {
+	if errors.Is(err, proc.ErrNotAllowed) {
+		return http.StatusForbidden
+	}
+	if errors.Is(err, errUnknownSource) {
+		return http.StatusNotFound
+	}
+	return http.StatusInternalServerError
+}
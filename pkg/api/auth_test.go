@@ -0,0 +1,114 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/monsterxx03/gospy/pkg/proc"
+)
+
+func TestBearerToken(t *testing.T) {
+	s := NewServer(0, false, false)
+	s.SetBearerTokens([]string{"old", "new"})
+	h := s.Handler()
+	for _, c := range []struct {
+		auth string
+		want int
+	}{
+		{"", http.StatusUnauthorized},
+		{"Bearer wrong", http.StatusUnauthorized},
+		{"new", http.StatusUnauthorized},
+		{"Bearer ne", http.StatusUnauthorized},
+		{"Bearer new", http.StatusOK},
+		{"Bearer old", http.StatusOK},
+	} {
+		r := httptest.NewRequest("GET", "/openapi.json", nil)
+		if c.auth != "" {
+			r.Header.Set("Authorization", c.auth)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if w.Code != c.want {
+			t.Errorf("Authorization %q: status %d, want %d", c.auth, w.Code, c.want)
+		}
+	}
+}
+
+// pinnedReader stands in for a core file, only its pid is used
+type pinnedReader struct{ proc.ProcessMemReader }
+
+func (pinnedReader) Pid() int { return 1 << 30 }
+
+func TestAllowlist(t *testing.T) {
+	s := NewServer(0, false, false)
+	s.SetAllowlist(&proc.Allowlist{PIDs: []int{os.Getpid()}})
+	s.AddReader("core:/tmp/core", pinnedReader{})
+
+	if err := s.checkPid(os.Getpid()); err != nil {
+		t.Errorf("allowed pid: %v", err)
+	}
+	if got := s.allowedPids([]int{1, os.Getpid()}); len(got) != 1 || got[0] != os.Getpid() {
+		t.Errorf("allowedPids = %v", got)
+	}
+	if _, err := s.getReader("core:/tmp/core", 1<<30); err != nil {
+		t.Errorf("reader added with AddReader: %v", err)
+	}
+	// a core doesn't stand in for the live process with its pid
+	if _, err := s.getReader("", 1<<30); !errors.Is(err, proc.ErrNotAllowed) {
+		t.Errorf("live pid of a core: %v, want ErrNotAllowed", err)
+	}
+	if _, err := s.getReader("core:/tmp/other", 1<<30); !errors.Is(err, errUnknownSource) {
+		t.Errorf("unknown source: %v, want errUnknownSource", err)
+	}
+
+	w := httptest.NewRecorder()
+	s.Handler().ServeHTTP(w, httptest.NewRequest("GET", "/runtime?pid=1", nil))
+	if w.Code != http.StatusForbidden {
+		t.Errorf("denied pid: status %d, want 403: %s", w.Code, w.Body)
+	}
+}
+
+// envReader stands in for a core whose target has a secret in its environment
+type envReader struct{ stackReader }
+
+func (r *envReader) RuntimeInfo() (*proc.Runtime, error) {
+	return &proc.Runtime{GoVersion: "go1.23.4", Env: []string{"HOME=/root", "DB_PASSWORD=hunter2"}}, nil
+}
+
+func TestExposeEnv(t *testing.T) {
+	for _, expose := range []bool{false, true} {
+		s := NewServer(0, false, false)
+		s.SetExposeEnv(expose)
+		reader := &envReader{stackReader{pid: 1 << 30}}
+		s.AddReader("core:/tmp/core", reader)
+
+		w := httptest.NewRecorder()
+		s.Handler().ServeHTTP(w, httptest.NewRequest("GET", "/runtime?pid=1073741824&source=core:/tmp/core", nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("status %d: %s", w.Code, w.Body)
+		}
+		var rt proc.Runtime
+		if err := json.Unmarshal(w.Body.Bytes(), &rt); err != nil {
+			t.Fatal(err)
+		}
+		smp, err := s.readStreamSample(reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		want := []string{"HOME=<redacted>", "DB_PASSWORD=<redacted>"}
+		if expose {
+			want = []string{"HOME=/root", "DB_PASSWORD=hunter2"}
+		}
+		for name, env := range map[string][]string{"/runtime": rt.Env, "/stream": smp.rt.Env} {
+			if strings.Join(env, " ") != strings.Join(want, " ") {
+				t.Errorf("expose %v, %s env = %q, want %q", expose, name, env, want)
+			}
+		}
+	}
+}
@@ -0,0 +1,431 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/monsterxx03/gospy/pkg/proc"
+)
+
+// GoroutineStack is a goroutine with its stack, as served by /goroutines/{goid} and /dump
+type GoroutineStack struct {
+	proc.G
+	WaitSeconds float64           `json:"wait_seconds,omitempty"` // see proc.G.WaitDuration
+	Frames      []proc.StackFrame `json:"frames"`
+	StackError  string            `json:"stack_error,omitempty"` // why Frames is empty
+}
+
+// GroupCount is one group of /groups
+type GroupCount struct {
+	Key      string         `json:"key"`
+	Count    int            `json:"count"`
+	ByStatus map[string]int `json:"by_status"`
+}
+
+// groupKeys are the supported /groups?by= values
+var groupKeys = map[string]func(g proc.G) string{
+	"start_func":  func(g proc.G) string { return g.StartFuncName },
+	"wait_reason": func(g proc.G) string { return g.WaitReason },
+	"status":      func(g proc.G) string { return g.Status },
+	"creator":     func(g proc.G) string { return g.CreatedBy },
+}
+
+// goroutineFilter selects goroutines with the query parameters status and
+// wait_reason (comma separated lists), func (regexp matched against the
+// current and the start function) and min_wait (a duration)
+type goroutineFilter struct {
+	status     map[string]bool
+	waitReason map[string]bool
+	fn         *regexp.Regexp
+	minWait    time.Duration
+}
+
+func parseGoroutineFilter(q url.Values) (*goroutineFilter, error) {
+	f := &goroutineFilter{status: listParam(q, "status"), waitReason: listParam(q, "wait_reason")}
+	if expr := q.Get("func"); expr != "" {
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid func regexp: %w", err)
+		}
+		f.fn = re
+	}
+	if s := q.Get("min_wait"); s != "" {
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid min_wait %q", s)
+		}
+		f.minWait = d
+	}
+	return f, nil
+}
+
+func listParam(q url.Values, name string) map[string]bool {
+	s := q.Get(name)
+	if s == "" {
+		return nil
+	}
+	set := make(map[string]bool)
+	for _, v := range strings.Split(s, ",") {
+		set[strings.TrimSpace(v)] = true
+	}
+	return set
+}
+
+func (f *goroutineFilter) match(g proc.G) bool {
+	if f.status != nil && !f.status[g.Status] {
+		return false
+	}
+	if f.waitReason != nil && !f.waitReason[g.WaitReason] {
+		return false
+	}
+	if f.fn != nil && !f.fn.MatchString(g.FuncName) && !f.fn.MatchString(g.StartFuncName) {
+		return false
+	}
+	if f.minWait > 0 && g.WaitDuration() < f.minWait {
+		return false
+	}
+	return true
+}
+
+// errNoClock is returned for min_wait when the reader doesn't know the target's
+// clock, like for cores, wait durations can't be told then
+var errNoClock = errors.New("min_wait needs the target's clock, which this source doesn't record")
+
+// checkClock fails if the filter needs wait durations the goroutines don't have
+func (f *goroutineFilter) checkClock(goroutines []proc.G) error {
+	// all goroutines of a read share the clock
+	if f.minWait > 0 && len(goroutines) > 0 && goroutines[0].Nanotime == 0 {
+		return errNoClock
+	}
+	return nil
+}
+
+func (f *goroutineFilter) apply(goroutines []proc.G) []proc.G {
+	matched := make([]proc.G, 0, len(goroutines))
+	for _, g := range goroutines {
+		if f.match(g) {
+			matched = append(matched, g)
+		}
+	}
+	// a stable order so that offset/limit pages don't overlap
+	sort.Slice(matched, func(i, j int) bool { return matched[i].Goid < matched[j].Goid })
+	return matched
+}
+
+// page is the offset and limit query parameters
+type page struct {
+	offset, limit int // limit < 0 for no limit
+}
+
+func parsePage(q url.Values) (page, error) {
+	p := page{limit: -1}
+	for name, dst := range map[string]*int{"offset": &p.offset, "limit": &p.limit} {
+		if s := q.Get(name); s != "" {
+			n, err := strconv.Atoi(s)
+			if err != nil || n < 0 {
+				return page{}, fmt.Errorf("invalid %s %q", name, s)
+			}
+			*dst = n
+		}
+	}
+	return p, nil
+}
+
+// pageOf returns the items of the page and reports the total in the X-Total-Count header
+func pageOf[T any](w http.ResponseWriter, p page, items []T) []T {
+	w.Header().Set("X-Total-Count", strconv.Itoa(len(items)))
+	lo := min(p.offset, len(items))
+	hi := len(items)
+	if p.limit >= 0 {
+		hi = min(lo+p.limit, hi)
+	}
+	return items[lo:hi]
+}
+
+// readerFor returns the reader of the pid and source query parameters, writing the error response if there is none
+func (s *Server) readerFor(w http.ResponseWriter, r *http.Request) (proc.ProcessMemReader, bool) {
+	pid, err := getPID(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return nil, false
+	}
+	reader, err := s.getReader(getSource(r), pid)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to create reader: %v", err), readerErrorStatus(err))
+		return nil, false
+	}
+	return reader, true
+}
+
+// withStacks unwinds goroutines, failures are reported per goroutine
+func withStacks(reader proc.ProcessMemReader, goroutines []proc.G) []GoroutineStack {
+	out := make([]GoroutineStack, len(goroutines))
+	for i, g := range goroutines {
+		out[i] = GoroutineStack{G: g, WaitSeconds: g.WaitDuration().Seconds()}
+		frames, err := reader.StackTrace(g)
+		if err != nil {
+			out[i].StackError = err.Error()
+		}
+		out[i].Frames = frames
+	}
+	return out
+}
+
+// findGoroutine reads the goroutine of the goid query or path parameter and
+// its stack, writing the error response if it can't
+func (s *Server) findGoroutine(w http.ResponseWriter, r *http.Request, goidStr string) (*GoroutineStack, bool) {
+	goid, err := strconv.ParseInt(goidStr, 10, 64)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("invalid goid %q", goidStr), http.StatusBadRequest)
+		return nil, false
+	}
+	reader, ok := s.readerFor(w, r)
+	if !ok {
+		return nil, false
+	}
+	var found *GoroutineStack
+	err = reader.Frozen(func() error {
+		goroutines, err := reader.Goroutines(true)
+		if err != nil {
+			return fmt.Errorf("failed to get goroutines: %w", err)
+		}
+		for _, g := range goroutines {
+			if g.Goid == goid {
+				found = &withStacks(reader, []proc.G{g})[0]
+				break
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return nil, false
+	}
+	if found == nil {
+		http.Error(w, fmt.Sprintf("goroutine %d not found", goid), http.StatusNotFound)
+		return nil, false
+	}
+	return found, true
+}
+
+// handleGoroutine serves /goroutines/{goid}, the goroutine with its stack
+func (s *Server) handleGoroutine(w http.ResponseWriter, r *http.Request) {
+	if g, ok := s.findGoroutine(w, r, r.PathValue("goid")); ok {
+		writeJSON(w, g)
+	}
+}
+
+// handleStack serves /stack?pid=&goid=, the stack of one goroutine
+func (s *Server) handleStack(w http.ResponseWriter, r *http.Request) {
+	goid := r.URL.Query().Get("goid")
+	if goid == "" {
+		http.Error(w, "goid parameter is required", http.StatusBadRequest)
+		return
+	}
+	if g, ok := s.findGoroutine(w, r, goid); ok {
+		writeJSON(w, g.Frames)
+	}
+}
+
+func (s *Server) handleProcessors(w http.ResponseWriter, r *http.Request) {
+	reader, ok := s.readerFor(w, r)
+	if !ok {
+		return
+	}
+	ps, err := reader.Ps()
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to get processor info: %v", err), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, ps)
+}
+
+// handleThreads serves the goroutine each thread (M) is running
+func (s *Server) handleThreads(w http.ResponseWriter, r *http.Request) {
+	reader, ok := s.readerFor(w, r)
+	if !ok {
+		return
+	}
+	threads, err := reader.SampleThreads()
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to get threads: %v", err), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, threads)
+}
+
+// handleDump serves all goroutines with their stacks, as JSON or with
+// format=text in the layout of a Go traceback
+func (s *Server) handleDump(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	format := q.Get("format")
+	if format != "" && format != "json" && format != "text" {
+		http.Error(w, fmt.Sprintf("unknown format %q, want json or text", format), http.StatusBadRequest)
+		return
+	}
+	filter, err := parseGoroutineFilter(q)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	pg, err := parsePage(q)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	reader, ok := s.readerFor(w, r)
+	if !ok {
+		return
+	}
+
+	var dump []GoroutineStack
+	err = reader.Frozen(func() error {
+		goroutines, err := reader.Goroutines(s.showDead)
+		if err != nil {
+			return fmt.Errorf("failed to get goroutines: %w", err)
+		}
+		if err := filter.checkClock(goroutines); err != nil {
+			return err
+		}
+		dump = withStacks(reader, pageOf(w, pg, filter.apply(goroutines)))
+		return nil
+	})
+	if errors.Is(err, errNoClock) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if format == "text" {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		writeTraceback(w, dump)
+		return
+	}
+	writeJSON(w, dump)
+}
+
+// writeTraceback writes goroutines like a Go panic does
+func writeTraceback(w io.Writer, dump []GoroutineStack) {
+	for _, g := range dump {
+		state := g.Status
+		if g.WaitReason != "" {
+			state = g.WaitReason
+		}
+		if mins := int(g.WaitDuration().Minutes()); mins > 0 {
+			state += fmt.Sprintf(", %d minutes", mins)
+		}
+		fmt.Fprintf(w, "goroutine %d [%s]:\n", g.Goid, state)
+		for _, f := range g.Frames {
+			fmt.Fprintf(w, "%s(...)\n\t%s:%d\n", f.Function, f.File, f.Line)
+		}
+		if g.StackError != "" {
+			fmt.Fprintf(w, "\t(stack unavailable: %s)\n", g.StackError)
+		}
+		if g.CreatedBy != "" {
+			fmt.Fprintf(w, "created by %s", g.CreatedBy)
+			if g.ParentGoid != 0 {
+				fmt.Fprintf(w, " in goroutine %d", g.ParentGoid)
+			}
+			fmt.Fprintln(w)
+		}
+		fmt.Fprintln(w)
+	}
+}
+
+// handleGroups counts goroutines by=start_func, wait_reason, status or creator
+func (s *Server) handleGroups(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	by := q.Get("by")
+	if by == "" {
+		by = "start_func"
+	}
+	key, ok := groupKeys[by]
+	if !ok {
+		http.Error(w, fmt.Sprintf("unknown group %q, want start_func, wait_reason, status or creator", by), http.StatusBadRequest)
+		return
+	}
+	filter, err := parseGoroutineFilter(q)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	pg, err := parsePage(q)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	reader, ok := s.readerFor(w, r)
+	if !ok {
+		return
+	}
+	goroutines, err := reader.Goroutines(s.showDead)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to get goroutines: %v", err), http.StatusInternalServerError)
+		return
+	}
+	if err := filter.checkClock(goroutines); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	groups := make(map[string]*GroupCount)
+	for _, g := range filter.apply(goroutines) {
+		k := key(g)
+		if k == "" {
+			k = "none"
+		}
+		group, ok := groups[k]
+		if !ok {
+			group = &GroupCount{Key: k, ByStatus: make(map[string]int)}
+			groups[k] = group
+		}
+		group.Count++
+		group.ByStatus[g.Status]++
+	}
+	out := make([]GroupCount, 0, len(groups))
+	for _, group := range groups {
+		out = append(out, *group)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Count != out[j].Count {
+			return out[i].Count > out[j].Count
+		}
+		return out[i].Key < out[j].Key
+	})
+	writeJSON(w, pageOf(w, pg, out))
+}
+
+// handlePs lists the Go processes on the host the server may read, like gospy ps
+func (s *Server) handlePs(w http.ResponseWriter, r *http.Request) {
+	procs, err := s.goProcesses()
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to list processes: %v", err), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, procs)
+}
+
+// goProcesses lists the Go processes on the host that aren't hidden by the allowlist
+func (s *Server) goProcesses() ([]proc.GoProcess, error) {
+	procs, err := proc.FindGoProcesses()
+	if err != nil {
+		return nil, err
+	}
+	allowed := procs[:0]
+	for _, p := range procs {
+		if s.checkPid(p.PID) == nil {
+			allowed = append(allowed, p)
+		}
+	}
+	return allowed, nil
+}
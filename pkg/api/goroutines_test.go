@@ -0,0 +1,196 @@
+package api
+
+import (
+	"bytes"
+	"errors"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/monsterxx03/gospy/pkg/proc"
+)
+
+func TestGoroutineFilter(t *testing.T) {
+	goroutines := []proc.G{
+		{Goid: 5, Status: "waiting", WaitReason: "chan receive", FuncName: "runtime.gopark", StartFuncName: "main.worker"},
+		{Goid: 1, Status: "running", FuncName: "main.main", StartFuncName: "runtime.main"},
+		{Goid: 3, Status: "waiting", WaitReason: "IO wait", FuncName: "runtime.gopark", StartFuncName: "net/http.(*conn).serve"},
+		{Goid: 4, Status: "waiting", WaitReason: "select", FuncName: "runtime.gopark", StartFuncName: "main.worker"},
+	}
+	for query, want := range map[string]string{
+		"":                                     "1,3,4,5",
+		"status=waiting":                       "3,4,5",
+		"status=running,waiting&func=^main":    "1,4,5",
+		"wait_reason=select,IO wait":           "3,4",
+		"func=worker&wait_reason=chan receive": "5",
+	} {
+		q, _ := url.ParseQuery(query)
+		f, err := parseGoroutineFilter(q)
+		if err != nil {
+			t.Fatalf("%s: %v", query, err)
+		}
+		var goids []string
+		for _, g := range f.apply(goroutines) {
+			goids = append(goids, string(rune('0'+g.Goid)))
+		}
+		if got := strings.Join(goids, ","); got != want {
+			t.Errorf("%q: got goroutines %s, want %s", query, got, want)
+		}
+	}
+	for _, query := range []string{"func=(", "min_wait=long"} {
+		q, _ := url.ParseQuery(query)
+		if _, err := parseGoroutineFilter(q); err == nil {
+			t.Errorf("%q accepted", query)
+		}
+	}
+}
+
+func TestMinWait(t *testing.T) {
+	now := int64(time.Hour)
+	goroutines := []proc.G{
+		{Goid: 1, Status: "running", Nanotime: now},
+		{Goid: 2, Status: "waiting", WaitSince: now - int64(5*time.Minute), Nanotime: now},
+		{Goid: 3, Status: "waiting", WaitSince: now - int64(30*time.Second), Nanotime: now},
+		{Goid: 4, Status: "waiting", Nanotime: now}, // not waiting since a GC yet
+	}
+	q, _ := url.ParseQuery("min_wait=1m")
+	f, err := parseGoroutineFilter(q)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := f.checkClock(goroutines); err != nil {
+		t.Fatal(err)
+	}
+	if got := f.apply(goroutines); len(got) != 1 || got[0].Goid != 2 {
+		t.Errorf("min_wait=1m: got %v, want goroutine 2", got)
+	}
+
+	// a core doesn't record the target's clock
+	for i := range goroutines {
+		goroutines[i].Nanotime = 0
+	}
+	if err := f.checkClock(goroutines); !errors.Is(err, errNoClock) {
+		t.Errorf("without a clock: %v, want errNoClock", err)
+	}
+	if d := goroutines[1].WaitDuration(); d != 0 {
+		t.Errorf("wait duration without a clock: %v, want 0", d)
+	}
+	var b bytes.Buffer
+	writeTraceback(&b, []GoroutineStack{{G: goroutines[1]}})
+	if strings.Contains(b.String(), "minutes") {
+		t.Errorf("traceback without a clock: %q", b.String())
+	}
+}
+
+func TestPagination(t *testing.T) {
+	items := []int{0, 1, 2, 3, 4}
+	for query, want := range map[string][]int{
+		"":                  {0, 1, 2, 3, 4},
+		"limit=2":           {0, 1},
+		"offset=3":          {3, 4},
+		"offset=3&limit=10": {3, 4},
+		"offset=9":          {},
+		"limit=0":           {},
+	} {
+		q, _ := url.ParseQuery(query)
+		p, err := parsePage(q)
+		if err != nil {
+			t.Fatalf("%s: %v", query, err)
+		}
+		w := httptest.NewRecorder()
+		got := pageOf(w, p, items)
+		if len(got) != len(want) || (len(got) > 0 && got[0] != want[0]) {
+			t.Errorf("%q: got %v, want %v", query, got, want)
+		}
+		if w.Header().Get("X-Total-Count") != "5" {
+			t.Errorf("%q: X-Total-Count %q", query, w.Header().Get("X-Total-Count"))
+		}
+	}
+	for _, query := range []string{"limit=-1", "offset=x"} {
+		q, _ := url.ParseQuery(query)
+		if _, err := parsePage(q); err == nil {
+			t.Errorf("%q accepted", query)
+		}
+	}
+}
+
+func TestWriteTraceback(t *testing.T) {
+	var b bytes.Buffer
+	writeTraceback(&b, []GoroutineStack{{
+		G: proc.G{Goid: 7, Status: "waiting", WaitReason: "chan receive", CreatedBy: "main.main", ParentGoid: 1},
+		Frames: []proc.StackFrame{
+			{Function: "runtime.gopark", File: "proc.go", Line: 10},
+			{Function: "main.worker", File: "main.go", Line: 20},
+		},
+	}})
+	want := "goroutine 7 [chan receive]:\nruntime.gopark(...)\n\tproc.go:10\nmain.worker(...)\n\tmain.go:20\ncreated by main.main in goroutine 1\n\n"
+	if b.String() != want {
+		t.Errorf("got:\n%s\nwant:\n%s", b.String(), want)
+	}
+}
+
+// stackReader serves fixed goroutines whose stacks are their FuncName
+type stackReader struct {
+	proc.ProcessMemReader
+	pid        int
+	goroutines []proc.G
+}
+
+func (r *stackReader) Pid() int                     { return r.pid }
+func (r *stackReader) Frozen(fn func() error) error { return fn() }
+func (r *stackReader) RuntimeInfo() (*proc.Runtime, error) {
+	return &proc.Runtime{GoVersion: "go1.23.4"}, nil
+}
+func (r *stackReader) MemStat() (*proc.MemStat, error)   { return &proc.MemStat{}, nil }
+func (r *stackReader) Goroutines(bool) ([]proc.G, error) { return r.goroutines, nil }
+func (r *stackReader) StackTrace(g proc.G) ([]proc.StackFrame, error) {
+	return []proc.StackFrame{{Function: g.FuncName, File: "main.go", Line: 10}}, nil
+}
+
+// partialReader fails part of its memory stats, like a torn read of the GC controller
+type partialReader struct{ stackReader }
+
+func (r *partialReader) MemStat() (*proc.MemStat, error) {
+	return &proc.MemStat{NumGC: 3}, errors.New("failed to read gcController")
+}
+
+func TestAggregatePartialMemStat(t *testing.T) {
+	worker := proc.G{Status: "waiting", WaitReason: "chan receive", FuncName: "main.worker"}
+	readers := []proc.ProcessMemReader{&partialReader{stackReader{pid: 1, goroutines: []proc.G{worker}}}}
+	report := proc.AggregateStacks(readers, false)
+	if pr := report.Processes[0]; pr.Error != "" || pr.MemStat == nil || pr.MemStat.NumGC != 3 || pr.Goroutines != 1 {
+		t.Errorf("process with partial memstats: %+v", pr)
+	}
+	if len(report.Stacks) != 1 {
+		t.Errorf("got %d stacks, want 1", len(report.Stacks))
+	}
+}
+
+func TestAggregateStacks(t *testing.T) {
+	worker := proc.G{Status: "waiting", WaitReason: "chan receive", FuncName: "main.worker"}
+	readers := []proc.ProcessMemReader{
+		&stackReader{pid: 1, goroutines: []proc.G{worker, worker, {Status: "running", FuncName: "main.main"}}},
+		&stackReader{pid: 2, goroutines: []proc.G{worker, {Status: "waiting", WaitReason: "select", FuncName: "main.worker"}}},
+	}
+	report := proc.AggregateStacks(readers, false)
+	if len(report.Processes) != 2 || report.Processes[0].Goroutines != 3 || report.Processes[1].Goroutines != 2 {
+		t.Fatalf("processes: %+v", report.Processes)
+	}
+	if len(report.Stacks) != 3 {
+		t.Fatalf("got %d stacks, want 3: %+v", len(report.Stacks), report.Stacks)
+	}
+
+	var b bytes.Buffer
+	writeStackReport(&b, report)
+	want := "3 goroutines [chan receive] 1:2 2:1\nmain.worker(...)\n\tmain.go:10\n\n"
+	if !strings.HasPrefix(b.String(), want) {
+		t.Errorf("got:\n%s\nwant prefix:\n%s", b.String(), want)
+	}
+	for _, state := range []string{"1 goroutines [running] 1:1\nmain.main", "1 goroutines [select] 2:1\nmain.worker"} {
+		if !strings.Contains(b.String(), state) {
+			t.Errorf("missing %q in:\n%s", state, b.String())
+		}
+	}
+}
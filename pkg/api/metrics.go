@@ -0,0 +1,398 @@
+package api
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/monsterxx03/gospy/pkg/proc"
+)
+
+// otherLabel collects the series dropped by a cardinality limit
+const otherLabel = "other"
+
+// gcPauseBuckets are the upper bounds of gospy_gc_pause_seconds, in seconds
+var gcPauseBuckets = []float64{10e-6, 50e-6, 100e-6, 250e-6, 500e-6, 1e-3, 2.5e-3, 5e-3, 10e-3, 25e-3, 50e-3, 100e-3}
+
+// MetricsLimits caps the label values exported per process, the least
+// frequent values are summed into a single "other" series. Zero means no limit.
+type MetricsLimits struct {
+	StartFuncs  int // gospy_goroutines_by_start_func function labels
+	WaitReasons int // gospy_goroutines_by_wait_reason wait_reason labels
+}
+
+// DefaultMetricsLimits keeps a scrape of a large server in the hundreds of series
+var DefaultMetricsLimits = MetricsLimits{StartFuncs: 50, WaitReasons: 0}
+
+// pauseHistogram accumulates GC pauses across scrapes. The runtime only keeps
+// the last 256 pauses, pauses that fell out of the ring between two scrapes
+// are counted in gospy_gc_count_total but not here.
+type pauseHistogram struct {
+	lastEnd uint64   // PauseEnd of the newest pause already counted
+	counts  []uint64 // per bucket, not cumulative, last one is +Inf
+	count   uint64
+	sum     float64
+}
+
+func newPauseHistogram() *pauseHistogram {
+	return &pauseHistogram{counts: make([]uint64, len(gcPauseBuckets)+1)}
+}
+
+// update adds the pauses that ended after the last update
+func (h *pauseHistogram) update(ms *proc.MemStat) {
+	n := min(int(ms.NumGC), len(ms.PauseNs))
+	newest := h.lastEnd
+	// walk the ring from the most recent pause back
+	for i := 0; i < n; i++ {
+		idx := (int(ms.NumGC) - 1 - i + len(ms.PauseNs)) % len(ms.PauseNs)
+		end := ms.PauseEnd[idx]
+		if end <= h.lastEnd {
+			break
+		}
+		newest = max(newest, end)
+		seconds := float64(ms.PauseNs[idx]) / 1e9
+		h.counts[sort.SearchFloat64s(gcPauseBuckets, seconds)]++
+		h.count++
+		h.sum += seconds
+	}
+	h.lastEnd = newest
+}
+
+// metricsExporter renders processes in the Prometheus text format and keeps
+// the state histograms need between scrapes
+type metricsExporter struct {
+	limits MetricsLimits
+
+	mu     sync.Mutex
+	pauses map[int]*pauseHistogram // by pid
+}
+
+func newMetricsExporter(limits MetricsLimits) *metricsExporter {
+	return &metricsExporter{limits: limits, pauses: make(map[int]*pauseHistogram)}
+}
+
+// processMetrics is everything read from one target for a scrape
+type processMetrics struct {
+	pid        int
+	rt         *proc.Runtime
+	goroutines []proc.G
+	ps         []proc.P
+	ms         *proc.MemStat
+	pauses     *pauseHistogram
+}
+
+// collect reads a target, failed targets are exported as gospy_up 0
+func (e *metricsExporter) collect(reader proc.ProcessMemReader, showDead bool) (*processMetrics, error) {
+	pm := &processMetrics{pid: reader.Pid()}
+	err := reader.Frozen(func() error {
+		var err error
+		if pm.rt, err = reader.RuntimeInfo(); err != nil {
+			return fmt.Errorf("failed to get runtime info: %w", err)
+		}
+		if pm.goroutines, err = reader.Goroutines(showDead); err != nil {
+			return fmt.Errorf("failed to get goroutines: %w", err)
+		}
+		if pm.ps, err = reader.Ps(); err != nil {
+			return fmt.Errorf("failed to get processor info: %w", err)
+		}
+		// partial memory stats are still worth exporting
+		if pm.ms, _ = reader.MemStat(); pm.ms == nil {
+			return fmt.Errorf("failed to get memory stats")
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	h, ok := e.pauses[pm.pid]
+	if !ok {
+		h = newPauseHistogram()
+		e.pauses[pm.pid] = h
+	}
+	h.update(pm.ms)
+	// copy so rendering doesn't race with a concurrent scrape
+	cp := *h
+	cp.counts = append([]uint64(nil), h.counts...)
+	pm.pauses = &cp
+	return pm, nil
+}
+
+// forget drops the state of a process that went away, a new process reusing
+// the pid must not inherit its histogram
+func (e *metricsExporter) forget(pid int) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	delete(e.pauses, pid)
+}
+
+// metricsWriter buffers samples by family, the text format requires all
+// samples of a family in one group but processes are rendered one by one
+type metricsWriter struct {
+	families []*metricFamily // in order of first use
+	byName   map[string]*metricFamily
+	current  *metricFamily
+}
+
+type metricFamily struct {
+	name, typ, help string
+	samples         strings.Builder
+}
+
+func newMetricsWriter() *metricsWriter {
+	return &metricsWriter{byName: make(map[string]*metricFamily)}
+}
+
+// family selects the family following samples belong to
+func (mw *metricsWriter) family(name, typ, help string) {
+	f, ok := mw.byName[name]
+	if !ok {
+		f = &metricFamily{name: name, typ: typ, help: help}
+		mw.byName[name] = f
+		mw.families = append(mw.families, f)
+	}
+	mw.current = f
+}
+
+func (mw *metricsWriter) sample(name string, value float64, labels ...string) {
+	b := &mw.current.samples
+	b.WriteString(name)
+	if len(labels) > 0 {
+		b.WriteByte('{')
+		for i := 0; i < len(labels); i += 2 {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			fmt.Fprintf(b, "%s=\"%s\"", labels[i], escapeLabel(labels[i+1]))
+		}
+		b.WriteByte('}')
+	}
+	fmt.Fprintf(b, " %g\n", value)
+}
+
+func (mw *metricsWriter) writeTo(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	for _, f := range mw.families {
+		fmt.Fprintf(bw, "# HELP %s %s\n# TYPE %s %s\n", f.name, f.help, f.name, f.typ)
+		bw.WriteString(f.samples.String())
+	}
+	return bw.Flush()
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabel(v string) string {
+	return labelEscaper.Replace(v)
+}
+
+// topCounts returns counts sorted by value, keeping limit entries and summing
+// the rest into otherLabel
+func topCounts(counts map[string]int, limit int) ([]string, map[string]int) {
+	keys := make([]string, 0, len(counts))
+	for k := range counts {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if counts[keys[i]] != counts[keys[j]] {
+			return counts[keys[i]] > counts[keys[j]]
+		}
+		return keys[i] < keys[j]
+	})
+	if limit <= 0 || len(keys) <= limit {
+		return keys, counts
+	}
+	limited := make(map[string]int, limit+1)
+	for _, k := range keys[:limit] {
+		limited[k] = counts[k]
+	}
+	for _, k := range keys[limit:] {
+		limited[otherLabel] += counts[k]
+	}
+	return append(keys[:limit:limit], otherLabel), limited
+}
+
+// writeMetrics renders one scrape. up lists every target, including the ones
+// that couldn't be read.
+func (e *metricsExporter) writeMetrics(w io.Writer, up map[int]bool, procs []*processMetrics) error {
+	mw := newMetricsWriter()
+
+	pids := make([]int, 0, len(up))
+	for pid := range up {
+		pids = append(pids, pid)
+	}
+	sort.Ints(pids)
+	mw.family("gospy_up", "gauge", "Whether the last read of the target succeeded.")
+	for _, pid := range pids {
+		v := 0.0
+		if up[pid] {
+			v = 1
+		}
+		mw.sample("gospy_up", v, "pid", fmt.Sprint(pid))
+	}
+
+	for _, pm := range procs {
+		e.writeProcess(mw, pm)
+	}
+	return mw.writeTo(w)
+}
+
+func (e *metricsExporter) writeProcess(mw *metricsWriter, pm *processMetrics) {
+	pid := fmt.Sprint(pm.pid)
+
+	mw.family("gospy_build_info", "gauge", "Go version and main module of the target, always 1.")
+	module := ""
+	if pm.rt.BuildInfo != nil {
+		module = pm.rt.BuildInfo.Main.Path
+	}
+	mw.sample("gospy_build_info", 1, "pid", pid, "go_version", pm.rt.GoVersion, "module", module)
+
+	// unknown for cores, whose capture time isn't recorded
+	if uptime := pm.rt.Uptime(); uptime > 0 {
+		mw.family("gospy_uptime_seconds", "gauge", "Time since the Go runtime was initialized.")
+		mw.sample("gospy_uptime_seconds", uptime.Seconds(), "pid", pid)
+	}
+
+	mw.family("gospy_gomaxprocs", "gauge", "Effective GOMAXPROCS.")
+	mw.sample("gospy_gomaxprocs", float64(pm.rt.GOMAXPROCS), "pid", pid)
+
+	byStatus := make(map[string]int)
+	byReason := make(map[string]int)
+	byFunc := make(map[string]int)
+	for _, g := range pm.goroutines {
+		byStatus[g.Status]++
+		if g.WaitReason != "" {
+			byReason[g.WaitReason]++
+		}
+		byFunc[g.StartFuncName]++
+	}
+
+	mw.family("gospy_goroutines", "gauge", "Number of goroutines by status.")
+	keys, _ := topCounts(byStatus, 0)
+	for _, status := range keys {
+		mw.sample("gospy_goroutines", float64(byStatus[status]), "pid", pid, "status", status)
+	}
+
+	mw.family("gospy_goroutines_by_wait_reason", "gauge", "Number of waiting goroutines by wait reason.")
+	keys, limited := topCounts(byReason, e.limits.WaitReasons)
+	for _, reason := range keys {
+		mw.sample("gospy_goroutines_by_wait_reason", float64(limited[reason]), "pid", pid, "wait_reason", reason)
+	}
+
+	mw.family("gospy_goroutines_by_start_func", "gauge", "Number of goroutines by the function they were started with.")
+	keys, limited = topCounts(byFunc, e.limits.StartFuncs)
+	for _, fn := range keys {
+		mw.sample("gospy_goroutines_by_start_func", float64(limited[fn]), "pid", pid, "function", fn)
+	}
+
+	pStatus := make(map[string]int)
+	for _, p := range pm.ps {
+		pStatus[p.Status]++
+	}
+	mw.family("gospy_processors", "gauge", "Number of Ps by status.")
+	keys, _ = topCounts(pStatus, 0)
+	for _, status := range keys {
+		mw.sample("gospy_processors", float64(pStatus[status]), "pid", pid, "status", status)
+	}
+
+	ms := pm.ms
+	mw.family("gospy_gc_count_total", "counter", "Number of completed GC cycles.")
+	mw.sample("gospy_gc_count_total", float64(ms.NumGC), "pid", pid)
+	mw.family("gospy_gc_pause_total_seconds", "counter", "Cumulative stop-the-world GC pause time.")
+	mw.sample("gospy_gc_pause_total_seconds", float64(ms.PauseTotalNs)/1e9, "pid", pid)
+	if ms.LastGC != 0 {
+		mw.family("gospy_gc_last_timestamp_seconds", "gauge", "Unix time the last GC finished.")
+		mw.sample("gospy_gc_last_timestamp_seconds", float64(ms.LastGC)/1e9, "pid", pid)
+	}
+
+	mw.family("gospy_gc_pause_seconds", "histogram", "GC pauses seen by gospy since it started scraping the target.")
+	var cumulative uint64
+	for i, bound := range gcPauseBuckets {
+		cumulative += pm.pauses.counts[i]
+		mw.sample("gospy_gc_pause_seconds_bucket", float64(cumulative), "pid", pid, "le", fmt.Sprint(bound))
+	}
+	mw.sample("gospy_gc_pause_seconds_bucket", float64(pm.pauses.count), "pid", pid, "le", "+Inf")
+	mw.sample("gospy_gc_pause_seconds_sum", pm.pauses.sum, "pid", pid)
+	mw.sample("gospy_gc_pause_seconds_count", float64(pm.pauses.count), "pid", pid)
+
+	// zero means the runtime doesn't have the field, don't export a fake value
+	for _, m := range []struct {
+		name, typ, help string
+		value           uint64
+	}{
+		{"gospy_heap_live_bytes", "gauge", "Bytes in live or unswept heap objects.", ms.HeapLive},
+		{"gospy_heap_marked_bytes", "gauge", "Bytes marked live by the last GC.", ms.HeapMarked},
+		{"gospy_heap_goal_bytes", "gauge", "Heap size the next GC is triggered for.", ms.HeapGoal},
+		{"gospy_heap_inuse_bytes", "gauge", "Bytes in in-use heap spans.", ms.HeapInuse},
+		{"gospy_heap_free_bytes", "gauge", "Bytes in free heap spans not returned to the OS.", ms.HeapFree},
+		{"gospy_heap_released_bytes", "gauge", "Heap bytes returned to the OS.", ms.HeapReleased},
+		{"gospy_heap_alloc_bytes_total", "counter", "Cumulative bytes allocated on the heap.", ms.TotalAlloc},
+		{"gospy_heap_freed_bytes_total", "counter", "Cumulative heap bytes freed.", ms.TotalFree},
+	} {
+		if m.value == 0 {
+			continue
+		}
+		mw.family(m.name, m.typ, m.help)
+		mw.sample(m.name, float64(m.value), "pid", pid)
+	}
+}
+
+// SetMetricsLimits sets the label cardinality limits of /metrics
+func (s *Server) SetMetricsLimits(limits MetricsLimits) {
+	s.metrics = newMetricsExporter(limits)
+}
+
+// SetMetricsTargets sets the processes /metrics exports when the request
+// doesn't select any. resolve is called on every scrape so restarted
+// processes are picked up.
+func (s *Server) SetMetricsTargets(resolve func() ([]int, error)) {
+	s.metricsTargets = resolve
+}
+
+// handleMetrics exports the processes selected with pid=1,2,3 or name=<executable name>
+func (s *Server) handleMetrics(w http.ResponseWriter, r *http.Request) {
+	var (
+		pids []int
+		err  error
+	)
+	if s.metricsTargets != nil && r.URL.Query().Get("pid") == "" && r.URL.Query().Get("name") == "" {
+		if pids, err = s.metricsTargets(); err == nil {
+			pids = s.allowedPids(pids)
+		}
+	} else {
+		pids, err = s.getPIDs(r)
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	up := make(map[int]bool, len(pids))
+	var procs []*processMetrics
+	for _, pid := range pids {
+		up[pid] = false
+		reader, err := s.getReader("", pid)
+		if err != nil {
+			continue
+		}
+		pm, err := s.metrics.collect(reader, s.showDead)
+		if err != nil {
+			// the process most likely exited, reopen it on the next scrape
+			s.closeReader(pid)
+			s.metrics.forget(pid)
+			continue
+		}
+		up[pid] = true
+		procs = append(procs, pm)
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	if err := s.metrics.writeMetrics(w, up, procs); err != nil {
+		http.Error(w, fmt.Sprintf("failed to write metrics: %v", err), http.StatusInternalServerError)
+	}
+}
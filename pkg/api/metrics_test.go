@@ -0,0 +1,88 @@
+package api
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/monsterxx03/gospy/pkg/proc"
+)
+
+func TestPauseHistogram(t *testing.T) {
+	ms := &proc.MemStat{}
+	// 300 GCs wrapped the 256 entry ring, pause i lasted i µs and ended at i+1
+	for i := uint64(0); i < 300; i++ {
+		ms.PauseNs[i%256] = i * 1000
+		ms.PauseEnd[i%256] = i + 1
+	}
+	ms.NumGC = 300
+
+	h := newPauseHistogram()
+	h.update(ms)
+	if h.count != 256 || h.lastEnd != 300 {
+		t.Fatalf("first update: count %d, lastEnd %d, want 256, 300", h.count, h.lastEnd)
+	}
+
+	// nothing new
+	h.update(ms)
+	if h.count != 256 {
+		t.Fatalf("repeated update counted again: %d", h.count)
+	}
+
+	// two more GCs, only they are added
+	for i := uint64(300); i < 302; i++ {
+		ms.PauseNs[i%256] = 2_000_000
+		ms.PauseEnd[i%256] = i + 1
+	}
+	ms.NumGC = 302
+	h.update(ms)
+	if h.count != 258 {
+		t.Fatalf("count %d, want 258", h.count)
+	}
+	// 2ms falls in the 2.5ms bucket
+	if got := h.counts[6]; got != 2 {
+		t.Errorf("2.5ms bucket has %d pauses, want 2", got)
+	}
+}
+
+func TestTopCounts(t *testing.T) {
+	counts := map[string]int{"a": 5, "b": 3, "c": 3, "d": 1}
+	keys, limited := topCounts(counts, 2)
+	if strings.Join(keys, ",") != "a,b,other" {
+		t.Errorf("keys %v", keys)
+	}
+	if limited["a"] != 5 || limited["b"] != 3 || limited[otherLabel] != 4 {
+		t.Errorf("limited %v", limited)
+	}
+
+	keys, _ = topCounts(counts, 0)
+	if len(keys) != 4 {
+		t.Errorf("no limit kept %d keys, want 4", len(keys))
+	}
+}
+
+func TestMetricsWriterGroupsFamilies(t *testing.T) {
+	mw := newMetricsWriter()
+	for _, pid := range []string{"1", "2"} {
+		mw.family("gospy_a", "gauge", "A.")
+		mw.sample("gospy_a", 1, "pid", pid)
+		mw.family("gospy_b", "gauge", "B.")
+		mw.sample("gospy_b", 2, "pid", pid, "function", `main.f "x"`)
+	}
+	var buf bytes.Buffer
+	if err := mw.writeTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	want := `# HELP gospy_a A.
+# TYPE gospy_a gauge
+gospy_a{pid="1"} 1
+gospy_a{pid="2"} 1
+# HELP gospy_b B.
+# TYPE gospy_b gauge
+gospy_b{pid="1",function="main.f \"x\""} 2
+gospy_b{pid="2",function="main.f \"x\""} 2
+`
+	if buf.String() != want {
+		t.Errorf("got\n%s\nwant\n%s", buf.String(), want)
+	}
+}
@@ -0,0 +1,390 @@
+package api
+
+import (
+	"net/http"
+	"reflect"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/monsterxx03/gospy/pkg/proc"
+)
+
+// The OpenAPI document is generated from the response types, so it can't
+// drift from what the handlers encode. Operations are listed by hand below,
+// /mcp is left out as it speaks MCP rather than REST.
+
+const openAPIVersion = "3.0.3"
+
+// apiParam is a query or path parameter of an operation
+type apiParam struct {
+	name, in, typ, desc string
+	required            bool
+}
+
+// apiOperation describes the GET operation of one route
+type apiOperation struct {
+	summary string
+	params  []apiParam
+	// response is the JSON body type, or the type of the messages of a stream
+	response reflect.Type
+	// contentType and bodyDesc describe a body that isn't plain JSON
+	contentType, bodyDesc string
+	paged                 bool // takes offset and limit, reports X-Total-Count
+	text                  bool // format=text returns text/plain instead
+}
+
+var (
+	pidParam     = apiParam{name: "pid", in: "query", typ: "integer", desc: "target process id", required: true}
+	pidsParam    = apiParam{name: "pid", in: "query", typ: "string", desc: "comma separated process ids, or use name"}
+	sourceParam  = apiParam{name: "source", in: "query", typ: "string", desc: "core:<path> or snapshot:<path> added with gospy serve --core/--snapshot, the live process if unset"}
+	nameParam    = apiParam{name: "name", in: "query", typ: "string", desc: "executable name of the target processes"}
+	filterParams = []apiParam{
+		{name: "status", in: "query", typ: "string", desc: "comma separated goroutine statuses"},
+		{name: "wait_reason", in: "query", typ: "string", desc: "comma separated wait reasons"},
+		{name: "func", in: "query", typ: "string", desc: "regexp matched against the current and the start function"},
+		{name: "min_wait", in: "query", typ: "string", desc: "minimum wait duration, e.g. 1m"},
+	}
+	pageParams = []apiParam{
+		{name: "offset", in: "query", typ: "integer", desc: "number of items to skip"},
+		{name: "limit", in: "query", typ: "integer", desc: "maximum number of items, all if unset"},
+	}
+)
+
+func typeOf[T any]() reflect.Type {
+	return reflect.TypeOf((*T)(nil)).Elem()
+}
+
+// openAPIOperations documents every route of Server.routes
+var openAPIOperations = map[string]apiOperation{
+	"/runtime": {
+		summary:  "Runtime info: Go version, build info, command line, environment (values redacted unless served with --expose-env) and GODEBUG settings",
+		params:   []apiParam{pidParam, sourceParam},
+		response: typeOf[proc.Runtime](),
+	},
+	"/goroutines": {
+		summary:  "Goroutines ordered by goid",
+		params:   append([]apiParam{pidParam, sourceParam}, filterParams...),
+		response: typeOf[[]proc.G](),
+		paged:    true,
+	},
+	"/goroutines/{goid}": {
+		summary: "One goroutine with its stack",
+		params: []apiParam{
+			pidParam, sourceParam,
+			{name: "goid", in: "path", typ: "integer", desc: "goroutine id", required: true},
+		},
+		response: typeOf[GoroutineStack](),
+	},
+	"/stack": {
+		summary: "Stack of one goroutine",
+		params: []apiParam{
+			pidParam, sourceParam,
+			{name: "goid", in: "query", typ: "integer", desc: "goroutine id", required: true},
+		},
+		response: typeOf[[]proc.StackFrame](),
+	},
+	"/dump": {
+		summary: "All goroutines with their stacks",
+		params: append([]apiParam{pidParam, sourceParam,
+			{name: "format", in: "query", typ: "string", desc: "json (default) or text, the layout of a Go traceback"},
+		}, filterParams...),
+		response: typeOf[[]GoroutineStack](),
+		paged:    true,
+		text:     true,
+	},
+	"/groups": {
+		summary: "Goroutine counts by a key, largest first",
+		params: append([]apiParam{pidParam, sourceParam,
+			{name: "by", in: "query", typ: "string", desc: "start_func (default), wait_reason, status or creator"},
+		}, filterParams...),
+		response: typeOf[[]GroupCount](),
+		paged:    true,
+	},
+	"/processors": {
+		summary:  "Processors (P)",
+		params:   []apiParam{pidParam, sourceParam},
+		response: typeOf[[]proc.P](),
+	},
+	"/threads": {
+		summary:  "The goroutine each thread (M) is running, with its stack",
+		params:   []apiParam{pidParam, sourceParam},
+		response: typeOf[[]proc.ThreadSample](),
+	},
+	"/ps": {
+		summary:  "Go processes on the host",
+		response: typeOf[[]proc.GoProcess](),
+	},
+	"/memstats": {
+		summary:  "Memory and GC statistics",
+		params:   []apiParam{pidParam, sourceParam},
+		response: typeOf[proc.MemStat](),
+	},
+	"/aggregate": {
+		summary:  "Merged report of several processes",
+		params:   []apiParam{pidsParam, nameParam, sourceParam},
+		response: typeOf[proc.AggregateReport](),
+	},
+	"/aggregate/dump": {
+		summary: "Goroutines of several processes merged by state and stack, largest first",
+		params: []apiParam{pidsParam, nameParam, sourceParam,
+			{name: "format", in: "query", typ: "string", desc: "json (default) or text, one block per stack headed by pid:count"},
+		},
+		response: typeOf[proc.StackReport](),
+		text:     true,
+	},
+	"/metrics": {
+		summary:     "Prometheus metrics",
+		params:      []apiParam{pidsParam, nameParam},
+		contentType: "text/plain; version=0.0.4",
+		bodyDesc:    "Prometheus text exposition format",
+	},
+	"/stream": {
+		summary: "Periodic snapshots and deltas, as Server-Sent Events or WebSocket text messages on upgrade",
+		params: []apiParam{pidParam, sourceParam,
+			{name: "interval", in: "query", typ: "string", desc: "a duration or a number of seconds, default 1s"},
+		},
+		contentType: "text/event-stream",
+		bodyDesc:    "events whose data is a StreamEvent",
+		response:    typeOf[StreamEvent](),
+	},
+	"/debug/pprof/goroutine": {
+		summary:     "Goroutine profile for go tool pprof",
+		params:      []apiParam{pidParam, sourceParam},
+		contentType: "application/octet-stream",
+		bodyDesc:    "gzipped pprof protobuf",
+	},
+	"/openapi.json": {
+		summary:     "This document",
+		contentType: "application/json",
+		bodyDesc:    "OpenAPI 3 document",
+	},
+}
+
+var (
+	openAPIOnce sync.Once
+	openAPIDoc  map[string]any
+)
+
+func (s *Server) handleOpenAPI(w http.ResponseWriter, r *http.Request) {
+	openAPIOnce.Do(func() { openAPIDoc = OpenAPI() })
+	writeJSON(w, openAPIDoc)
+}
+
+// OpenAPI returns the OpenAPI 3 document of the server's endpoints
+func OpenAPI() map[string]any {
+	g := &schemaGen{schemas: make(map[string]any)}
+	// the main types are published even if no endpoint returned them directly
+	for _, t := range []reflect.Type{typeOf[proc.G](), typeOf[proc.P](), typeOf[proc.MemStat](), typeOf[proc.Runtime]()} {
+		g.schema(t)
+	}
+
+	paths := make(map[string]any)
+	for path, op := range openAPIOperations {
+		params := make([]any, 0, len(op.params)+2)
+		all := op.params
+		if op.paged {
+			all = append(append([]apiParam(nil), all...), pageParams...)
+		}
+		for _, p := range all {
+			params = append(params, map[string]any{
+				"name":        p.name,
+				"in":          p.in,
+				"description": p.desc,
+				"required":    p.required,
+				"schema":      map[string]any{"type": p.typ},
+			})
+		}
+
+		ok := map[string]any{"description": "OK"}
+		switch {
+		case op.contentType != "":
+			body := map[string]any{"type": "string"}
+			if op.response != nil {
+				body = g.schema(op.response)
+			}
+			if op.contentType == "application/octet-stream" {
+				body["format"] = "binary"
+			}
+			ok["description"] = op.bodyDesc
+			ok["content"] = map[string]any{op.contentType: map[string]any{"schema": body}}
+		case op.response != nil:
+			content := map[string]any{"application/json": map[string]any{"schema": g.schema(op.response)}}
+			if op.text {
+				content["text/plain"] = map[string]any{"schema": map[string]any{"type": "string"}}
+			}
+			ok["content"] = content
+		}
+		if op.paged {
+			ok["headers"] = map[string]any{
+				"X-Total-Count": map[string]any{
+					"description": "number of items before offset and limit were applied",
+					"schema":      map[string]any{"type": "integer"},
+				},
+			}
+		}
+		errResp := func(desc string) map[string]any {
+			return map[string]any{
+				"description": desc,
+				"content":     map[string]any{"text/plain": map[string]any{"schema": map[string]any{"type": "string"}}},
+			}
+		}
+		responses := map[string]any{
+			"200": ok,
+			"401": errResp("missing or invalid bearer token, if the server requires one"),
+		}
+		if len(op.params) > 0 {
+			responses["400"] = errResp("invalid parameters")
+		}
+		if slices.ContainsFunc(op.params, func(p apiParam) bool { return p.name == "pid" }) && path != "/metrics" {
+			responses["403"] = errResp("the server's allowlist doesn't permit reading the process")
+		}
+		if strings.Contains(path, "{goid}") || path == "/stack" {
+			responses["404"] = errResp("goroutine not found, or no such pid in source")
+		} else if slices.Contains(op.params, sourceParam) {
+			responses["404"] = errResp("no such pid in source")
+		}
+		if path != "/openapi.json" {
+			responses["500"] = errResp("the target couldn't be read")
+		}
+		paths[path] = map[string]any{
+			"get": map[string]any{
+				"summary":     op.summary,
+				"operationId": operationID(path),
+				"parameters":  params,
+				"responses":   responses,
+			},
+		}
+	}
+
+	return map[string]any{
+		"openapi": openAPIVersion,
+		"info": map[string]any{
+			"title":       "gospy API",
+			"description": "Inspect the runtime state of running Go processes",
+			"version":     "1.0.0",
+		},
+		"paths": paths,
+		"components": map[string]any{
+			"schemas": g.schemas,
+			"securitySchemes": map[string]any{
+				"bearerAuth": map[string]any{"type": "http", "scheme": "bearer"},
+			},
+		},
+		// servers started without --token-file don't require a token
+		"security": []any{map[string]any{"bearerAuth": []any{}}, map[string]any{}},
+	}
+}
+
+// operationID turns /debug/pprof/goroutine into debugPprofGoroutine
+func operationID(path string) string {
+	var b strings.Builder
+	upper := false
+	for _, c := range strings.Trim(path, "/") {
+		switch {
+		case c == '/' || c == '.' || c == '{' || c == '}':
+			upper = b.Len() > 0
+		case upper:
+			b.WriteString(strings.ToUpper(string(c)))
+			upper = false
+		default:
+			b.WriteRune(c)
+		}
+	}
+	return b.String()
+}
+
+// schemaGen builds JSON schemas of Go types as encoding/json marshals them,
+// named structs become shared components
+type schemaGen struct {
+	schemas map[string]any
+}
+
+var (
+	timeType     = typeOf[time.Time]()
+	durationType = typeOf[time.Duration]()
+)
+
+func (g *schemaGen) schema(t reflect.Type) map[string]any {
+	switch t {
+	case timeType:
+		return map[string]any{"type": "string", "format": "date-time"}
+	case durationType:
+		return map[string]any{"type": "integer", "format": "int64", "description": "nanoseconds"}
+	}
+	switch t.Kind() {
+	case reflect.Pointer:
+		s := g.schema(t.Elem())
+		if _, ref := s["$ref"]; !ref {
+			s["nullable"] = true
+		}
+		return s
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int64, reflect.Uint, reflect.Uint64, reflect.Uintptr:
+		return map[string]any{"type": "integer", "format": "int64"}
+	case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return map[string]any{"type": "integer", "format": "int32"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return map[string]any{"type": "string", "format": "byte"}
+		}
+		return map[string]any{"type": "array", "items": g.schema(t.Elem())}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": g.schema(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return g.object(t)
+		}
+		if _, ok := g.schemas[t.Name()]; !ok {
+			g.schemas[t.Name()] = nil // recursive types refer to themselves
+			g.schemas[t.Name()] = g.object(t)
+		}
+		return map[string]any{"$ref": "#/components/schemas/" + t.Name()}
+	}
+	return map[string]any{}
+}
+
+// object is the schema of a struct's exported fields, embedded structs inlined
+func (g *schemaGen) object(t reflect.Type) map[string]any {
+	props := make(map[string]any)
+	var required []string
+	var add func(t reflect.Type)
+	add = func(t reflect.Type) {
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			tag := f.Tag.Get("json")
+			if tag == "-" {
+				continue
+			}
+			name, opts, _ := strings.Cut(tag, ",")
+			if f.Anonymous && name == "" && f.Type.Kind() == reflect.Struct {
+				add(f.Type)
+				continue
+			}
+			if !f.IsExported() {
+				continue
+			}
+			if name == "" {
+				name = f.Name
+			}
+			props[name] = g.schema(f.Type)
+			if !strings.Contains(opts, "omitempty") {
+				required = append(required, name)
+			}
+		}
+	}
+	add(t)
+	s := map[string]any{"type": "object", "properties": props}
+	if len(required) > 0 {
+		sort.Strings(required)
+		s["required"] = required
+	}
+	return s
+}
@@ -0,0 +1,72 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestOpenAPICoversRoutes(t *testing.T) {
+	s := NewServer(0, false, false)
+	for pattern := range s.routes() {
+		if _, ok := openAPIOperations[pattern]; !ok {
+			t.Errorf("route %s is not documented", pattern)
+		}
+	}
+	for path := range openAPIOperations {
+		if _, ok := s.routes()[path]; !ok {
+			t.Errorf("documented path %s has no route", path)
+		}
+	}
+}
+
+func TestOpenAPISchemas(t *testing.T) {
+	w := httptest.NewRecorder()
+	NewServer(0, false, false).handleOpenAPI(w, httptest.NewRequest("GET", "/openapi.json", nil))
+	var doc struct {
+		OpenAPI    string `json:"openapi"`
+		Components struct {
+			Schemas map[string]struct {
+				Properties map[string]json.RawMessage `json:"properties"`
+			} `json:"schemas"`
+		} `json:"components"`
+	}
+	body := w.Body.String()
+	if err := json.Unmarshal([]byte(body), &doc); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(doc.OpenAPI, "3.") {
+		t.Errorf("openapi version %q", doc.OpenAPI)
+	}
+
+	for name, fields := range map[string][]string{
+		"G":              {"go_id", "status", "wait_reason", "stack", "start_func_name", "parent_goid"},
+		"P":              {"id", "status"},
+		"MemStat":        {"num_gc", "heap_live", "total_alloc"},
+		"Runtime":        {"go_version", "gomaxprocs", "build_info"},
+		"GoroutineStack": {"go_id", "frames", "wait_seconds"}, // proc.G is inlined
+	} {
+		schema, ok := doc.Components.Schemas[name]
+		if !ok {
+			t.Errorf("schema %s is missing", name)
+			continue
+		}
+		for _, f := range fields {
+			if _, ok := schema.Properties[f]; !ok {
+				t.Errorf("schema %s has no property %s", name, f)
+			}
+		}
+	}
+	if _, ok := doc.Components.Schemas["G"].Properties["M"]; ok {
+		t.Error(`fields tagged json:"-" must be left out`)
+	}
+
+	// every reference resolves
+	for _, ref := range strings.Split(body, `"$ref":"#/components/schemas/`)[1:] {
+		name := ref[:strings.IndexByte(ref, '"')]
+		if _, ok := doc.Components.Schemas[name]; !ok {
+			t.Errorf("dangling reference to %s", name)
+		}
+	}
+}
@@ -4,33 +4,57 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"io"
+	"net"
 	"net/http"
-	"os/exec"
+	"regexp"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/mark3labs/mcp-go/mcp"
 	"github.com/mark3labs/mcp-go/server"
+	"github.com/monsterxx03/gospy/pkg/pprof"
 	"github.com/monsterxx03/gospy/pkg/proc"
 )
 
+// readerKey identifies a cached reader. Live processes have no source, cores
+// and snapshots are registered under one (e.g. "core:/tmp/core.1234") so they
+// can't shadow a live process that has the same pid.
+type readerKey struct {
+	source string
+	pid    int
+}
+
 type Server struct {
 	port     int
-	readers  map[int]proc.ProcessMemReader // pid -> reader cache
+	readers  map[readerKey]proc.ProcessMemReader
 	mu       sync.RWMutex
 	showDead bool
 
 	enableMCP bool
 	mcpServer *server.StreamableHTTPServer
+
+	metrics        *metricsExporter
+	metricsTargets func() ([]int, error) // default /metrics targets, nil to require pid or name
+
+	allow  *proc.Allowlist // live processes the server may read, nil for all
+	tokens [][]byte        // accepted bearer tokens, none to not require one
+
+	origins []string // cross-origin pages allowed to open a WebSocket, see originAllowed
+
+	exposeEnv bool // serve environment values, redacted by default
 }
 
 func NewServer(port int, showDead bool, enableMCP bool) *Server {
 	s := &Server{
 		port:      port,
-		readers:   make(map[int]proc.ProcessMemReader),
+		readers:   make(map[readerKey]proc.ProcessMemReader),
 		showDead:  showDead,
 		enableMCP: enableMCP,
+		metrics:   newMetricsExporter(DefaultMetricsLimits),
 	}
 	if enableMCP {
 		s.mcpServer = s.getMCPServer()
@@ -45,10 +69,12 @@ func (s *Server) getMCPServer() *server.StreamableHTTPServer {
 	)
 	goroutineTool := mcp.NewTool("goroutines",
 		mcp.WithDescription("dump golang process's goroutines"),
-		mcp.WithNumber("pid", mcp.Required(), mcp.Description("process pid")))
+		mcp.WithNumber("pid", mcp.Required(), mcp.Description("process pid")),
+		mcp.WithString("source", mcp.Description("core:<path> or snapshot:<path> served by gospy serve, the live process if unset")))
 	ms.AddTool(goroutineTool, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
 		pid := int(request.GetArguments()["pid"].(float64))
-		reader, err := s.getReader(pid)
+		source, _ := request.GetArguments()["source"].(string)
+		reader, err := s.getReader(source, pid)
 		if err != nil {
 			return nil, err
 		}
@@ -65,10 +91,12 @@ func (s *Server) getMCPServer() *server.StreamableHTTPServer {
 
 	memstatsTool := mcp.NewTool("gomemstats",
 		mcp.WithDescription("dump golang process's memory statistics"),
-		mcp.WithNumber("pid", mcp.Required(), mcp.Description("process pid")))
+		mcp.WithNumber("pid", mcp.Required(), mcp.Description("process pid")),
+		mcp.WithString("source", mcp.Description("core:<path> or snapshot:<path> served by gospy serve, the live process if unset")))
 	ms.AddTool(memstatsTool, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
 		pid := int(request.GetArguments()["pid"].(float64))
-		reader, err := s.getReader(pid)
+		source, _ := request.GetArguments()["source"].(string)
+		reader, err := s.getReader(source, pid)
 		if err != nil {
 			return nil, err
 		}
@@ -85,14 +113,16 @@ func (s *Server) getMCPServer() *server.StreamableHTTPServer {
 
 	runtimeTool := mcp.NewTool("goruntime",
 		mcp.WithDescription("get golang process's runtime info"),
-		mcp.WithNumber("pid", mcp.Required(), mcp.Description("process pid")))
+		mcp.WithNumber("pid", mcp.Required(), mcp.Description("process pid")),
+		mcp.WithString("source", mcp.Description("core:<path> or snapshot:<path> served by gospy serve, the live process if unset")))
 	ms.AddTool(runtimeTool, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
 		pid := int(request.GetArguments()["pid"].(float64))
-		reader, err := s.getReader(pid)
+		source, _ := request.GetArguments()["source"].(string)
+		reader, err := s.getReader(source, pid)
 		if err != nil {
 			return nil, err
 		}
-		runtimeInfo, err := reader.RuntimeInfo()
+		runtimeInfo, err := s.runtimeInfo(reader)
 		if err != nil {
 			return nil, fmt.Errorf("failed to get runtime info: %w", err)
 		}
@@ -104,17 +134,24 @@ func (s *Server) getMCPServer() *server.StreamableHTTPServer {
 	})
 
 	pgrepTool := mcp.NewTool("pgrep",
-		mcp.WithDescription("find process IDs by process name"),
-		mcp.WithString("name", mcp.Required(), mcp.Description("process name to search for")))
+		mcp.WithDescription("find running Go processes whose name or command line matches a pattern, with pid, Go version, module and uptime"),
+		mcp.WithString("name", mcp.Required(), mcp.Description("regular expression matched against the process name and command line")))
 	ms.AddTool(pgrepTool, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
-		name := request.GetArguments()["name"].(string)
-		cmd := exec.Command("pgrep", name)
-		output, err := cmd.Output()
+		re, err := regexp.Compile(request.GetArguments()["name"].(string))
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern: %w", err)
+		}
+		procs, err := s.goProcesses()
 		if err != nil {
-			return nil, fmt.Errorf("pgrep failed: %w", err)
+			return nil, fmt.Errorf("failed to list processes: %w", err)
+		}
+		matched := make([]proc.GoProcess, 0, len(procs))
+		for _, p := range procs {
+			if re.MatchString(p.Name) || re.MatchString(p.Command) {
+				matched = append(matched, p)
+			}
 		}
-		pids := strings.Split(strings.TrimSpace(string(output)), "\n")
-		data, err := json.Marshal(pids)
+		data, err := json.Marshal(matched)
 		if err != nil {
 			return nil, err
 		}
@@ -124,13 +161,30 @@ func (s *Server) getMCPServer() *server.StreamableHTTPServer {
 	return server.NewStreamableHTTPServer(ms)
 }
 
-func (s *Server) getReader(pid int) (proc.ProcessMemReader, error) {
+// getReader returns the reader of pid from source, a live process if source is
+// empty. Readers of live processes are opened on first use.
+func (s *Server) getReader(source string, pid int) (proc.ProcessMemReader, error) {
+	key := readerKey{source: source, pid: pid}
 	s.mu.RLock()
-	if reader, ok := s.readers[pid]; ok {
-		s.mu.RUnlock()
+	reader, ok := s.readers[key]
+	s.mu.RUnlock()
+	if source != "" {
+		// registered with AddReader, not a live process so the allowlist doesn't apply
+		if !ok {
+			return nil, fmt.Errorf("%w: no pid %d in %s", errUnknownSource, pid, source)
+		}
+		return reader, nil
+	}
+	// checked on every request, the pid may belong to another process by now
+	if err := s.checkPid(pid); err != nil {
+		if ok {
+			s.closeReader(pid)
+		}
+		return nil, err
+	}
+	if ok {
 		return reader, nil
 	}
-	s.mu.RUnlock()
 
 	reader, err := proc.NewProcessMemReader(pid, "")
 	if err != nil {
@@ -138,30 +192,80 @@ func (s *Server) getReader(pid int) (proc.ProcessMemReader, error) {
 	}
 
 	s.mu.Lock()
-	s.readers[pid] = reader
+	s.readers[key] = reader
 	s.mu.Unlock()
 
 	return reader, nil
 }
 
+// AddReader registers a pre-opened reader under source, e.g. "core:<path>" for a
+// core file. Requests select it with source=<source> along with its pid.
+func (s *Server) AddReader(source string, reader proc.ProcessMemReader) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.readers[readerKey{source: source, pid: reader.Pid()}] = reader
+}
+
+// closeReader drops the reader of a live process, e.g. after it exited
 func (s *Server) closeReader(pid int) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	if reader, ok := s.readers[pid]; ok {
+	key := readerKey{pid: pid}
+	if reader, ok := s.readers[key]; ok {
 		reader.Close()
-		delete(s.readers, pid)
+		delete(s.readers, key)
 	}
 }
 
-func (s *Server) Start() error {
-	http.HandleFunc("/runtime", s.handleRuntime)
-	http.HandleFunc("/goroutines", s.handleGoroutines)
-	http.HandleFunc("/memstats", s.handleMemStats)
+// routes maps every endpoint pattern to its handler, see also openAPIOperations
+func (s *Server) routes() map[string]http.HandlerFunc {
+	return map[string]http.HandlerFunc{
+		"/runtime":               s.handleRuntime,
+		"/goroutines":            s.handleGoroutines,
+		"/goroutines/{goid}":     s.handleGoroutine,
+		"/stack":                 s.handleStack,
+		"/dump":                  s.handleDump,
+		"/groups":                s.handleGroups,
+		"/processors":            s.handleProcessors,
+		"/threads":               s.handleThreads,
+		"/ps":                    s.handlePs,
+		"/memstats":              s.handleMemStats,
+		"/aggregate":             s.handleAggregate,
+		"/aggregate/dump":        s.handleAggregateDump,
+		"/metrics":               s.handleMetrics,
+		"/stream":                s.handleStream,
+		"/debug/pprof/goroutine": s.handlePprofGoroutine,
+		"/openapi.json":          s.handleOpenAPI,
+	}
+}
+
+// Handler returns the server's endpoints, for embedding them or testing
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	for pattern, handler := range s.routes() {
+		mux.HandleFunc(pattern, handler)
+	}
 	if s.enableMCP {
-		http.Handle("/mcp", s.mcpServer)
+		mux.Handle("/mcp", s.mcpServer)
+	}
+	return s.withAuth(mux)
+}
+
+// Start listens on the port on the loopback interface, use Serve for other listeners
+func (s *Server) Start() error {
+	l, err := net.Listen("tcp", fmt.Sprintf("127.0.0.1:%d", s.port))
+	if err != nil {
+		return err
 	}
-	return http.ListenAndServe(fmt.Sprintf(":%d", s.port), nil)
+	return s.Serve(l)
+}
+
+// Serve answers requests on l, e.g. a unix socket or a TLS listener, which
+// also authenticates clients if it requires client certificates
+func (s *Server) Serve(l net.Listener) error {
+	srv := &http.Server{Handler: s.Handler(), ReadHeaderTimeout: 10 * time.Second}
+	return srv.Serve(l)
 }
 
 func (s *Server) handleRuntime(w http.ResponseWriter, r *http.Request) {
@@ -171,13 +275,13 @@ func (s *Server) handleRuntime(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	reader, err := s.getReader(pid)
+	reader, err := s.getReader(getSource(r), pid)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("failed to get reader: %v", err), http.StatusInternalServerError)
+		http.Error(w, fmt.Sprintf("failed to get reader: %v", err), readerErrorStatus(err))
 		return
 	}
 
-	rt, err := reader.RuntimeInfo()
+	rt, err := s.runtimeInfo(reader)
 	if err != nil {
 		http.Error(w, fmt.Sprintf("failed to get runtime info: %v", err), http.StatusInternalServerError)
 		return
@@ -186,16 +290,41 @@ func (s *Server) handleRuntime(w http.ResponseWriter, r *http.Request) {
 	writeJSON(w, rt)
 }
 
+// runtimeInfo is reader.RuntimeInfo with the environment values redacted,
+// unless they were exposed with SetExposeEnv
+func (s *Server) runtimeInfo(reader proc.ProcessMemReader) (*proc.Runtime, error) {
+	rt, err := reader.RuntimeInfo()
+	if err != nil {
+		return nil, err
+	}
+	if !s.exposeEnv {
+		rt.RedactEnv()
+	}
+	return rt, nil
+}
+
+// handleGoroutines lists goroutines by goid, see goroutineFilter and parsePage
+// for the query parameters
 func (s *Server) handleGoroutines(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseGoroutineFilter(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	pg, err := parsePage(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 	pid, err := getPID(r)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	reader, err := s.getReader(pid)
+	reader, err := s.getReader(getSource(r), pid)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("failed to create reader: %v", err), http.StatusInternalServerError)
+		http.Error(w, fmt.Sprintf("failed to create reader: %v", err), readerErrorStatus(err))
 		return
 	}
 	goroutines, err := reader.Goroutines(s.showDead)
@@ -203,8 +332,12 @@ func (s *Server) handleGoroutines(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, fmt.Sprintf("failed to get goroutines: %v", err), http.StatusInternalServerError)
 		return
 	}
+	if err := filter.checkClock(goroutines); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 
-	writeJSON(w, goroutines)
+	writeJSON(w, pageOf(w, pg, filter.apply(goroutines)))
 }
 
 func (s *Server) handleMemStats(w http.ResponseWriter, r *http.Request) {
@@ -214,9 +347,9 @@ func (s *Server) handleMemStats(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	reader, err := s.getReader(pid)
+	reader, err := s.getReader(getSource(r), pid)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("failed to create reader: %v", err), http.StatusInternalServerError)
+		http.Error(w, fmt.Sprintf("failed to create reader: %v", err), readerErrorStatus(err))
 		return
 	}
 
@@ -229,6 +362,132 @@ func (s *Server) handleMemStats(w http.ResponseWriter, r *http.Request) {
 	writeJSON(w, memStats)
 }
 
+// handlePprofGoroutine serves a goroutine profile in the format of
+// net/http/pprof, so go tool pprof can fetch it directly
+func (s *Server) handlePprofGoroutine(w http.ResponseWriter, r *http.Request) {
+	pid, err := getPID(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	reader, err := s.getReader(getSource(r), pid)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to create reader: %v", err), readerErrorStatus(err))
+		return
+	}
+
+	profile, err := pprof.GoroutineProfile(reader, s.showDead)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to build goroutine profile: %v", err), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Disposition", `attachment; filename="goroutine"`)
+	profile.Write(w)
+}
+
+// handleAggregate merges several processes, selected with pid=1,2,3 or name=<executable name>
+func (s *Server) handleAggregate(w http.ResponseWriter, r *http.Request) {
+	readers, ok := s.readersFor(w, r)
+	if !ok {
+		return
+	}
+	writeJSON(w, proc.Aggregate(readers, s.showDead))
+}
+
+// handleAggregateDump merges the goroutine dumps of several processes by
+// state and stack, as JSON or with format=text like a debug=1 goroutine profile
+func (s *Server) handleAggregateDump(w http.ResponseWriter, r *http.Request) {
+	format := r.URL.Query().Get("format")
+	if format != "" && format != "json" && format != "text" {
+		http.Error(w, fmt.Sprintf("unknown format %q, want json or text", format), http.StatusBadRequest)
+		return
+	}
+	readers, ok := s.readersFor(w, r)
+	if !ok {
+		return
+	}
+	report := proc.AggregateStacks(readers, s.showDead)
+	if format == "text" {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		writeStackReport(w, report)
+		return
+	}
+	writeJSON(w, report)
+}
+
+// writeStackReport writes one block per stack, headed by its count in every process
+func writeStackReport(w io.Writer, report *proc.StackReport) {
+	for _, p := range report.Processes {
+		if p.Error != "" {
+			fmt.Fprintf(w, "# pid %d: %s\n", p.PID, p.Error)
+		}
+	}
+	for _, group := range report.Stacks {
+		pids := make([]int, 0, len(group.PerPID))
+		for pid := range group.PerPID {
+			pids = append(pids, pid)
+		}
+		sort.Ints(pids)
+		fmt.Fprintf(w, "%d goroutines [%s]", group.Total, group.State)
+		for _, pid := range pids {
+			fmt.Fprintf(w, " %d:%d", pid, group.PerPID[pid])
+		}
+		fmt.Fprintln(w)
+		for _, f := range group.Frames {
+			fmt.Fprintf(w, "%s(...)\n\t%s:%d\n", f.Function, f.File, f.Line)
+		}
+		fmt.Fprintln(w)
+	}
+}
+
+// readersFor returns the readers of the processes selected with pid or name,
+// it writes the error response and returns false on failure
+func (s *Server) readersFor(w http.ResponseWriter, r *http.Request) ([]proc.ProcessMemReader, bool) {
+	pids, err := s.getPIDs(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return nil, false
+	}
+
+	readers := make([]proc.ProcessMemReader, 0, len(pids))
+	for _, pid := range pids {
+		reader, err := s.getReader(getSource(r), pid)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("failed to create reader for pid %d: %v", pid, err), readerErrorStatus(err))
+			return nil, false
+		}
+		readers = append(readers, reader)
+	}
+	return readers, true
+}
+
+// getPIDs returns the pids selected by the pid or name parameter, the
+// processes the server may not read don't match a name
+func (s *Server) getPIDs(r *http.Request) ([]int, error) {
+	if name := r.URL.Query().Get("name"); name != "" {
+		pids, err := proc.FindGoProcessPids(name, nil)
+		if err != nil {
+			return nil, err
+		}
+		return s.allowedPids(pids), nil
+	}
+	pidStr := r.URL.Query().Get("pid")
+	if pidStr == "" {
+		return nil, fmt.Errorf("pid or name parameter is required")
+	}
+	var pids []int
+	for _, field := range strings.Split(pidStr, ",") {
+		pid, err := strconv.Atoi(strings.TrimSpace(field))
+		if err != nil {
+			return nil, fmt.Errorf("invalid pid %q", field)
+		}
+		pids = append(pids, pid)
+	}
+	return pids, nil
+}
+
 func getPID(r *http.Request) (int, error) {
 	pidStr := r.URL.Query().Get("pid")
 	if pidStr == "" {
@@ -237,6 +496,11 @@ func getPID(r *http.Request) (int, error) {
 	return strconv.Atoi(pidStr)
 }
 
+// getSource returns the source parameter, empty for live processes
+func getSource(r *http.Request) string {
+	return r.URL.Query().Get("source")
+}
+
 func writeJSON(w http.ResponseWriter, data interface{}) {
 	w.Header().Set("Content-Type", "application/json")
 	if err := json.NewEncoder(w).Encode(data); err != nil {
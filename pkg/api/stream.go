@@ -0,0 +1,277 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/monsterxx03/gospy/pkg/proc"
+)
+
+const (
+	defaultStreamInterval = time.Second
+	// minStreamInterval keeps a client from making the server read the target in a tight loop
+	minStreamInterval = 100 * time.Millisecond
+)
+
+// Stream event types
+const (
+	StreamSnapshot = "snapshot" // first event, includes the runtime info
+	StreamTick     = "tick"     // later events, with deltas since the previous one
+	StreamError    = "error"    // the target couldn't be read, the stream ends
+)
+
+// StreamEvent is one message of /stream
+type StreamEvent struct {
+	Type          string         `json:"type"`
+	Seq           int64          `json:"seq"`
+	Time          time.Time      `json:"time"`
+	PID           int            `json:"pid"`
+	Error         string         `json:"error,omitempty"`
+	Runtime       *proc.Runtime  `json:"runtime,omitempty"`        // snapshot only, it rarely changes
+	UptimeSeconds float64        `json:"uptime_seconds,omitempty"` // unknown for cores
+	GOMAXPROCS    int32          `json:"gomaxprocs"`
+	MemStat       *proc.MemStat  `json:"memstats,omitempty"`
+	Goroutines    int            `json:"goroutines"`
+	ByStatus      map[string]int `json:"by_status,omitempty"`
+	ByWaitReason  map[string]int `json:"by_wait_reason,omitempty"`
+	ByStartFunc   map[string]int `json:"by_start_func,omitempty"`
+	Delta         *StreamDelta   `json:"delta,omitempty"` // nil on the snapshot
+}
+
+// StreamDelta is what changed since the previous event
+type StreamDelta struct {
+	Seconds    float64 `json:"seconds"`     // since the previous event
+	Goroutines int     `json:"goroutines"`  // change of the goroutine count
+	Started    int     `json:"started"`     // goroutine ids not seen before
+	Exited     int     `json:"exited"`      // goroutine ids that are gone
+	NumGC      uint32  `json:"num_gc"`      // GC cycles completed
+	PauseNs    uint64  `json:"pause_ns"`    // GC pause time added
+	AllocBytes uint64  `json:"alloc_bytes"` // heap bytes allocated
+	HeapLive   int64   `json:"heap_live"`   // change of live heap bytes
+	// start functions whose goroutine count changed, by how much
+	StartFuncs map[string]int `json:"start_funcs,omitempty"`
+}
+
+// streamSample is one read of the target
+type streamSample struct {
+	time       time.Time
+	rt         *proc.Runtime
+	ms         *proc.MemStat
+	goroutines []proc.G
+}
+
+// streamState remembers the previous sample of a stream to compute deltas
+type streamState struct {
+	seq         int64
+	time        time.Time
+	goids       map[int64]bool
+	byStartFunc map[string]int
+	ms          *proc.MemStat
+}
+
+// next turns a sample into the next event of the stream
+func (st *streamState) next(pid int, smp streamSample) *StreamEvent {
+	st.seq++
+	ev := &StreamEvent{
+		Type:          StreamTick,
+		Seq:           st.seq,
+		Time:          smp.time,
+		PID:           pid,
+		UptimeSeconds: smp.rt.Uptime().Seconds(),
+		GOMAXPROCS:    smp.rt.GOMAXPROCS,
+		MemStat:       smp.ms,
+		Goroutines:    len(smp.goroutines),
+		ByStatus:      make(map[string]int),
+		ByWaitReason:  make(map[string]int),
+		ByStartFunc:   make(map[string]int),
+	}
+	goids := make(map[int64]bool, len(smp.goroutines))
+	for _, g := range smp.goroutines {
+		goids[g.Goid] = true
+		ev.ByStatus[g.Status]++
+		if g.WaitReason != "" {
+			ev.ByWaitReason[g.WaitReason]++
+		}
+		fn := g.StartFuncName
+		if fn == "" {
+			fn = "unknown"
+		}
+		ev.ByStartFunc[fn]++
+	}
+
+	if st.goids == nil {
+		ev.Type = StreamSnapshot
+		ev.Runtime = smp.rt
+	} else {
+		d := &StreamDelta{
+			Seconds:    smp.time.Sub(st.time).Seconds(),
+			Goroutines: len(goids) - len(st.goids),
+			StartFuncs: make(map[string]int),
+		}
+		for goid := range goids {
+			if !st.goids[goid] {
+				d.Started++
+			}
+		}
+		for goid := range st.goids {
+			if !goids[goid] {
+				d.Exited++
+			}
+		}
+		for fn, n := range ev.ByStartFunc {
+			if diff := n - st.byStartFunc[fn]; diff != 0 {
+				d.StartFuncs[fn] = diff
+			}
+		}
+		for fn, n := range st.byStartFunc {
+			if _, ok := ev.ByStartFunc[fn]; !ok {
+				d.StartFuncs[fn] = -n
+			}
+		}
+		// counters only go down if the pid was reused by a new process
+		if st.ms != nil && smp.ms != nil && smp.ms.NumGC >= st.ms.NumGC {
+			d.NumGC = smp.ms.NumGC - st.ms.NumGC
+			d.PauseNs = smp.ms.PauseTotalNs - st.ms.PauseTotalNs
+			if smp.ms.TotalAlloc >= st.ms.TotalAlloc {
+				d.AllocBytes = smp.ms.TotalAlloc - st.ms.TotalAlloc
+			}
+			d.HeapLive = int64(smp.ms.HeapLive) - int64(st.ms.HeapLive)
+		}
+		ev.Delta = d
+	}
+
+	st.time = smp.time
+	st.goids = goids
+	st.byStartFunc = ev.ByStartFunc
+	st.ms = smp.ms
+	return ev
+}
+
+func (s *Server) readStreamSample(reader proc.ProcessMemReader) (streamSample, error) {
+	smp := streamSample{time: time.Now()}
+	err := reader.Frozen(func() error {
+		var err error
+		if smp.rt, err = s.runtimeInfo(reader); err != nil {
+			return fmt.Errorf("failed to get runtime info: %w", err)
+		}
+		if smp.goroutines, err = reader.Goroutines(s.showDead); err != nil {
+			return fmt.Errorf("failed to get goroutines: %w", err)
+		}
+		// partial memory stats are still worth sending
+		if smp.ms, _ = reader.MemStat(); smp.ms == nil {
+			return fmt.Errorf("failed to get memory stats")
+		}
+		return nil
+	})
+	return smp, err
+}
+
+// handleStream pushes an event every interval, as Server-Sent Events or, if
+// the client asks for an upgrade, as WebSocket text messages
+func (s *Server) handleStream(w http.ResponseWriter, r *http.Request) {
+	pid, err := getPID(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	interval, err := getInterval(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	reader, err := s.getReader(getSource(r), pid)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("failed to create reader: %v", err), readerErrorStatus(err))
+		return
+	}
+
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+	var send func(ev *StreamEvent) error
+	if isWebSocketUpgrade(r) {
+		ws, err := upgradeWebSocket(w, r, s.origins)
+		if err != nil {
+			return // the response was written by upgradeWebSocket
+		}
+		defer ws.Close()
+		go func() {
+			// a hijacked connection doesn't cancel the request context
+			<-ws.done
+			cancel()
+		}()
+		send = func(ev *StreamEvent) error {
+			data, err := json.Marshal(ev)
+			if err != nil {
+				return err
+			}
+			return ws.WriteText(data)
+		}
+	} else {
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			http.Error(w, "streaming is not supported by the connection", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("X-Accel-Buffering", "no") // nginx would buffer the stream
+		send = func(ev *StreamEvent) error {
+			data, err := json.Marshal(ev)
+			if err != nil {
+				return err
+			}
+			if _, err := fmt.Fprintf(w, "event: %s\nid: %d\ndata: %s\n\n", ev.Type, ev.Seq, data); err != nil {
+				return err
+			}
+			flusher.Flush()
+			return nil
+		}
+	}
+
+	var state streamState
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		smp, err := s.readStreamSample(reader)
+		if err != nil {
+			send(&StreamEvent{Type: StreamError, Seq: state.seq + 1, Time: time.Now(), PID: pid, Error: err.Error()})
+			// the process most likely exited, reopen it on the next request
+			if getSource(r) == "" {
+				s.closeReader(pid)
+			}
+			return
+		}
+		if err := send(state.next(pid, smp)); err != nil {
+			return // client went away
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// getInterval parses interval=1s, a Go duration or a number of seconds
+func getInterval(r *http.Request) (time.Duration, error) {
+	s := r.URL.Query().Get("interval")
+	if s == "" {
+		return defaultStreamInterval, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		secs, ferr := strconv.ParseFloat(s, 64)
+		if ferr != nil {
+			return 0, fmt.Errorf("invalid interval %q", s)
+		}
+		d = time.Duration(secs * float64(time.Second))
+	}
+	if d < minStreamInterval {
+		return 0, fmt.Errorf("interval must be at least %s", minStreamInterval)
+	}
+	return d, nil
+}
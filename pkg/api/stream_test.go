@@ -0,0 +1,189 @@
+package api
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/monsterxx03/gospy/pkg/proc"
+)
+
+func TestStreamStateDeltas(t *testing.T) {
+	t0 := time.Unix(1000, 0)
+	rt := &proc.Runtime{GOMAXPROCS: 4}
+	var st streamState
+
+	first := st.next(42, streamSample{
+		time: t0,
+		rt:   rt,
+		ms:   &proc.MemStat{NumGC: 10, PauseTotalNs: 1000, TotalAlloc: 5000, HeapLive: 300},
+		goroutines: []proc.G{
+			{Goid: 1, Status: "running", StartFuncName: "main.main"},
+			{Goid: 2, Status: "waiting", WaitReason: "chan receive", StartFuncName: "main.worker"},
+			{Goid: 3, Status: "waiting", WaitReason: "chan receive", StartFuncName: "main.worker"},
+		},
+	})
+	if first.Type != StreamSnapshot || first.Runtime != rt || first.Delta != nil || first.Seq != 1 {
+		t.Fatalf("first event: %+v", first)
+	}
+	if first.ByStartFunc["main.worker"] != 2 || first.ByWaitReason["chan receive"] != 2 || first.ByStatus["running"] != 1 {
+		t.Errorf("first event groups: %+v %+v %+v", first.ByStartFunc, first.ByWaitReason, first.ByStatus)
+	}
+
+	second := st.next(42, streamSample{
+		time: t0.Add(2 * time.Second),
+		rt:   rt,
+		ms:   &proc.MemStat{NumGC: 12, PauseTotalNs: 1500, TotalAlloc: 9000, HeapLive: 200},
+		goroutines: []proc.G{
+			{Goid: 1, Status: "running", StartFuncName: "main.main"},
+			{Goid: 3, Status: "waiting", WaitReason: "chan receive", StartFuncName: "main.worker"},
+			{Goid: 4, Status: "waiting", WaitReason: "IO wait", StartFuncName: "net/http.(*conn).serve"},
+			{Goid: 5, Status: "waiting", WaitReason: "IO wait", StartFuncName: "net/http.(*conn).serve"},
+		},
+	})
+	if second.Type != StreamTick || second.Runtime != nil || second.Seq != 2 {
+		t.Fatalf("second event: %+v", second)
+	}
+	d := second.Delta
+	want := StreamDelta{Seconds: 2, Goroutines: 1, Started: 2, Exited: 1, NumGC: 2, PauseNs: 500, AllocBytes: 4000, HeapLive: -100}
+	got := *d
+	got.StartFuncs = nil
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("delta %+v, want %+v", got, want)
+	}
+	if len(d.StartFuncs) != 2 || d.StartFuncs["main.worker"] != -1 || d.StartFuncs["net/http.(*conn).serve"] != 2 {
+		t.Errorf("start func deltas %v", d.StartFuncs)
+	}
+
+	// a new process reusing the pid restarts the counters
+	third := st.next(42, streamSample{time: t0.Add(3 * time.Second), rt: rt, ms: &proc.MemStat{NumGC: 1}})
+	if third.Delta.NumGC != 0 || third.Delta.Exited != 4 || third.Delta.StartFuncs["main.main"] != -1 {
+		t.Errorf("third delta %+v", third.Delta)
+	}
+}
+
+func TestGetInterval(t *testing.T) {
+	for query, want := range map[string]time.Duration{"": time.Second, "250ms": 250 * time.Millisecond, "2": 2 * time.Second, "0.5": 500 * time.Millisecond} {
+		got, err := getInterval(httptest.NewRequest("GET", "/stream?interval="+query, nil))
+		if err != nil || got != want {
+			t.Errorf("interval=%s: got %s, %v, want %s", query, got, err, want)
+		}
+	}
+	for _, query := range []string{"10ms", "0", "soon"} {
+		if _, err := getInterval(httptest.NewRequest("GET", "/stream?interval="+query, nil)); err == nil {
+			t.Errorf("interval=%s accepted", query)
+		}
+	}
+}
+
+func TestWebSocketAccept(t *testing.T) {
+	// the example from RFC 6455 section 1.3
+	if got := websocketAccept("dGhlIHNhbXBsZSBub25jZQ=="); got != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Errorf("got %s", got)
+	}
+}
+
+func TestWebSocketOrigin(t *testing.T) {
+	for _, tc := range []struct {
+		origin  string
+		allowed []string
+		want    bool
+	}{
+		{"", nil, true},
+		{"http://localhost:8974", nil, true},
+		{"http://LOCALHOST:8974", nil, true},
+		{"https://evil.example", nil, false},
+		{"http://localhost:9999", nil, false},
+		{"https://dash.example", []string{"https://dash.example"}, true},
+		{"https://evil.example", []string{"https://dash.example"}, false},
+		{"https://evil.example", []string{"*"}, true},
+	} {
+		r := httptest.NewRequest("GET", "http://localhost:8974/stream?pid=1", nil)
+		if tc.origin != "" {
+			r.Header.Set("Origin", tc.origin)
+		}
+		if got := originAllowed(r, tc.allowed); got != tc.want {
+			t.Errorf("originAllowed(%q, %q) = %v, want %v", tc.origin, tc.allowed, got, tc.want)
+		}
+	}
+}
+
+func TestWebSocketFrames(t *testing.T) {
+	server, client := net.Pipe()
+	defer client.Close()
+	ws := newWSConn(server, bufio.NewReadWriter(bufio.NewReader(server), bufio.NewWriter(server)))
+
+	readFrame := func() (byte, []byte) {
+		t.Helper()
+		var h [2]byte
+		if _, err := io.ReadFull(client, h[:]); err != nil {
+			t.Fatal(err)
+		}
+		if h[0]&0x80 == 0 || h[1]&0x80 != 0 {
+			t.Fatalf("frame must be final and unmasked: %x", h)
+		}
+		n := uint64(h[1] & 0x7f)
+		switch n {
+		case 126:
+			var ext [2]byte
+			io.ReadFull(client, ext[:])
+			n = uint64(binary.BigEndian.Uint16(ext[:]))
+		case 127:
+			var ext [8]byte
+			io.ReadFull(client, ext[:])
+			n = binary.BigEndian.Uint64(ext[:])
+		}
+		payload := make([]byte, n)
+		if _, err := io.ReadFull(client, payload); err != nil {
+			t.Fatal(err)
+		}
+		return h[0] & 0x0f, payload
+	}
+	sendMasked := func(opcode byte, payload []byte) {
+		t.Helper()
+		mask := []byte{1, 2, 3, 4}
+		frame := append([]byte{0x80 | opcode, 0x80 | byte(len(payload))}, mask...)
+		for i, b := range payload {
+			frame = append(frame, b^mask[i%4])
+		}
+		if _, err := client.Write(frame); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, size := range []int{5, 200, 70000} {
+		msg := make([]byte, size)
+		for i := range msg {
+			msg[i] = byte('a' + i%26)
+		}
+		go ws.WriteText(msg)
+		op, payload := readFrame()
+		if op != wsOpText || string(payload) != string(msg) {
+			t.Errorf("%d byte message: opcode %x, got %d bytes", size, op, len(payload))
+		}
+	}
+
+	sendMasked(wsOpPing, []byte("hi"))
+	if op, payload := readFrame(); op != wsOpPong || string(payload) != "hi" {
+		t.Errorf("got opcode %x %q, want pong", op, payload)
+	}
+
+	sendMasked(wsOpClose, []byte{0x03, 0xe8})
+	if op, payload := readFrame(); op != wsOpClose || string(payload) != "\x03\xe8" {
+		t.Errorf("got opcode %x %q, want close 1000", op, payload)
+	}
+	select {
+	case <-ws.done:
+	case <-time.After(time.Second):
+		t.Fatal("read loop didn't stop after close")
+	}
+	if err := ws.WriteText([]byte("late")); err == nil {
+		t.Error("message sent after close")
+	}
+	ws.Close()
+}
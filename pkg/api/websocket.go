@@ -0,0 +1,232 @@
+package api
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// A minimal RFC 6455 server, enough to push text messages: client messages
+// are read and dropped, pings are answered and a close is acknowledged.
+
+const websocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+const (
+	wsOpText  = 0x1
+	wsOpClose = 0x8
+	wsOpPing  = 0x9
+	wsOpPong  = 0xa
+
+	// clients only send small control messages on /stream
+	wsMaxClientPayload = 64 << 10
+	// a client that stops reading must not block its stream forever
+	wsWriteTimeout = 10 * time.Second
+)
+
+type wsConn struct {
+	conn      net.Conn
+	rw        *bufio.ReadWriter
+	mu        sync.Mutex    // serializes writes, the read loop answers pings
+	closeSent bool          // nothing may follow a close frame
+	done      chan struct{} // closed when the client closed or the connection failed
+	once      sync.Once
+}
+
+func isWebSocketUpgrade(r *http.Request) bool {
+	return headerHasToken(r.Header, "Connection", "upgrade") && strings.EqualFold(r.Header.Get("Upgrade"), "websocket")
+}
+
+func headerHasToken(h http.Header, name, token string) bool {
+	for _, v := range h.Values(name) {
+		for _, t := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(t), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func websocketAccept(key string) string {
+	sum := sha1.Sum([]byte(key + websocketGUID))
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// originAllowed reports whether a browser page at the request's Origin may open
+// a WebSocket. Browsers don't apply the same-origin policy to WebSockets, so
+// without this any page the user visits could read the stream. Requests
+// without an Origin don't come from a browser and are allowed.
+func originAllowed(r *http.Request, allowed []string) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" || slices.Contains(allowed, "*") || slices.Contains(allowed, origin) {
+		return true
+	}
+	u, err := url.Parse(origin)
+	return err == nil && strings.EqualFold(u.Host, r.Host)
+}
+
+// upgradeWebSocket completes the handshake, on failure it writes the error
+// response. Cross-origin requests are refused unless their origin is in origins.
+func upgradeWebSocket(w http.ResponseWriter, r *http.Request, origins []string) (*wsConn, error) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "websocket upgrade requires GET", http.StatusMethodNotAllowed)
+		return nil, errors.New("bad method")
+	}
+	if !originAllowed(r, origins) {
+		http.Error(w, "cross-origin websocket upgrade refused", http.StatusForbidden)
+		return nil, errors.New("origin not allowed")
+	}
+	if r.Header.Get("Sec-WebSocket-Version") != "13" {
+		w.Header().Set("Sec-WebSocket-Version", "13")
+		http.Error(w, "unsupported websocket version", http.StatusUpgradeRequired)
+		return nil, errors.New("bad version")
+	}
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if key == "" {
+		http.Error(w, "missing Sec-WebSocket-Key", http.StatusBadRequest)
+		return nil, errors.New("missing key")
+	}
+	hj, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "websocket is not supported by the connection", http.StatusInternalServerError)
+		return nil, errors.New("not hijackable")
+	}
+	conn, rw, err := hj.Hijack()
+	if err != nil {
+		http.Error(w, fmt.Sprintf("websocket upgrade failed: %v", err), http.StatusInternalServerError)
+		return nil, err
+	}
+	fmt.Fprintf(rw, "HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Accept: %s\r\n\r\n", websocketAccept(key))
+	if err := rw.Flush(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return newWSConn(conn, rw), nil
+}
+
+func newWSConn(conn net.Conn, rw *bufio.ReadWriter) *wsConn {
+	c := &wsConn{conn: conn, rw: rw, done: make(chan struct{})}
+	go c.readLoop()
+	return c
+}
+
+// WriteText sends one unfragmented text message
+func (c *wsConn) WriteText(data []byte) error {
+	return c.writeFrame(wsOpText, data)
+}
+
+// writeFrame writes a final frame, server frames are never masked
+func (c *wsConn) writeFrame(opcode byte, payload []byte) error {
+	header := []byte{0x80 | opcode}
+	switch n := len(payload); {
+	case n < 126:
+		header = append(header, byte(n))
+	case n <= 0xffff:
+		header = append(header, 126)
+		header = binary.BigEndian.AppendUint16(header, uint16(n))
+	default:
+		header = append(header, 127)
+		header = binary.BigEndian.AppendUint64(header, uint64(n))
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.closeSent {
+		return net.ErrClosed
+	}
+	c.closeSent = opcode == wsOpClose
+	c.conn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+	if _, err := c.rw.Write(header); err != nil {
+		return err
+	}
+	if _, err := c.rw.Write(payload); err != nil {
+		return err
+	}
+	return c.rw.Flush()
+}
+
+// readLoop handles client frames until the client closes or the connection fails
+func (c *wsConn) readLoop() {
+	defer close(c.done)
+	for {
+		opcode, payload, err := c.readFrame()
+		if err != nil {
+			return
+		}
+		switch opcode {
+		case wsOpClose:
+			// echo the status code, if any, to complete the closing handshake
+			if len(payload) > 2 {
+				payload = payload[:2]
+			}
+			c.writeFrame(wsOpClose, payload)
+			return
+		case wsOpPing:
+			c.writeFrame(wsOpPong, payload)
+		}
+	}
+}
+
+func (c *wsConn) readFrame() (byte, []byte, error) {
+	var h [2]byte
+	if _, err := io.ReadFull(c.rw, h[:]); err != nil {
+		return 0, nil, err
+	}
+	opcode := h[0] & 0x0f
+	n := uint64(h[1] & 0x7f)
+	switch n {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(c.rw, ext[:]); err != nil {
+			return 0, nil, err
+		}
+		n = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(c.rw, ext[:]); err != nil {
+			return 0, nil, err
+		}
+		n = binary.BigEndian.Uint64(ext[:])
+	}
+	if n > wsMaxClientPayload {
+		return 0, nil, fmt.Errorf("client frame of %d bytes is too large", n)
+	}
+	// clients must mask, but there's nothing to protect against on a push-only stream
+	var mask [4]byte
+	masked := h[1]&0x80 != 0
+	if masked {
+		if _, err := io.ReadFull(c.rw, mask[:]); err != nil {
+			return 0, nil, err
+		}
+	}
+	payload := make([]byte, n)
+	if _, err := io.ReadFull(c.rw, payload); err != nil {
+		return 0, nil, err
+	}
+	if masked {
+		for i := range payload {
+			payload[i] ^= mask[i%4]
+		}
+	}
+	return opcode, payload, nil
+}
+
+// Close sends a normal closure and closes the connection
+func (c *wsConn) Close() error {
+	var err error
+	c.once.Do(func() {
+		c.writeFrame(wsOpClose, []byte{0x03, 0xe8}) // 1000
+		err = c.conn.Close()
+	})
+	return err
+}
@@ -2,6 +2,7 @@ package binary
 
 import (
 	"debug/gosym"
+	"encoding/binary"
 	"errors"
 	"fmt"
 )
@@ -12,6 +13,15 @@ var (
 	ErrSymbolNotFound    = errors.New("symbol not found in binary")
 )
 
+// debugDirs are searched for separate debug info files of stripped binaries
+var debugDirs = []string{"/usr/lib/debug"}
+
+// AddDebugDirs registers extra directories to search for separate debug info,
+// they take precedence over the system default /usr/lib/debug
+func AddDebugDirs(dirs ...string) {
+	debugDirs = append(append([]string{}, dirs...), debugDirs...)
+}
+
 // BinaryLoader defines the interface for analyzing Go binaries
 type DWARFLoader interface {
 	// Check if binary has DWARF info
@@ -22,6 +32,8 @@ type DWARFLoader interface {
 	GetNestedOffset(outerType, outerField, innerField string) (uint64, error)
 	// Get size of a struct type
 	GetStructSize(typeName string) (uint64, error)
+	// Get the type name of a global variable
+	GetVariableType(varName string) (string, error)
 }
 
 type BinaryLoader interface {
@@ -31,6 +43,9 @@ type BinaryLoader interface {
 	// LoadByPid initializes the binary analysis by process ID
 	LoadByPid(pid int) error
 
+	// Path returns the file path the binary was loaded from
+	Path() string
+
 	// GetSymbols returns all symbols from the binary
 	GetSymbols() (map[string]uint64, error)
 
@@ -43,10 +58,19 @@ type BinaryLoader interface {
 	// PtrSize returns the pointer size (4 for 32-bit, 8 for 64-bit)
 	PtrSize() int
 
+	// ByteOrder returns the byte order of the target architecture
+	ByteOrder() binary.ByteOrder
+
+	// Arch returns the GOARCH the binary was built for, empty if unknown
+	Arch() string
+
 	PCToFuncLoc(addr uint64) *FuncLoc
 
 	// GetDWARFLoader returns the DWARF loader if available
 	GetDWARFLoader() (DWARFLoader, error)
+
+	// Close releases the executable and any separate debug info file
+	Close() error
 }
 
 type FuncLoc struct {
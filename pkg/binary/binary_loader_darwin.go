@@ -11,6 +11,7 @@ import "C"
 import (
 	"debug/gosym"
 	"debug/macho"
+	"encoding/binary"
 	"errors"
 	"fmt"
 	"os"
@@ -52,6 +53,10 @@ func (d *DarwinBinaryLoader) GetFile() any {
 	return d.file
 }
 
+func (d *DarwinBinaryLoader) Path() string {
+	return d.path
+}
+
 func (d *DarwinBinaryLoader) PtrSize() int {
 	if d.file == nil {
 		// Default to 64-bit pointer size
@@ -65,6 +70,26 @@ func (d *DarwinBinaryLoader) PtrSize() int {
 	return 8
 }
 
+func (d *DarwinBinaryLoader) ByteOrder() binary.ByteOrder {
+	if d.file == nil {
+		return binary.LittleEndian
+	}
+	return d.file.ByteOrder
+}
+
+func (d *DarwinBinaryLoader) Arch() string {
+	if d.file == nil {
+		return ""
+	}
+	switch d.file.Cpu {
+	case macho.CpuAmd64:
+		return "amd64"
+	case macho.CpuArm64:
+		return "arm64"
+	}
+	return ""
+}
+
 func (d *DarwinBinaryLoader) Load(filePath string) error {
 	if _, err := os.Stat(filePath); os.IsNotExist(err) {
 		return ErrBinaryNotFound
@@ -77,6 +102,7 @@ func (d *DarwinBinaryLoader) Load(filePath string) error {
 
 	symtab, err := getGoSymtab(file)
 	if err != nil {
+		file.Close()
 		return fmt.Errorf("%w: %v", ErrInvalidExecutable, err)
 	}
 	d.goSymtab = symtab
@@ -88,6 +114,14 @@ func (d *DarwinBinaryLoader) Load(filePath string) error {
 	return nil
 }
 
+// Close closes the executable
+func (d *DarwinBinaryLoader) Close() error {
+	if d.file == nil {
+		return nil
+	}
+	return d.file.Close()
+}
+
 func (d *DarwinBinaryLoader) GetSymbols() (map[string]uint64, error) {
 	// This will execute the loading function exactly once
 	d.loadOnce.Do(func() {
@@ -5,9 +5,11 @@ package binary
 import (
 	"debug/elf"
 	"debug/gosym"
+	"encoding/binary"
 	"errors"
 	"fmt"
 	"os"
+	"path/filepath"
 	"sync"
 )
 
@@ -16,6 +18,11 @@ type LinuxBinaryLoader struct {
 	path     string
 	goSymtab *gosym.Table
 
+	// separate debug info for stripped binaries, provides symbols and DWARF
+	debugFile *elf.File
+	debugPath string
+	debugErr  error
+
 	// Cache control
 	loadOnce sync.Once // Ensures symbols are loaded only once
 	symbols  map[string]uint64
@@ -28,6 +35,10 @@ func (l *LinuxBinaryLoader) GetFile() any {
 	return l.file
 }
 
+func (l *LinuxBinaryLoader) Path() string {
+	return l.path
+}
+
 func (l *LinuxBinaryLoader) PtrSize() int {
 	if l.file.Class == elf.ELFCLASS64 {
 		return 8
@@ -35,17 +46,66 @@ func (l *LinuxBinaryLoader) PtrSize() int {
 	return 4
 }
 
+func (l *LinuxBinaryLoader) ByteOrder() binary.ByteOrder {
+	return l.file.ByteOrder
+}
+
+func (l *LinuxBinaryLoader) Arch() string {
+	switch l.file.Machine {
+	case elf.EM_X86_64:
+		return "amd64"
+	case elf.EM_386:
+		return "386"
+	case elf.EM_AARCH64:
+		return "arm64"
+	case elf.EM_ARM:
+		return "arm"
+	case elf.EM_PPC64:
+		if l.file.ByteOrder == binary.LittleEndian {
+			return "ppc64le"
+		}
+		return "ppc64"
+	case elf.EM_S390:
+		return "s390x"
+	case elf.EM_RISCV:
+		return "riscv64"
+	}
+	return ""
+}
+
 func NewBinaryLoader() BinaryLoader {
 	return &LinuxBinaryLoader{}
 }
 
 func (l *LinuxBinaryLoader) LoadByPid(pid int) error {
-	exePath := fmt.Sprintf("/proc/%d/exe", pid)
-	targetPath, err := os.Readlink(exePath)
+	path, err := ResolveExePath(pid)
 	if err != nil {
-		return fmt.Errorf("failed to read process exe link: %w", err)
+		return err
 	}
-	return l.Load(targetPath)
+	return l.Load(path)
+}
+
+// ResolveExePath returns a path to the executable of pid that is usable from
+// gospy's mount namespace. For a process in another container /proc/<pid>/exe
+// names a path inside the container, which is reached through
+// /proc/<pid>/root. If neither path is the running file (e.g. it was deleted or
+// replaced) the /proc/<pid>/exe link itself is returned.
+func ResolveExePath(pid int) (string, error) {
+	exeLink := fmt.Sprintf("/proc/%d/exe", pid)
+	target, err := os.Readlink(exeLink)
+	if err != nil {
+		return "", fmt.Errorf("failed to read process exe link: %w", err)
+	}
+	exe, err := os.Stat(exeLink)
+	if err != nil {
+		return "", fmt.Errorf("failed to stat process exe: %w", err)
+	}
+	for _, candidate := range []string{target, filepath.Join(fmt.Sprintf("/proc/%d/root", pid), target)} {
+		if st, err := os.Stat(candidate); err == nil && os.SameFile(st, exe) {
+			return candidate, nil
+		}
+	}
+	return exeLink, nil
 }
 
 func (l *LinuxBinaryLoader) Load(filePath string) error {
@@ -59,6 +119,7 @@ func (l *LinuxBinaryLoader) Load(filePath string) error {
 
 	symtab, err := getGoSymtab(file)
 	if err != nil {
+		file.Close()
 		return fmt.Errorf("%w: %v", ErrInvalidExecutable, err)
 	}
 	l.goSymtab = symtab
@@ -66,13 +127,52 @@ func (l *LinuxBinaryLoader) Load(filePath string) error {
 	l.file = file
 	l.path = filePath
 	l.dwarf = newDwarfLoader(file)
+
+	if needsDebugFile(file) {
+		debugFile, debugPath, err := findDebugFile(file, filePath)
+		if err == nil {
+			l.debugFile = debugFile
+			l.debugPath = debugPath
+			l.dwarf = newDwarfLoader(debugFile)
+		} else {
+			l.debugErr = fmt.Errorf("binary is stripped and no separate debug info found: %w", err)
+		}
+	}
 	return nil
 }
 
+// Close closes the executable and the separate debug info file, if any
+func (l *LinuxBinaryLoader) Close() error {
+	if l.debugFile != nil {
+		l.debugFile.Close()
+	}
+	if l.file == nil {
+		return nil
+	}
+	return l.file.Close()
+}
+
+// DebugFilePath returns the path of the separate debug info file in use, if any
+func (l *LinuxBinaryLoader) DebugFilePath() string {
+	return l.debugPath
+}
+
+// symbolFile returns the ELF file carrying the symbol table
+func (l *LinuxBinaryLoader) symbolFile() *elf.File {
+	if l.debugFile != nil {
+		return l.debugFile
+	}
+	return l.file
+}
+
 func (l *LinuxBinaryLoader) GetSymbols() (map[string]uint64, error) {
 	// This will execute the loading function exactly once
 	l.loadOnce.Do(func() {
-		symtab, err := l.file.Symbols()
+		symtab, err := l.symbolFile().Symbols()
+		if err != nil && l.debugErr != nil {
+			l.loadErr = fmt.Errorf("failed to get symbols: %w (%v)", err, l.debugErr)
+			return
+		}
 		if err != nil {
 			l.loadErr = fmt.Errorf("failed to get symbols: %w", err)
 			return
@@ -134,10 +234,24 @@ func getGoSymtab(f *elf.File) (*gosym.Table, error) {
 	if err != nil {
 		return nil, err
 	}
-	ln := gosym.NewLineTable(data, f.Section(".text").Addr)
+	ln := gosym.NewLineTable(data, textStart(f))
 	symtab, err := gosym.NewTable([]byte{}, ln)
 	if err != nil {
 		return nil, err
 	}
 	return symtab, nil
 }
+
+// textStart returns the address of runtime.text, which Go 1.18+ pclntab
+// offsets are relative to. It follows C code at the start of .text in
+// externally linked binaries and plugins.
+func textStart(f *elf.File) uint64 {
+	if syms, err := f.Symbols(); err == nil {
+		for _, sym := range syms {
+			if sym.Name == "runtime.text" {
+				return sym.Value
+			}
+		}
+	}
+	return f.Section(".text").Addr
+}
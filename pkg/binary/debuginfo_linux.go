@@ -0,0 +1,255 @@
+//go:build linux
+
+package binary
+
+import (
+	"bytes"
+	"debug/elf"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+const (
+	_NT_GNU_BUILD_ID = 3
+	_NT_GO_BUILD_ID  = 4
+)
+
+// GNUBuildID returns the GNU build ID stored in .note.gnu.build-id, or nil if absent
+func GNUBuildID(f *elf.File) []byte {
+	s := f.Section(".note.gnu.build-id")
+	if s == nil || s.Type == elf.SHT_NOBITS {
+		return nil
+	}
+	data, err := s.Data()
+	if err != nil {
+		return nil
+	}
+	desc, err := findNote(data, f.ByteOrder, "GNU", _NT_GNU_BUILD_ID)
+	if err != nil {
+		return nil
+	}
+	return desc
+}
+
+// GoBuildID returns the Go toolchain build ID stored in .note.go.buildid, or "" if absent
+func GoBuildID(f *elf.File) string {
+	s := f.Section(".note.go.buildid")
+	if s == nil || s.Type == elf.SHT_NOBITS {
+		return ""
+	}
+	data, err := s.Data()
+	if err != nil {
+		return ""
+	}
+	desc, err := findNote(data, f.ByteOrder, "Go", _NT_GO_BUILD_ID)
+	if err != nil {
+		return ""
+	}
+	return string(desc)
+}
+
+// HeaderBuildIDs returns the GNU and Go build IDs of an ELF image from its
+// first bytes, e.g. its first page as mapped in memory. Go binaries keep their
+// note segment right after the program headers.
+func HeaderBuildIDs(head []byte) ([]byte, string) {
+	if len(head) < elf.EI_NIDENT || !bytes.HasPrefix(head, []byte(elf.ELFMAG)) {
+		return nil, ""
+	}
+	var order binary.ByteOrder
+	switch elf.Data(head[elf.EI_DATA]) {
+	case elf.ELFDATA2LSB:
+		order = binary.LittleEndian
+	case elf.ELFDATA2MSB:
+		order = binary.BigEndian
+	default:
+		return nil, ""
+	}
+
+	// offset of each PT_NOTE segment
+	var notes []uint64
+	r := bytes.NewReader(head)
+	switch elf.Class(head[elf.EI_CLASS]) {
+	case elf.ELFCLASS64:
+		var hdr elf.Header64
+		if err := binary.Read(r, order, &hdr); err != nil {
+			return nil, ""
+		}
+		for i := 0; i < int(hdr.Phnum); i++ {
+			var prog elf.Prog64
+			off := int64(hdr.Phoff) + int64(i)*int64(hdr.Phentsize)
+			if err := binary.Read(io.NewSectionReader(r, off, int64(hdr.Phentsize)), order, &prog); err != nil {
+				break
+			}
+			if elf.ProgType(prog.Type) == elf.PT_NOTE {
+				notes = append(notes, prog.Off)
+			}
+		}
+	case elf.ELFCLASS32:
+		var hdr elf.Header32
+		if err := binary.Read(r, order, &hdr); err != nil {
+			return nil, ""
+		}
+		for i := 0; i < int(hdr.Phnum); i++ {
+			var prog elf.Prog32
+			off := int64(hdr.Phoff) + int64(i)*int64(hdr.Phentsize)
+			if err := binary.Read(io.NewSectionReader(r, off, int64(hdr.Phentsize)), order, &prog); err != nil {
+				break
+			}
+			if elf.ProgType(prog.Type) == elf.PT_NOTE {
+				notes = append(notes, uint64(prog.Off))
+			}
+		}
+	}
+
+	var gnu []byte
+	var goID string
+	for _, off := range notes {
+		if off >= uint64(len(head)) {
+			continue
+		}
+		// read past the segment: the Go linker's PT_NOTE only covers the Go
+		// build ID, .note.gnu.build-id follows it
+		data := head[off:]
+		if desc, err := findNote(data, order, "GNU", _NT_GNU_BUILD_ID); err == nil {
+			gnu = desc
+		}
+		if desc, err := findNote(data, order, "Go", _NT_GO_BUILD_ID); err == nil {
+			goID = string(desc)
+		}
+	}
+	return gnu, goID
+}
+
+// findNote scans an ELF note section for the note with given owner and type
+func findNote(data []byte, order binary.ByteOrder, owner string, typ uint32) ([]byte, error) {
+	for len(data) >= 12 {
+		namesz := order.Uint32(data[0:4])
+		descsz := order.Uint32(data[4:8])
+		ntype := order.Uint32(data[8:12])
+		data = data[12:]
+
+		nameEnd := alignUp(uint64(namesz), 4)
+		descEnd := nameEnd + alignUp(uint64(descsz), 4)
+		if uint64(len(data)) < nameEnd+uint64(descsz) {
+			break
+		}
+		name := string(bytes.TrimRight(data[:namesz], "\x00"))
+		if name == owner && ntype == typ {
+			return data[nameEnd : nameEnd+uint64(descsz)], nil
+		}
+		if uint64(len(data)) < descEnd {
+			break
+		}
+		data = data[descEnd:]
+	}
+	return nil, fmt.Errorf("note %s/%d not found", owner, typ)
+}
+
+func alignUp(v, align uint64) uint64 {
+	return (v + align - 1) &^ (align - 1)
+}
+
+// debugLink parses .gnu_debuglink, returning the debug file name and its CRC32
+func debugLink(f *elf.File) (string, uint32, bool) {
+	s := f.Section(".gnu_debuglink")
+	if s == nil {
+		return "", 0, false
+	}
+	data, err := s.Data()
+	if err != nil {
+		return "", 0, false
+	}
+	end := bytes.IndexByte(data, 0)
+	if end <= 0 {
+		return "", 0, false
+	}
+	crcOff := alignUp(uint64(end+1), 4)
+	if uint64(len(data)) < crcOff+4 {
+		return "", 0, false
+	}
+	return string(data[:end]), f.ByteOrder.Uint32(data[crcOff:]), true
+}
+
+// needsDebugFile reports whether f lacks the symbol table or DWARF info gospy relies on
+func needsDebugFile(f *elf.File) bool {
+	if s := f.Section(".symtab"); s == nil || s.Type == elf.SHT_NOBITS {
+		return true
+	}
+	if s := f.Section(".debug_info"); s == nil || s.Type == elf.SHT_NOBITS {
+		return f.Section(".zdebug_info") == nil
+	}
+	return false
+}
+
+// findDebugFile looks for separate debug info matching exe, trying in order:
+// <debug-dir>/.build-id/xx/yyyy.debug, then .gnu_debuglink in the exe's directory,
+// its .debug subdirectory and <debug-dir>/<exe dir>. Candidates are only accepted
+// when their build ID (or CRC32 for debuglink without build ID) matches exe.
+func findDebugFile(exe *elf.File, exePath string) (*elf.File, string, error) {
+	buildID := GNUBuildID(exe)
+	if len(buildID) > 1 {
+		id := hex.EncodeToString(buildID)
+		for _, dir := range debugDirs {
+			path := filepath.Join(dir, ".build-id", id[:2], id[2:]+".debug")
+			if f, err := openDebugFile(path, buildID, 0, false); err == nil {
+				return f, path, nil
+			}
+		}
+	}
+
+	name, crc, ok := debugLink(exe)
+	if !ok {
+		return nil, "", errors.New("no build ID match and no .gnu_debuglink section")
+	}
+	exeDir := filepath.Dir(exePath)
+	if resolved, err := filepath.EvalSymlinks(exePath); err == nil {
+		exeDir = filepath.Dir(resolved)
+	}
+	candidates := []string{
+		filepath.Join(exeDir, name),
+		filepath.Join(exeDir, ".debug", name),
+	}
+	for _, dir := range debugDirs {
+		candidates = append(candidates, filepath.Join(dir, exeDir, name))
+	}
+	for _, path := range candidates {
+		if path == exePath {
+			continue
+		}
+		if f, err := openDebugFile(path, buildID, crc, true); err == nil {
+			return f, path, nil
+		}
+	}
+	return nil, "", fmt.Errorf("debug file %q not found or does not match", name)
+}
+
+// openDebugFile opens path and verifies it belongs to the binary identified by buildID/crc
+func openDebugFile(path string, buildID []byte, crc uint32, checkCRC bool) (*elf.File, error) {
+	if len(buildID) == 0 && checkCRC {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		if got := crc32.ChecksumIEEE(data); got != crc {
+			return nil, fmt.Errorf("%s: crc32 mismatch (got %08x, want %08x)", path, got, crc)
+		}
+	}
+
+	f, err := elf.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	if len(buildID) > 0 {
+		if got := GNUBuildID(f); !bytes.Equal(got, buildID) {
+			f.Close()
+			return nil, fmt.Errorf("%s: build ID mismatch (got %x, want %x)", path, got, buildID)
+		}
+	}
+	return f, nil
+}
@@ -0,0 +1,295 @@
+//go:build linux
+
+package binary
+
+import (
+	"bytes"
+	"debug/elf"
+	"encoding/binary"
+	"encoding/hex"
+	"hash/crc32"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+// note encodes one ELF note with 4-byte alignment
+func note(order binary.ByteOrder, owner string, typ uint32, desc []byte) []byte {
+	var b bytes.Buffer
+	name := append([]byte(owner), 0)
+	binary.Write(&b, order, uint32(len(name)))
+	binary.Write(&b, order, uint32(len(desc)))
+	binary.Write(&b, order, typ)
+	b.Write(name)
+	b.Write(make([]byte, alignUp(uint64(len(name)), 4)-uint64(len(name))))
+	b.Write(desc)
+	b.Write(make([]byte, alignUp(uint64(len(desc)), 4)-uint64(len(desc))))
+	return b.Bytes()
+}
+
+func TestFindNote(t *testing.T) {
+	le, be := binary.LittleEndian, binary.BigEndian
+	gnu := note(le, "GNU", _NT_GNU_BUILD_ID, []byte{0xde, 0xad, 0xbe, 0xef, 0x01})
+	goID := note(le, "Go", _NT_GO_BUILD_ID, []byte("abc/def"))
+	tests := []struct {
+		name  string
+		data  []byte
+		order binary.ByteOrder
+		owner string
+		typ   uint32
+		want  []byte // nil if not found
+	}{
+		{"only note", gnu, le, "GNU", _NT_GNU_BUILD_ID, []byte{0xde, 0xad, 0xbe, 0xef, 0x01}},
+		{"after a padded note", append(append([]byte{}, goID...), gnu...), le, "GNU", _NT_GNU_BUILD_ID, []byte{0xde, 0xad, 0xbe, 0xef, 0x01}},
+		{"go build id", append(append([]byte{}, gnu...), goID...), le, "Go", _NT_GO_BUILD_ID, []byte("abc/def")},
+		{"big endian", note(be, "GNU", _NT_GNU_BUILD_ID, []byte{1, 2}), be, "GNU", _NT_GNU_BUILD_ID, []byte{1, 2}},
+		{"wrong type", gnu, le, "GNU", _NT_GO_BUILD_ID, nil},
+		{"wrong owner", gnu, le, "Go", _NT_GNU_BUILD_ID, nil},
+		{"truncated desc", gnu[:len(gnu)-4], le, "GNU", _NT_GNU_BUILD_ID, nil},
+		{"truncated header", gnu[:8], le, "GNU", _NT_GNU_BUILD_ID, nil},
+		{"empty", nil, le, "GNU", _NT_GNU_BUILD_ID, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := findNote(tt.data, tt.order, tt.owner, tt.typ)
+			if tt.want == nil {
+				if err == nil {
+					t.Errorf("found %x, want not found", got)
+				}
+				return
+			}
+			if err != nil || !bytes.Equal(got, tt.want) {
+				t.Errorf("got %x, %v, want %x", got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestHeaderBuildIDs(t *testing.T) {
+	path, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := elf.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wantGNU, wantGo := GNUBuildID(f), GoBuildID(f)
+	if wantGo == "" {
+		t.Fatal("test binary has no Go build ID")
+	}
+
+	// the first page, as dumped into a core
+	gnu, goID := HeaderBuildIDs(data[:4096])
+	if !bytes.Equal(gnu, wantGNU) || goID != wantGo {
+		t.Errorf("got %x, %q, want %x, %q", gnu, goID, wantGNU, wantGo)
+	}
+	for _, head := range [][]byte{nil, data[:32], data[:128], []byte("not an ELF file at all, not at all")} {
+		if gnu, goID := HeaderBuildIDs(head); gnu != nil || goID != "" {
+			t.Errorf("%d bytes: got %x, %q from a truncated header", len(head), gnu, goID)
+		}
+	}
+}
+
+// buildStripped builds a Go program into dir and splits it like distro
+// packaging does: name.debug keeps the symbols and DWARF, name is stripped
+// and links to it with .gnu_debuglink
+func buildStripped(t *testing.T, dir, name string, gnuBuildID bool) {
+	t.Helper()
+	src := t.TempDir()
+	os.WriteFile(filepath.Join(src, "main.go"), []byte("package main\n\nfunc main() {}\n"), 0o644)
+	os.WriteFile(filepath.Join(src, "go.mod"), []byte("module fixture\n\ngo 1.23\n"), 0o644)
+	full := filepath.Join(dir, name+".full")
+	cmds := [][]string{{"go", "build", "-o", full, "-ldflags=-B=gobuildid", "."}}
+	if !gnuBuildID {
+		// recent toolchains always emit one, debuglink is then checked by CRC
+		cmds = append(cmds, []string{"objcopy", "--remove-section=.note.gnu.build-id", full})
+	}
+	cmds = append(cmds, [][]string{
+		{"objcopy", "--only-keep-debug", full, filepath.Join(dir, name+".debug")},
+		{"strip", "-o", filepath.Join(dir, name), full},
+		{"objcopy", "--add-gnu-debuglink=" + filepath.Join(dir, name+".debug"), filepath.Join(dir, name)},
+	}...)
+	for _, args := range cmds {
+		cmd := exec.Command(args[0], args[1:]...)
+		cmd.Dir = src
+		cmd.Env = append(cmd.Environ(), "CGO_ENABLED=0")
+		if output, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("%v: %v\n%s", args, err, output)
+		}
+	}
+	os.Remove(full)
+}
+
+func copyFile(t *testing.T, from, to string) {
+	t.Helper()
+	data, err := os.ReadFile(from)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Dir(to), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(to, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFindDebugFile(t *testing.T) {
+	if testing.Short() {
+		t.Skip("builds fixtures")
+	}
+	for _, tool := range []string{"go", "objcopy", "strip"} {
+		if _, err := exec.LookPath(tool); err != nil {
+			t.Skipf("%s not found", tool)
+		}
+	}
+	fixtures := t.TempDir()
+	buildStripped(t, fixtures, "withid", true)
+	buildStripped(t, fixtures, "noid", false)
+
+	tests := []struct {
+		name    string
+		exe     string                               // fixture to analyze
+		place   func(exeDir, debugDir string) string // installs debug info, returns the path to find
+		wantErr bool
+	}{
+		{
+			name: "build id directory",
+			exe:  "withid",
+			place: func(exeDir, debugDir string) string {
+				f, _ := elf.Open(filepath.Join(exeDir, "withid"))
+				defer f.Close()
+				id := hex.EncodeToString(GNUBuildID(f))
+				path := filepath.Join(debugDir, ".build-id", id[:2], id[2:]+".debug")
+				copyFile(t, filepath.Join(fixtures, "withid.debug"), path)
+				return path
+			},
+		},
+		{
+			name: "debuglink next to the executable",
+			exe:  "noid",
+			place: func(exeDir, debugDir string) string {
+				path := filepath.Join(exeDir, "noid.debug")
+				copyFile(t, filepath.Join(fixtures, "noid.debug"), path)
+				return path
+			},
+		},
+		{
+			name: "debuglink in .debug",
+			exe:  "noid",
+			place: func(exeDir, debugDir string) string {
+				path := filepath.Join(exeDir, ".debug", "noid.debug")
+				copyFile(t, filepath.Join(fixtures, "noid.debug"), path)
+				return path
+			},
+		},
+		{
+			name: "debuglink under the debug directory",
+			exe:  "noid",
+			place: func(exeDir, debugDir string) string {
+				path := filepath.Join(debugDir, exeDir, "noid.debug")
+				copyFile(t, filepath.Join(fixtures, "noid.debug"), path)
+				return path
+			},
+		},
+		{
+			name: "debuglink crc mismatch",
+			exe:  "noid",
+			place: func(exeDir, debugDir string) string {
+				path := filepath.Join(exeDir, "noid.debug")
+				copyFile(t, filepath.Join(fixtures, "noid.debug"), path)
+				f, _ := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0)
+				f.Write([]byte{0})
+				f.Close()
+				return ""
+			},
+			wantErr: true,
+		},
+		{
+			name: "debuglink build id mismatch",
+			exe:  "withid",
+			place: func(exeDir, debugDir string) string {
+				// right name, but from another build
+				copyFile(t, filepath.Join(fixtures, "noid.debug"), filepath.Join(exeDir, "withid.debug"))
+				return ""
+			},
+			wantErr: true,
+		},
+		{
+			name:    "no debug file",
+			exe:     "noid",
+			place:   func(exeDir, debugDir string) string { return "" },
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			exeDir, debugDir := t.TempDir(), t.TempDir()
+			saved := debugDirs
+			debugDirs = []string{debugDir}
+			t.Cleanup(func() { debugDirs = saved })
+
+			exePath := filepath.Join(exeDir, tt.exe)
+			copyFile(t, filepath.Join(fixtures, tt.exe), exePath)
+			want := tt.place(exeDir, debugDir)
+
+			exe, err := elf.Open(exePath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer exe.Close()
+			if !needsDebugFile(exe) {
+				t.Fatal("stripped fixture has symbols")
+			}
+			if hasID := GNUBuildID(exe) != nil; hasID != (tt.exe == "withid") {
+				t.Fatalf("fixture %s has GNU build ID: %v", tt.exe, hasID)
+			}
+			name, crc, ok := debugLink(exe)
+			if !ok || name != tt.exe+".debug" {
+				t.Fatalf("debugLink: %q, %v", name, ok)
+			}
+			if debug, err := os.ReadFile(filepath.Join(fixtures, tt.exe+".debug")); err != nil || crc32.ChecksumIEEE(debug) != crc {
+				t.Errorf("debugLink crc %08x doesn't match %s.debug", crc, tt.exe)
+			}
+
+			f, path, err := findDebugFile(exe, exePath)
+			if tt.wantErr {
+				if err == nil {
+					f.Close()
+					t.Fatalf("found %s, want an error", path)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			f.Close()
+			if path != want {
+				t.Errorf("found %s, want %s", path, want)
+			}
+
+			// the loader reads symbols and DWARF from the debug file
+			loader := &LinuxBinaryLoader{}
+			if err := loader.Load(exePath); err != nil {
+				t.Fatal(err)
+			}
+			defer loader.Close()
+			if loader.DebugFilePath() != want {
+				t.Errorf("loader uses %q, want %s", loader.DebugFilePath(), want)
+			}
+			if _, err := loader.FindVariableAddress("runtime.allgs"); err != nil {
+				t.Error(err)
+			}
+			if d, err := loader.GetDWARFLoader(); err != nil || !d.HasDWARF() {
+				t.Errorf("no DWARF from the debug file: %v", err)
+			}
+		})
+	}
+}
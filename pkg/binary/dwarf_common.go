@@ -15,11 +15,13 @@ type dwarfLoader struct {
 	data        *dwarf.Data
 	err         error
 	file        dwarfer
+	mu          sync.RWMutex      // guards the caches, one reader serves concurrent requests
 	offsetCache map[string]uint64 // key: "structName.fieldName"
+	typeCache   map[string]string // key: variable name
 }
 
 func newDwarfLoader(file dwarfer) *dwarfLoader {
-	return &dwarfLoader{file: file, offsetCache: make(map[string]uint64)}
+	return &dwarfLoader{file: file, offsetCache: make(map[string]uint64), typeCache: make(map[string]string)}
 }
 
 func (d *dwarfLoader) load() (*dwarf.Data, error) {
@@ -34,10 +36,23 @@ func (d *dwarfLoader) HasDWARF() bool {
 	return err == nil
 }
 
+func (d *dwarfLoader) cached(key string) (uint64, bool) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	v, ok := d.offsetCache[key]
+	return v, ok
+}
+
+func (d *dwarfLoader) store(key string, v uint64) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.offsetCache[key] = v
+}
+
 func (d *dwarfLoader) GetStructOffset(typeName, fieldName string) (uint64, error) {
 	// Check cache first
 	cacheKey := typeName + "." + fieldName
-	if offset, ok := d.offsetCache[cacheKey]; ok {
+	if offset, ok := d.cached(cacheKey); ok {
 		return offset, nil
 	}
 
@@ -62,7 +77,7 @@ func (d *dwarfLoader) GetStructOffset(typeName, fieldName string) (uint64, error
 				if err != nil {
 					return 0, err
 				}
-				d.offsetCache[cacheKey] = offset
+				d.store(cacheKey, offset)
 				return offset, nil
 			}
 		}
@@ -94,7 +109,7 @@ func (d *dwarfLoader) findFieldOffset(reader *dwarf.Reader, fieldName string) (u
 
 func (d *dwarfLoader) GetStructSize(typeName string) (uint64, error) {
 	// Check cache first
-	if size, ok := d.offsetCache[typeName+".size"]; ok {
+	if size, ok := d.cached(typeName + ".size"); ok {
 		return size, nil
 	}
 
@@ -118,7 +133,7 @@ func (d *dwarfLoader) GetStructSize(typeName string) (uint64, error) {
 			if ok && name == typeName {
 				if size, ok := entry.Val(dwarf.AttrByteSize).(int64); ok {
 					// Cache the result
-					d.offsetCache[typeName+".size"] = uint64(size)
+					d.store(typeName+".size", uint64(size))
 					return uint64(size), nil
 				}
 			}
@@ -128,6 +143,56 @@ func (d *dwarfLoader) GetStructSize(typeName string) (uint64, error) {
 	return 0, fmt.Errorf("struct type %q not found", typeName)
 }
 
+// GetVariableType returns the type name of a global variable, like "[]*runtime.dbgVar"
+func (d *dwarfLoader) GetVariableType(varName string) (string, error) {
+	d.mu.RLock()
+	typ, ok := d.typeCache[varName]
+	d.mu.RUnlock()
+	if ok {
+		return typ, nil
+	}
+
+	dwarfData, err := d.load()
+	if err != nil {
+		return "", fmt.Errorf("DWARF unavailable: %w", err)
+	}
+
+	reader := dwarfData.Reader()
+	for {
+		entry, err := reader.Next()
+		if err != nil {
+			return "", err
+		}
+		if entry == nil {
+			break
+		}
+
+		if entry.Tag == dwarf.TagVariable {
+			if name, _ := entry.Val(dwarf.AttrName).(string); name == varName {
+				off, ok := entry.Val(dwarf.AttrType).(dwarf.Offset)
+				if !ok {
+					return "", fmt.Errorf("type not found for variable %s", varName)
+				}
+				// Type() leaves Name empty for structs, Go slices included
+				reader.Seek(off)
+				typeEntry, err := reader.Next()
+				if err != nil || typeEntry == nil {
+					return "", fmt.Errorf("type not found for variable %s: %v", varName, err)
+				}
+				typ, _ := typeEntry.Val(dwarf.AttrName).(string)
+				d.mu.Lock()
+				d.typeCache[varName] = typ
+				d.mu.Unlock()
+				return typ, nil
+			}
+		}
+		if entry.Tag != dwarf.TagCompileUnit {
+			reader.SkipChildren()
+		}
+	}
+	return "", fmt.Errorf("variable %s not found", varName)
+}
+
 func (d *dwarfLoader) GetNestedOffset(outerType, outerField, innerField string) (uint64, error) {
 	outerOffset, err := d.GetStructOffset(outerType, outerField)
 	if err != nil {
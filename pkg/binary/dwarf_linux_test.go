@@ -0,0 +1,95 @@
+//go:build linux
+
+package binary
+
+import (
+	"debug/elf"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+// dwarfFixture builds a program with DWARF, go test links without it
+func dwarfFixture(t *testing.T) *dwarfLoader {
+	t.Helper()
+	if testing.Short() {
+		t.Skip("builds a fixture")
+	}
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("go not found")
+	}
+	src, path := t.TempDir(), filepath.Join(t.TempDir(), "prog")
+	os.WriteFile(filepath.Join(src, "main.go"), []byte("package main\n\nfunc main() {}\n"), 0o644)
+	os.WriteFile(filepath.Join(src, "go.mod"), []byte("module fixture\n\ngo 1.23\n"), 0o644)
+	cmd := exec.Command("go", "build", "-o", path, ".")
+	cmd.Dir = src
+	if output, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("go build: %v\n%s", err, output)
+	}
+	f, err := elf.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { f.Close() })
+	d := newDwarfLoader(f)
+	if !d.HasDWARF() {
+		t.Fatal("fixture has no DWARF")
+	}
+	return d
+}
+
+// one reader serves /stream, /metrics and REST requests at the same time,
+// run with -race to catch unguarded cache writes
+func TestDwarfLoaderConcurrent(t *testing.T) {
+	d := dwarfFixture(t)
+
+	var wg sync.WaitGroup
+	offsets := make([]uint64, 8)
+	for i := range offsets {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for _, spec := range RuntimeStructSpecs[:3] {
+				d.GetStructSize(spec.Type)
+				for _, field := range spec.Fields {
+					d.GetStructOffset(spec.Type, field)
+				}
+			}
+			d.GetVariableType("runtime.dbgvars")
+			offsets[i], _ = d.GetStructOffset("runtime.g", "goid")
+		}()
+	}
+	wg.Wait()
+	for i, off := range offsets {
+		if off == 0 || off != offsets[0] {
+			t.Errorf("goroutine %d: runtime.g.goid at %d, want %d", i, off, offsets[0])
+		}
+	}
+}
+
+func TestGetVariableType(t *testing.T) {
+	d := dwarfFixture(t)
+	tests := []struct {
+		name string
+		want string // empty if not found
+	}{
+		{"runtime.allgs", "[]*runtime.g"},
+		{"runtime.dbgvars", "[]*runtime.dbgVar"},
+		{"runtime.gomaxprocs", "int32"},
+		{"runtime.noSuchVariable", ""},
+	}
+	for _, tt := range tests {
+		got, err := d.GetVariableType(tt.name)
+		if tt.want == "" {
+			if err == nil {
+				t.Errorf("%s: got %q, want not found", tt.name, got)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("%s: got %q, %v, want %q", tt.name, got, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,38 @@
+//go:build linux
+
+package binary
+
+import (
+	"debug/buildinfo"
+	"debug/elf"
+)
+
+// GoBinaryInfo is what can be learned about a Go executable without loading it
+type GoBinaryInfo struct {
+	GoVersion  string // empty if the binary predates .go.buildinfo
+	ModulePath string // main module, empty for GOPATH builds
+}
+
+// IdentifyGoBinary reports whether path is a Go executable. .go.buildinfo is
+// checked first, older binaries are recognized by the runtime.buildVersion symbol.
+func IdentifyGoBinary(path string) (*GoBinaryInfo, bool) {
+	if bi, err := buildinfo.ReadFile(path); err == nil {
+		return &GoBinaryInfo{GoVersion: bi.GoVersion, ModulePath: bi.Main.Path}, true
+	}
+
+	f, err := elf.Open(path)
+	if err != nil {
+		return nil, false
+	}
+	defer f.Close()
+	syms, err := f.Symbols()
+	if err != nil {
+		return nil, false
+	}
+	for _, sym := range syms {
+		if sym.Name == "runtime.buildVersion" {
+			return &GoBinaryInfo{}, true
+		}
+	}
+	return nil, false
+}
@@ -0,0 +1,177 @@
+package binary
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"io"
+	"sort"
+	"strings"
+)
+
+// StructSpec names a runtime struct and the fields gospy reads from it
+type StructSpec struct {
+	Type   string
+	Fields []string
+}
+
+// RuntimeStructSpecs lists every runtime struct/field gospy resolves through DWARFLoader.
+// Keep it in sync with the offsets looked up in pkg/proc.
+var RuntimeStructSpecs = []StructSpec{
+	{Type: "runtime.g", Fields: []string{"stack", "sched", "atomicstatus", "goid", "waitreason", "startpc", "gopc", "parentGoid", "waitsince"}},
+	{Type: "runtime.stack", Fields: []string{"lo", "hi"}},
+	{Type: "runtime.gobuf", Fields: []string{"pc", "sp", "bp"}},
+	{Type: "runtime.p", Fields: []string{"id", "status", "mcache", "schedtick"}},
+	{Type: "runtime.mstats", Fields: []string{"last_gc_unix", "pause_total_ns", "pause_ns", "pause_end", "numgc"}},
+	{Type: "runtime.dbgVar", Fields: []string{"name", "value", "atomic"}},
+	{Type: "runtime.moduledata", Fields: []string{"minpc", "maxpc", "text", "modulename", "next"}},
+	{Type: "runtime.gcControllerState", Fields: []string{"heapLive", "heapMarked", "gcPercentHeapGoal", "heapInUse", "heapFree", "heapReleased", "totalAlloc", "totalFree"}},
+	{Type: "runtime.m", Fields: []string{"g0", "procid", "curg", "alllink"}},
+}
+
+// Layout holds struct sizes and field offsets extracted from one binary
+type Layout struct {
+	GoVersion string
+	Sizes     map[string]uint64 // key: struct name
+	Offsets   map[string]uint64 // key: "structName.fieldName"
+}
+
+// ExtractLayout resolves sizes and offsets for specs, fields missing in this
+// version are left out of the result rather than failing the whole extraction
+func ExtractLayout(d DWARFLoader, goVersion string, specs []StructSpec) (*Layout, error) {
+	if !d.HasDWARF() {
+		return nil, fmt.Errorf("binary for %s has no DWARF info", goVersion)
+	}
+	l := &Layout{
+		GoVersion: goVersion,
+		Sizes:     make(map[string]uint64),
+		Offsets:   make(map[string]uint64),
+	}
+	for _, spec := range specs {
+		if size, err := d.GetStructSize(spec.Type); err == nil {
+			l.Sizes[spec.Type] = size
+		}
+		for _, field := range spec.Fields {
+			if offset, err := d.GetStructOffset(spec.Type, field); err == nil {
+				l.Offsets[spec.Type+"."+field] = offset
+			}
+		}
+	}
+	return l, nil
+}
+
+// LayoutChange describes a field whose offset differs between two adjacent versions
+type LayoutChange struct {
+	Field       string
+	FromVersion string
+	ToVersion   string
+	From        uint64
+	To          uint64
+	FromMissing bool
+	ToMissing   bool
+}
+
+func (c LayoutChange) String() string {
+	switch {
+	case c.FromMissing:
+		return fmt.Sprintf("%s: added in %s at %d", c.Field, c.ToVersion, c.To)
+	case c.ToMissing:
+		return fmt.Sprintf("%s: removed in %s (was %d in %s)", c.Field, c.ToVersion, c.From, c.FromVersion)
+	default:
+		return fmt.Sprintf("%s: %d (%s) -> %d (%s)", c.Field, c.From, c.FromVersion, c.To, c.ToVersion)
+	}
+}
+
+// SortLayouts orders layouts by Go version, oldest first
+func SortLayouts(layouts []*Layout) {
+	sort.SliceStable(layouts, func(i, j int) bool {
+		return compareGoVersions(layouts[i].GoVersion, layouts[j].GoVersion) < 0
+	})
+}
+
+// DiffLayouts compares each layout with the previous one, layouts must already be sorted
+func DiffLayouts(layouts []*Layout) []LayoutChange {
+	var changes []LayoutChange
+	for i := 1; i < len(layouts); i++ {
+		prev, cur := layouts[i-1], layouts[i]
+		keys := make(map[string]struct{})
+		for k := range prev.Offsets {
+			keys[k] = struct{}{}
+		}
+		for k := range cur.Offsets {
+			keys[k] = struct{}{}
+		}
+		for _, k := range sortedKeys(keys) {
+			from, inPrev := prev.Offsets[k]
+			to, inCur := cur.Offsets[k]
+			if inPrev && inCur && from == to {
+				continue
+			}
+			changes = append(changes, LayoutChange{
+				Field:       k,
+				FromVersion: prev.GoVersion,
+				ToVersion:   cur.GoVersion,
+				From:        from,
+				To:          to,
+				FromMissing: !inPrev,
+				ToMissing:   !inCur,
+			})
+		}
+	}
+	return changes
+}
+
+// WriteLayoutSource emits a gofmt'ed Go file declaring the layouts as a version keyed table
+func WriteLayoutSource(w io.Writer, pkg, varName string, layouts []*Layout) error {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "// Code generated by \"gospy gen-layouts\"; DO NOT EDIT.\n\n")
+	fmt.Fprintf(&buf, "package %s\n\n", pkg)
+	fmt.Fprintf(&buf, "import bin \"github.com/monsterxx03/gospy/pkg/binary\"\n\n")
+	fmt.Fprintf(&buf, "var %s = map[string]*bin.Layout{\n", varName)
+	for _, l := range layouts {
+		fmt.Fprintf(&buf, "%q: {\nGoVersion: %q,\nSizes: map[string]uint64{\n", l.GoVersion, l.GoVersion)
+		for _, k := range sortedKeys(l.Sizes) {
+			fmt.Fprintf(&buf, "%q: %d,\n", k, l.Sizes[k])
+		}
+		fmt.Fprintf(&buf, "},\nOffsets: map[string]uint64{\n")
+		for _, k := range sortedKeys(l.Offsets) {
+			fmt.Fprintf(&buf, "%q: %d,\n", k, l.Offsets[k])
+		}
+		fmt.Fprintf(&buf, "},\n},\n")
+	}
+	fmt.Fprintf(&buf, "}\n")
+
+	src, err := format.Source(buf.Bytes())
+	if err != nil {
+		return fmt.Errorf("failed to format generated source: %w", err)
+	}
+	_, err = w.Write(src)
+	return err
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// compareGoVersions compares "go1.x.y" style versions numerically
+func compareGoVersions(v1, v2 string) int {
+	p1 := strings.Split(strings.TrimPrefix(v1, "go"), ".")
+	p2 := strings.Split(strings.TrimPrefix(v2, "go"), ".")
+	for i := 0; i < len(p1) && i < len(p2); i++ {
+		var n1, n2 int
+		fmt.Sscanf(p1[i], "%d", &n1)
+		fmt.Sscanf(p2[i], "%d", &n2)
+		if n1 != n2 {
+			if n1 < n2 {
+				return -1
+			}
+			return 1
+		}
+	}
+	return len(p1) - len(p2)
+}
@@ -0,0 +1,52 @@
+package binary
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestDiffLayouts(t *testing.T) {
+	layouts := []*Layout{
+		{GoVersion: "go1.22.1", Offsets: map[string]uint64{"runtime.g.goid": 152, "runtime.g.waitreason": 176, "runtime.p.id": 0}},
+		{GoVersion: "go1.9", Offsets: map[string]uint64{"runtime.g.goid": 152}},
+		{GoVersion: "go1.24.0", Offsets: map[string]uint64{"runtime.g.goid": 160, "runtime.g.waitreason": 176, "runtime.g.syncGroup": 200}},
+	}
+	SortLayouts(layouts)
+	if layouts[0].GoVersion != "go1.9" || layouts[2].GoVersion != "go1.24.0" {
+		t.Fatalf("unexpected sort order: %s, %s, %s", layouts[0].GoVersion, layouts[1].GoVersion, layouts[2].GoVersion)
+	}
+
+	var got []string
+	for _, c := range DiffLayouts(layouts) {
+		got = append(got, c.String())
+	}
+	want := []string{
+		"runtime.g.waitreason: added in go1.22.1 at 176",
+		"runtime.p.id: added in go1.22.1 at 0",
+		"runtime.g.goid: 152 (go1.22.1) -> 160 (go1.24.0)",
+		"runtime.g.syncGroup: added in go1.24.0 at 200",
+		"runtime.p.id: removed in go1.24.0 (was 0 in go1.22.1)",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("DiffLayouts() =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestWriteLayoutSource(t *testing.T) {
+	layouts := []*Layout{{
+		GoVersion: "go1.24.1",
+		Sizes:     map[string]uint64{"runtime.g": 448},
+		Offsets:   map[string]uint64{"runtime.g.goid": 160},
+	}}
+	var buf bytes.Buffer
+	if err := WriteLayoutSource(&buf, "proc", "runtimeLayouts", layouts); err != nil {
+		t.Fatalf("WriteLayoutSource() error = %v", err)
+	}
+	src := buf.String()
+	for _, want := range []string{"package proc", "var runtimeLayouts = map[string]*bin.Layout{", `"runtime.g.goid": 160,`} {
+		if !strings.Contains(src, want) {
+			t.Errorf("generated source missing %q:\n%s", want, src)
+		}
+	}
+}
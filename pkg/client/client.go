@@ -0,0 +1,380 @@
+// Package client is a typed Go client of the gospy API server (gospy serve).
+// A Process mirrors proc.ProcessMemReader over HTTP, responses decode into
+// the same types the server encodes.
+package client
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/monsterxx03/gospy/pkg/api"
+	"github.com/monsterxx03/gospy/pkg/proc"
+)
+
+// Error is a non-2xx response of the server
+type Error struct {
+	StatusCode int
+	Message    string // the response body
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("gospy api: %s: %s", http.StatusText(e.StatusCode), e.Message)
+}
+
+// Client talks to one gospy API server
+type Client struct {
+	base  *url.URL
+	http  *http.Client
+	token string
+}
+
+// Option configures a Client
+type Option func(*Client)
+
+// WithHTTPClient sets the HTTP client, e.g. for timeouts or TLS. The default
+// is http.DefaultClient.
+func WithHTTPClient(hc *http.Client) Option {
+	return func(c *Client) {
+		c.http = hc
+	}
+}
+
+// WithBearerToken authenticates requests with token, for servers started
+// with --token-file
+func WithBearerToken(token string) Option {
+	return func(c *Client) {
+		c.token = token
+	}
+}
+
+// WithUnixSocket connects to a server listening on the unix socket path, the
+// host of the base url is then only sent in the Host header
+func WithUnixSocket(path string) Option {
+	return func(c *Client) {
+		var d net.Dialer
+		c.http = &http.Client{Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				return d.DialContext(ctx, "unix", path)
+			},
+		}}
+	}
+}
+
+// New returns a client of the server at baseURL, e.g. http://localhost:8974
+func New(baseURL string, opts ...Option) (*Client, error) {
+	base, err := url.Parse(strings.TrimSuffix(baseURL, "/"))
+	if err != nil {
+		return nil, fmt.Errorf("invalid base url: %w", err)
+	}
+	if base.Scheme == "" || base.Host == "" {
+		return nil, fmt.Errorf("invalid base url %q, want scheme://host[:port]", baseURL)
+	}
+	c := &Client{base: base, http: http.DefaultClient}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c, nil
+}
+
+// Process returns the view of one target process, nothing is requested yet
+func (c *Client) Process(pid int) *Process {
+	return &Process{c: c, pid: pid}
+}
+
+// Source is Process for a core or snapshot the server was started with, source
+// is e.g. "core:/tmp/core.1234" as printed by gospy serve
+func (c *Client) Source(source string, pid int) *Process {
+	return &Process{c: c, pid: pid, source: source}
+}
+
+// Processes lists the Go processes on the server's host
+func (c *Client) Processes() ([]proc.GoProcess, error) {
+	var procs []proc.GoProcess
+	if err := c.get("/ps", nil, &procs); err != nil {
+		return nil, err
+	}
+	return procs, nil
+}
+
+// Aggregate merges the goroutines and memory stats of several processes
+func (c *Client) Aggregate(pids ...int) (*proc.AggregateReport, error) {
+	ids := make([]string, len(pids))
+	for i, pid := range pids {
+		ids[i] = strconv.Itoa(pid)
+	}
+	var report proc.AggregateReport
+	if err := c.get("/aggregate", url.Values{"pid": {strings.Join(ids, ",")}}, &report); err != nil {
+		return nil, err
+	}
+	return &report, nil
+}
+
+// AggregateByName merges the processes whose executable is name
+func (c *Client) AggregateByName(name string) (*proc.AggregateReport, error) {
+	var report proc.AggregateReport
+	if err := c.get("/aggregate", url.Values{"name": {name}}, &report); err != nil {
+		return nil, err
+	}
+	return &report, nil
+}
+
+// AggregateStacks merges the goroutine dumps of several processes by state and stack
+func (c *Client) AggregateStacks(pids ...int) (*proc.StackReport, error) {
+	ids := make([]string, len(pids))
+	for i, pid := range pids {
+		ids[i] = strconv.Itoa(pid)
+	}
+	var report proc.StackReport
+	if err := c.get("/aggregate/dump", url.Values{"pid": {strings.Join(ids, ",")}}, &report); err != nil {
+		return nil, err
+	}
+	return &report, nil
+}
+
+func (c *Client) url(path string, q url.Values) string {
+	u := *c.base
+	u.Path += path
+	u.RawQuery = q.Encode()
+	return u.String()
+}
+
+func (c *Client) do(ctx context.Context, path string, q url.Values) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.url(path, q), nil)
+	if err != nil {
+		return nil, err
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode/100 != 2 {
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return nil, &Error{StatusCode: resp.StatusCode, Message: strings.TrimSpace(string(body))}
+	}
+	return resp, nil
+}
+
+// get decodes the JSON response of path into out
+func (c *Client) get(path string, q url.Values, out any) error {
+	resp, err := c.do(context.Background(), path, q)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode %s response: %w", path, err)
+	}
+	return nil
+}
+
+// Process is one target process of the server
+type Process struct {
+	c      *Client
+	pid    int
+	source string // empty for a live process
+}
+
+// GoroutineQuery selects goroutines, the zero value selects all of them
+type GoroutineQuery struct {
+	Status     []string      // any of these statuses
+	WaitReason []string      // any of these wait reasons
+	Func       string        // regexp matched against the current and the start function
+	MinWait    time.Duration // waiting at least this long
+	Offset     int
+	Limit      int // 0 for no limit
+}
+
+func (q *GoroutineQuery) values(v url.Values) url.Values {
+	if q == nil {
+		return v
+	}
+	if len(q.Status) > 0 {
+		v.Set("status", strings.Join(q.Status, ","))
+	}
+	if len(q.WaitReason) > 0 {
+		v.Set("wait_reason", strings.Join(q.WaitReason, ","))
+	}
+	if q.Func != "" {
+		v.Set("func", q.Func)
+	}
+	if q.MinWait > 0 {
+		v.Set("min_wait", q.MinWait.String())
+	}
+	if q.Offset > 0 {
+		v.Set("offset", strconv.Itoa(q.Offset))
+	}
+	if q.Limit > 0 {
+		v.Set("limit", strconv.Itoa(q.Limit))
+	}
+	return v
+}
+
+func (p *Process) query() url.Values {
+	v := url.Values{"pid": {strconv.Itoa(p.pid)}}
+	if p.source != "" {
+		v.Set("source", p.source)
+	}
+	return v
+}
+
+func (p *Process) Pid() int {
+	return p.pid
+}
+
+func (p *Process) RuntimeInfo() (*proc.Runtime, error) {
+	var rt proc.Runtime
+	if err := p.c.get("/runtime", p.query(), &rt); err != nil {
+		return nil, err
+	}
+	return &rt, nil
+}
+
+// Goroutines returns the goroutines selected by q, nil for all, ordered by goid.
+// Whether dead goroutines are included is up to the server's --show-dead.
+func (p *Process) Goroutines(q *GoroutineQuery) ([]proc.G, error) {
+	var gs []proc.G
+	if err := p.c.get("/goroutines", q.values(p.query()), &gs); err != nil {
+		return nil, err
+	}
+	return gs, nil
+}
+
+// Goroutine returns one goroutine with its stack, an *Error with
+// http.StatusNotFound if there is no such goroutine
+func (p *Process) Goroutine(goid int64) (*api.GoroutineStack, error) {
+	var g api.GoroutineStack
+	if err := p.c.get("/goroutines/"+strconv.FormatInt(goid, 10), p.query(), &g); err != nil {
+		return nil, err
+	}
+	return &g, nil
+}
+
+func (p *Process) GetGoroutineStackTraceByGoID(goid int64) ([]proc.StackFrame, error) {
+	q := p.query()
+	q.Set("goid", strconv.FormatInt(goid, 10))
+	var frames []proc.StackFrame
+	if err := p.c.get("/stack", q, &frames); err != nil {
+		return nil, err
+	}
+	return frames, nil
+}
+
+// StackTrace returns the stack of g, only its Goid is used
+func (p *Process) StackTrace(g proc.G) ([]proc.StackFrame, error) {
+	return p.GetGoroutineStackTraceByGoID(g.Goid)
+}
+
+// Ps returns the processors (P)
+func (p *Process) Ps() ([]proc.P, error) {
+	var ps []proc.P
+	if err := p.c.get("/processors", p.query(), &ps); err != nil {
+		return nil, err
+	}
+	return ps, nil
+}
+
+func (p *Process) MemStat() (*proc.MemStat, error) {
+	var ms proc.MemStat
+	if err := p.c.get("/memstats", p.query(), &ms); err != nil {
+		return nil, err
+	}
+	return &ms, nil
+}
+
+// SampleThreads returns the goroutine each thread is running. The samples'
+// G is not sent, Goid identifies the goroutine.
+func (p *Process) SampleThreads() ([]proc.ThreadSample, error) {
+	var samples []proc.ThreadSample
+	if err := p.c.get("/threads", p.query(), &samples); err != nil {
+		return nil, err
+	}
+	return samples, nil
+}
+
+// Dump returns the goroutines selected by q with their stacks
+func (p *Process) Dump(q *GoroutineQuery) ([]api.GoroutineStack, error) {
+	var gs []api.GoroutineStack
+	if err := p.c.get("/dump", q.values(p.query()), &gs); err != nil {
+		return nil, err
+	}
+	return gs, nil
+}
+
+// Groups counts the goroutines selected by q by start_func, wait_reason,
+// status or creator, largest group first
+func (p *Process) Groups(by string, q *GoroutineQuery) ([]api.GroupCount, error) {
+	v := q.values(p.query())
+	v.Set("by", by)
+	var groups []api.GroupCount
+	if err := p.c.get("/groups", v, &groups); err != nil {
+		return nil, err
+	}
+	return groups, nil
+}
+
+// Stream calls fn with every event of /stream until ctx is done, fn returns
+// an error or the server ends the stream. An error event is returned as an
+// error after fn has seen it.
+func (p *Process) Stream(ctx context.Context, interval time.Duration, fn func(*api.StreamEvent) error) error {
+	q := p.query()
+	if interval > 0 {
+		q.Set("interval", interval.String())
+	}
+	resp, err := p.c.do(ctx, "/stream", q)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	sc := bufio.NewScanner(resp.Body)
+	sc.Buffer(make([]byte, 64<<10), 16<<20)
+	var data bytes.Buffer
+	for sc.Scan() {
+		line := sc.Bytes()
+		if field, ok := bytes.CutPrefix(line, []byte("data:")); ok {
+			if data.Len() > 0 {
+				data.WriteByte('\n')
+			}
+			data.Write(bytes.TrimPrefix(field, []byte(" ")))
+			continue
+		}
+		if len(line) > 0 || data.Len() == 0 {
+			continue // event and id fields repeat what's in the data
+		}
+		var ev api.StreamEvent
+		if err := json.Unmarshal(data.Bytes(), &ev); err != nil {
+			return fmt.Errorf("failed to decode stream event: %w", err)
+		}
+		data.Reset()
+		if err := fn(&ev); err != nil {
+			return err
+		}
+		if ev.Type == api.StreamError {
+			return fmt.Errorf("stream of pid %d ended: %s", p.pid, ev.Error)
+		}
+	}
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return sc.Err()
+}
+
+// Close releases idle connections, the server keeps its reader of the process
+func (p *Process) Close() error {
+	p.c.http.CloseIdleConnections()
+	return nil
+}
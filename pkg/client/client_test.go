@@ -0,0 +1,161 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/monsterxx03/gospy/pkg/api"
+	"github.com/monsterxx03/gospy/pkg/proc"
+)
+
+// fakeReader serves fixed data, methods the tests don't reach panic
+type fakeReader struct {
+	proc.ProcessMemReader
+	goroutines []proc.G
+}
+
+func (r *fakeReader) Pid() int                     { return 42 }
+func (r *fakeReader) Close() error                 { return nil }
+func (r *fakeReader) Frozen(fn func() error) error { return fn() }
+func (r *fakeReader) RuntimeInfo() (*proc.Runtime, error) {
+	return &proc.Runtime{GoVersion: "go1.23.4"}, nil
+}
+func (r *fakeReader) MemStat() (*proc.MemStat, error)             { return &proc.MemStat{NumGC: 3}, nil }
+func (r *fakeReader) Ps() ([]proc.P, error)                       { return []proc.P{{ID: 0, Status: "running"}}, nil }
+func (r *fakeReader) Goroutines(bool) ([]proc.G, error)           { return r.goroutines, nil }
+func (r *fakeReader) SampleThreads() ([]proc.ThreadSample, error) { return nil, nil }
+
+func (r *fakeReader) StackTrace(g proc.G) ([]proc.StackFrame, error) {
+	return []proc.StackFrame{{Function: g.FuncName, File: "main.go", Line: int(g.Goid)}}, nil
+}
+
+func newTestProcess(t *testing.T) *Process {
+	s := api.NewServer(0, false, false)
+	s.AddReader("core:/tmp/core.42", &fakeReader{goroutines: []proc.G{
+		{Goid: 1, Status: "running", FuncName: "main.main"},
+		{Goid: 7, Status: "waiting", WaitReason: "chan receive", FuncName: "main.worker", StartFuncName: "main.worker"},
+		{Goid: 8, Status: "waiting", WaitReason: "select", FuncName: "main.worker", StartFuncName: "main.worker"},
+	}})
+	ts := httptest.NewServer(s.Handler())
+	t.Cleanup(ts.Close)
+	c, err := New(ts.URL + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c.Source("core:/tmp/core.42", 42)
+}
+
+func TestProcess(t *testing.T) {
+	p := newTestProcess(t)
+
+	rt, err := p.RuntimeInfo()
+	if err != nil || rt.GoVersion != "go1.23.4" {
+		t.Errorf("RuntimeInfo: %v, %v", rt, err)
+	}
+	ms, err := p.MemStat()
+	if err != nil || ms.NumGC != 3 {
+		t.Errorf("MemStat: %v, %v", ms, err)
+	}
+	ps, err := p.Ps()
+	if err != nil || len(ps) != 1 || ps[0].Status != "running" {
+		t.Errorf("Ps: %v, %v", ps, err)
+	}
+
+	gs, err := p.Goroutines(&GoroutineQuery{Status: []string{"waiting"}, Func: "worker", Limit: 1})
+	if err != nil || len(gs) != 1 || gs[0].Goid != 7 || gs[0].WaitReason != "chan receive" {
+		t.Errorf("Goroutines: %+v, %v", gs, err)
+	}
+	all, err := p.Goroutines(nil)
+	if err != nil || len(all) != 3 {
+		t.Errorf("Goroutines(nil): %d goroutines, %v", len(all), err)
+	}
+
+	g, err := p.Goroutine(8)
+	if err != nil || g.Goid != 8 || len(g.Frames) != 1 || g.Frames[0].Line != 8 {
+		t.Errorf("Goroutine: %+v, %v", g, err)
+	}
+	frames, err := p.StackTrace(proc.G{Goid: 7})
+	if err != nil || !reflect.DeepEqual(frames, []proc.StackFrame{{Function: "main.worker", File: "main.go", Line: 7}}) {
+		t.Errorf("StackTrace: %+v, %v", frames, err)
+	}
+
+	groups, err := p.Groups("start_func", nil)
+	if err != nil || len(groups) != 2 || groups[0].Key != "main.worker" || groups[0].Count != 2 {
+		t.Errorf("Groups: %+v, %v", groups, err)
+	}
+}
+
+func TestNotFound(t *testing.T) {
+	_, err := newTestProcess(t).Goroutine(99)
+	var apiErr *Error
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusNotFound {
+		t.Errorf("got %v, want a 404 error", err)
+	}
+}
+
+func TestStream(t *testing.T) {
+	p := newTestProcess(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var events []*api.StreamEvent
+	stop := errors.New("stop")
+	err := p.Stream(ctx, 100*time.Millisecond, func(ev *api.StreamEvent) error {
+		events = append(events, ev)
+		if len(events) == 2 {
+			return stop
+		}
+		return nil
+	})
+	if err != stop {
+		t.Fatalf("Stream: %v", err)
+	}
+	if events[0].Type != api.StreamSnapshot || events[0].Runtime == nil || events[0].Goroutines != 3 {
+		t.Errorf("first event: %+v", events[0])
+	}
+	if events[1].Type != api.StreamTick || events[1].Delta == nil || events[1].Seq != 2 {
+		t.Errorf("second event: %+v", events[1])
+	}
+}
+
+func TestNewInvalidURL(t *testing.T) {
+	for _, u := range []string{"localhost:8974", "://x"} {
+		if _, err := New(u); err == nil {
+			t.Errorf("%q accepted", u)
+		}
+	}
+}
+
+func TestBearerTokenOverUnixSocket(t *testing.T) {
+	s := api.NewServer(0, false, false)
+	s.AddReader("core:/tmp/core.42", &fakeReader{})
+	s.SetBearerTokens([]string{"secret"})
+	sock := filepath.Join(t.TempDir(), "api.sock")
+	l, err := net.Listen("unix", sock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go s.Serve(l)
+	t.Cleanup(func() { l.Close() })
+
+	c, err := New("http://gospy", WithUnixSocket(sock))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var apiErr *Error
+	if _, err := c.Source("core:/tmp/core.42", 42).RuntimeInfo(); !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("without token: %v", err)
+	}
+
+	c, _ = New("http://gospy", WithUnixSocket(sock), WithBearerToken("secret"))
+	if rt, err := c.Source("core:/tmp/core.42", 42).RuntimeInfo(); err != nil || rt.GoVersion != "go1.23.4" {
+		t.Fatalf("with token: %v, %v", rt, err)
+	}
+}
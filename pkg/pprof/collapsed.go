@@ -0,0 +1,45 @@
+package pprof
+
+import (
+	"bufio"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ';' separates frames and ' ' the count, neither may appear in a frame
+var frameEscaper = strings.NewReplacer(";", ":", " ", "_")
+
+// WriteCollapsed writes the profile in the collapsed stack format used by
+// flamegraph.pl and most flame graph tools: one line per stack, root first,
+// frames separated by ';', followed by the value flame graphs use
+func WriteCollapsed(w io.Writer, p *Profile) error {
+	counts := make(map[string]int64)
+	idx := p.valueIndex()
+	for _, s := range p.Samples {
+		if idx >= len(s.Values) || len(s.Stack) == 0 {
+			continue
+		}
+		names := make([]string, len(s.Stack))
+		for i, f := range s.Stack {
+			names[len(s.Stack)-1-i] = frameEscaper.Replace(frameName(f))
+		}
+		// samples with the same functions but different pcs fold together
+		counts[strings.Join(names, ";")] += s.Values[idx]
+	}
+	stacks := make([]string, 0, len(counts))
+	for stack := range counts {
+		stacks = append(stacks, stack)
+	}
+	sort.Strings(stacks)
+
+	bw := bufio.NewWriter(w)
+	for _, stack := range stacks {
+		bw.WriteString(stack)
+		bw.WriteByte(' ')
+		bw.WriteString(strconv.FormatInt(counts[stack], 10))
+		bw.WriteByte('\n')
+	}
+	return bw.Flush()
+}
@@ -0,0 +1,243 @@
+package pprof
+
+import (
+	"bufio"
+	"fmt"
+	"hash/fnv"
+	"html"
+	"io"
+	"sort"
+)
+
+// flame graph geometry, in pixels
+const (
+	flameWidth      = 1200
+	flamePad        = 10
+	flameFrameH     = 16
+	flameHeaderH    = 40
+	flameFooterH    = 30
+	flameMinWidth   = 0.1 // narrower frames are left out, as flamegraph.pl does
+	flameCharWidth  = 7   // approximate width of a 12px Verdana character
+	flameTextIndent = 3
+)
+
+// flameNode is a frame in the flame graph tree, children keyed by name
+type flameNode struct {
+	name     string
+	value    int64
+	children map[string]*flameNode
+}
+
+func (n *flameNode) child(name string) *flameNode {
+	c, ok := n.children[name]
+	if !ok {
+		c = &flameNode{name: name, children: make(map[string]*flameNode)}
+		n.children[name] = c
+	}
+	return c
+}
+
+// flameRect is a laid out frame, x and w are fractions of the root's width
+type flameRect struct {
+	node  *flameNode
+	x, w  float64
+	depth int
+}
+
+// WriteFlameGraph writes the profile as a self-contained SVG flame graph, root
+// at the bottom, weighted by the last sample value like pprof's default view.
+// Clicking a frame zooms into it and Search highlights frames matching a regexp.
+func WriteFlameGraph(w io.Writer, p *Profile) error {
+	root := &flameNode{name: "all", children: make(map[string]*flameNode)}
+	idx := p.valueIndex()
+	for _, s := range p.Samples {
+		if idx >= len(s.Values) {
+			continue
+		}
+		v := s.Values[idx]
+		root.value += v
+		n := root
+		for i := len(s.Stack) - 1; i >= 0; i-- {
+			n = n.child(frameName(s.Stack[i]))
+			n.value += v
+		}
+	}
+
+	var rects []flameRect
+	maxDepth := 0
+	var layout func(n *flameNode, x float64, depth int)
+	layout = func(n *flameNode, x float64, depth int) {
+		w := 1.0
+		if root.value > 0 {
+			w = float64(n.value) / float64(root.value)
+		}
+		if w*(flameWidth-2*flamePad) < flameMinWidth {
+			return
+		}
+		rects = append(rects, flameRect{node: n, x: x, w: w, depth: depth})
+		if depth > maxDepth {
+			maxDepth = depth
+		}
+		names := make([]string, 0, len(n.children))
+		for name := range n.children {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			c := n.children[name]
+			layout(c, x, depth+1)
+			if root.value > 0 {
+				x += float64(c.value) / float64(root.value)
+			}
+		}
+	}
+	layout(root, 0, 0)
+
+	vt := p.valueType()
+	height := flameHeaderH + (maxDepth+1)*flameFrameH + flameFooterH
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, flameHeader, flameWidth, height, flameWidth, height,
+		flameWidth, flamePad, flameCharWidth, flameTextIndent,
+		flameWidth/2, html.EscapeString(p.title()),
+		height-10, flameWidth-flamePad, flameWidth-flamePad, height-10)
+	for _, r := range rects {
+		share := 100.0
+		if root.value > 0 {
+			share = 100 * float64(r.node.value) / float64(root.value)
+		}
+		x := flamePad + r.x*(flameWidth-2*flamePad)
+		width := r.w * (flameWidth - 2*flamePad)
+		y := height - flameFooterH - (r.depth+1)*flameFrameH
+		name := html.EscapeString(r.node.name)
+		fill := flameColor(r.node.name)
+		if r.depth == 0 {
+			fill = "rgb(200,200,200)"
+		}
+		fmt.Fprintf(bw, `<g class="f" data-n="%s" data-x="%.6f" data-w="%.6f" data-d="%d">`+
+			`<title>%s (%s, %.2f%%)</title>`+
+			`<rect x="%.1f" y="%d" width="%.1f" height="%d" fill="%s" data-c="%s" rx="2"/>`+
+			`<text x="%.1f" y="%d">%s</text></g>`+"\n",
+			name, r.x, r.w, r.depth,
+			name, html.EscapeString(formatValue(r.node.value, vt)), share,
+			x, y, width, flameFrameH-1, fill, fill,
+			x+flameTextIndent, y+flameFrameH-4, html.EscapeString(fitText(r.node.name, width)))
+	}
+	bw.WriteString("</g>\n</svg>\n")
+	return bw.Flush()
+}
+
+// fitText truncates s to what fits in width pixels, the script does the same
+// after zooming
+func fitText(s string, width float64) string {
+	fit := int((width - 2*flameTextIndent) / flameCharWidth)
+	if fit < 3 {
+		return ""
+	}
+	if len(s) <= fit {
+		return s
+	}
+	return s[:fit-2] + ".."
+}
+
+// flameColor picks a stable warm color per function, like flamegraph.pl's hot palette
+func flameColor(name string) string {
+	h := fnv.New32a()
+	h.Write([]byte(name))
+	v := h.Sum32()
+	r := 205 + int(v%50)
+	g := int((v >> 8) % 230)
+	b := int((v >> 16) % 55)
+	return fmt.Sprintf("rgb(%d,%d,%d)", r, g, b)
+}
+
+// flameHeader opens the SVG, frames are appended to the "frames" group
+const flameHeader = `<?xml version="1.0" standalone="no"?>
+<svg version="1.1" width="%d" height="%d" viewBox="0 0 %d %d" onload="init()" xmlns="http://www.w3.org/2000/svg">
+<style>
+text { font-family: Verdana, sans-serif; font-size: 12px; fill: #000; }
+#title { font-size: 17px; }
+.btn { cursor: pointer; fill: #1a4e8a; }
+.f { cursor: pointer; }
+.f:hover rect { stroke: #000; stroke-width: 0.5; }
+.f text { pointer-events: none; }
+</style>
+<script type="text/ecmascript"><![CDATA[
+var W = %d, PAD = %d, CHAR = %d, INDENT = %d;
+var frames, details, reset, matched;
+function init() {
+	frames = Array.prototype.slice.call(document.querySelectorAll("#frames .f"));
+	details = document.getElementById("details");
+	reset = document.getElementById("reset");
+	matched = document.getElementById("matched");
+	frames.forEach(function(g) {
+		g.addEventListener("click", function() { zoom(g); });
+		g.addEventListener("mouseover", function() { details.textContent = g.querySelector("title").textContent; });
+		g.addEventListener("mouseout", function() { details.textContent = " "; });
+	});
+	reset.addEventListener("click", function() { zoom(null); });
+	document.getElementById("search").addEventListener("click", search);
+}
+function num(g, k) { return parseFloat(g.getAttribute("data-" + k)); }
+function zoom(target) {
+	var x0 = 0, w0 = 1, d0 = 0;
+	if (target && num(target, "d") > 0) {
+		x0 = num(target, "x"); w0 = num(target, "w"); d0 = num(target, "d");
+	}
+	reset.style.display = d0 > 0 ? "" : "none";
+	var scale = (W - 2 * PAD) / w0, eps = 1e-9;
+	frames.forEach(function(g) {
+		var x = num(g, "x"), w = num(g, "w"), d = num(g, "d");
+		var ancestor = d < d0 && x <= x0 + eps && x + w >= x0 + w0 - eps;
+		var inside = !ancestor && d >= d0 && x >= x0 - eps && x + w <= x0 + w0 + eps;
+		if (!ancestor && !inside) {
+			g.style.display = "none";
+			return;
+		}
+		g.style.display = "";
+		g.style.opacity = ancestor ? 0.5 : 1;
+		var px = ancestor ? PAD : PAD + (x - x0) * scale;
+		var pw = ancestor ? W - 2 * PAD : w * scale;
+		var rect = g.querySelector("rect"), text = g.querySelector("text");
+		rect.setAttribute("x", px);
+		rect.setAttribute("width", pw);
+		text.setAttribute("x", px + INDENT);
+		var name = g.getAttribute("data-n"), fit = Math.floor((pw - 2 * INDENT) / CHAR);
+		text.textContent = fit < 3 ? "" : name.length <= fit ? name : name.substring(0, fit - 2) + "..";
+	});
+}
+function search() {
+	var term = prompt("Search frames (regexp), empty to clear", "");
+	if (term === null) return;
+	var re = null;
+	if (term !== "") {
+		try { re = new RegExp(term); } catch (e) { alert(e); return; }
+	}
+	var spans = [];
+	frames.forEach(function(g) {
+		var rect = g.querySelector("rect");
+		if (re && re.test(g.getAttribute("data-n"))) {
+			rect.setAttribute("fill", "rgb(230,0,230)");
+			spans.push([num(g, "x"), num(g, "x") + num(g, "w")]);
+		} else {
+			rect.setAttribute("fill", rect.getAttribute("data-c"));
+		}
+	});
+	// nested matches must not be counted twice
+	spans.sort(function(a, b) { return a[0] - b[0]; });
+	var total = 0, end = 0;
+	spans.forEach(function(s) {
+		if (s[1] <= end) return;
+		total += s[1] - Math.max(s[0], end);
+		end = s[1];
+	});
+	matched.textContent = re ? "Matched: " + (100 * total).toFixed(1) + "%%" : " ";
+}
+]]></script>
+<rect x="0" y="0" width="100%%" height="100%%" fill="#f8f8f8"/>
+<text id="title" x="%d" y="24" text-anchor="middle">%s</text>
+<text id="reset" class="btn" x="10" y="24" style="display:none">Reset Zoom</text>
+<text id="details" x="10" y="%d"> </text>
+<text id="search" class="btn" x="%d" y="24" text-anchor="end">Search</text>
+<text id="matched" x="%d" y="%d" text-anchor="end"> </text>
+<g id="frames">
+`
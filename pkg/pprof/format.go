@@ -0,0 +1,95 @@
+package pprof
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// Output formats a profile can be written in
+const (
+	FormatPprof         = "pprof"          // gzipped profile.proto
+	FormatCollapsed     = "collapsed"      // flamegraph.pl input
+	FormatFlameGraphSVG = "flamegraph-svg" // self-contained interactive SVG
+	FormatSpeedscope    = "speedscope"     // https://www.speedscope.app JSON
+)
+
+// Formats lists the supported output formats
+var Formats = []string{FormatPprof, FormatCollapsed, FormatFlameGraphSVG, FormatSpeedscope}
+
+var formatExts = map[string]string{
+	FormatPprof:         ".pb.gz",
+	FormatCollapsed:     ".folded",
+	FormatFlameGraphSVG: ".svg",
+	FormatSpeedscope:    ".speedscope.json",
+}
+
+// FormatExt returns the conventional file extension of format, or an error
+// if the format is unknown
+func FormatExt(format string) (string, error) {
+	ext, ok := formatExts[format]
+	if !ok {
+		return "", fmt.Errorf("unknown format %q, want one of %s", format, strings.Join(Formats, ", "))
+	}
+	return ext, nil
+}
+
+// WriteFormat writes the profile in one of Formats
+func (p *Profile) WriteFormat(w io.Writer, format string) error {
+	switch format {
+	case FormatPprof:
+		return p.Write(w)
+	case FormatCollapsed:
+		return WriteCollapsed(w, p)
+	case FormatFlameGraphSVG:
+		return WriteFlameGraph(w, p)
+	case FormatSpeedscope:
+		return WriteSpeedscope(w, p)
+	}
+	_, err := FormatExt(format)
+	return err
+}
+
+// frameName is how a frame is shown in flame graphs
+func frameName(f Frame) string {
+	if f.Function == "" {
+		return fmt.Sprintf("0x%x", f.PC)
+	}
+	return f.Function
+}
+
+// valueIndex is the sample value flame graphs use, the last one like pprof
+func (p *Profile) valueIndex() int {
+	if len(p.SampleTypes) == 0 {
+		return 0
+	}
+	return len(p.SampleTypes) - 1
+}
+
+func (p *Profile) valueType() ValueType {
+	if len(p.SampleTypes) == 0 {
+		return ValueType{Type: "samples", Unit: "count"}
+	}
+	return p.SampleTypes[p.valueIndex()]
+}
+
+// title names the profile in flame graphs
+func (p *Profile) title() string {
+	if len(p.Comments) > 0 {
+		return p.Comments[0]
+	}
+	return "gospy " + p.valueType().Type + " profile"
+}
+
+// formatValue renders a sample value with its unit, e.g. "1.2s" or "12 goroutine"
+func formatValue(v int64, vt ValueType) string {
+	if vt.Unit == "nanoseconds" {
+		d := time.Duration(v)
+		if d >= time.Millisecond {
+			d = d.Round(time.Microsecond)
+		}
+		return d.String()
+	}
+	return fmt.Sprintf("%d %s", v, vt.Type)
+}
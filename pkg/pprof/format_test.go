@@ -0,0 +1,141 @@
+package pprof
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"io"
+	"strings"
+	"testing"
+)
+
+func testProfile() *Profile {
+	leaf := Frame{PC: 0x10, Function: "main.work", File: "main.go", Line: 10}
+	return &Profile{
+		SampleTypes: []ValueType{{Type: "samples", Unit: "count"}, {Type: "cpu", Unit: "nanoseconds"}},
+		Comments:    []string{"test <profile>"},
+		Samples: []Sample{
+			{Stack: []Frame{leaf, {Function: "main.main"}}, Values: []int64{3, 30}},
+			{Stack: []Frame{{Function: "main.(*T).a"}, {Function: "main.main"}}, Values: []int64{1, 10}},
+			{Stack: []Frame{{PC: 0xbeef}}, Values: []int64{1, 10}},
+		},
+	}
+}
+
+func TestWriteFlameGraph(t *testing.T) {
+	var b bytes.Buffer
+	if err := WriteFlameGraph(&b, testProfile()); err != nil {
+		t.Fatal(err)
+	}
+	// must be well formed, browsers refuse to render broken SVG
+	frames := make(map[string]string) // name -> title
+	dec := xml.NewDecoder(bytes.NewReader(b.Bytes()))
+	var name string
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("invalid SVG: %v", err)
+		}
+		switch tok := tok.(type) {
+		case xml.StartElement:
+			if tok.Name.Local == "g" {
+				for _, a := range tok.Attr {
+					if a.Name.Local == "data-n" {
+						name = a.Value
+					}
+				}
+			}
+			if tok.Name.Local == "title" && name != "" {
+				var title string
+				if err := dec.DecodeElement(&title, &tok); err != nil {
+					t.Fatal(err)
+				}
+				frames[name] = title
+			}
+		}
+	}
+	want := map[string]string{
+		"all":         "all (50ns, 100.00%)",
+		"main.main":   "main.main (40ns, 80.00%)",
+		"main.work":   "main.work (30ns, 60.00%)",
+		"main.(*T).a": "main.(*T).a (10ns, 20.00%)",
+		"0xbeef":      "0xbeef (10ns, 20.00%)",
+	}
+	if len(frames) != len(want) {
+		t.Errorf("got frames %v, want %v", frames, want)
+	}
+	for name, title := range want {
+		if frames[name] != title {
+			t.Errorf("frame %s: got title %q, want %q", name, frames[name], title)
+		}
+	}
+	if !strings.Contains(b.String(), "test &lt;profile&gt;") {
+		t.Error("title not escaped")
+	}
+}
+
+func TestWriteSpeedscope(t *testing.T) {
+	var b bytes.Buffer
+	if err := WriteSpeedscope(&b, testProfile()); err != nil {
+		t.Fatal(err)
+	}
+	var f speedscopeFile
+	if err := json.Unmarshal(b.Bytes(), &f); err != nil {
+		t.Fatal(err)
+	}
+	if len(f.Profiles) != 1 {
+		t.Fatalf("got %d profiles", len(f.Profiles))
+	}
+	p := f.Profiles[0]
+	if p.Unit != "nanoseconds" || p.EndValue != 50 || p.Name != "test <profile>" {
+		t.Errorf("got unit %s, end %d, name %q", p.Unit, p.EndValue, p.Name)
+	}
+	var stacks []string
+	for i, s := range p.Samples {
+		names := make([]string, len(s))
+		for j, id := range s {
+			names[j] = f.Shared.Frames[id].Name
+		}
+		stacks = append(stacks, strings.Join(names, ";")+" "+string(rune('0'+p.Weights[i]/10)))
+	}
+	want := "main.main;main.work 3,main.main;main.(*T).a 1,0xbeef 1"
+	if got := strings.Join(stacks, ","); got != want {
+		t.Errorf("got stacks %s, want %s", got, want)
+	}
+	if len(f.Shared.Frames) != 4 {
+		t.Errorf("got %d frames, want 4: %+v", len(f.Shared.Frames), f.Shared.Frames)
+	}
+}
+
+func TestWriteCollapsed(t *testing.T) {
+	p := testProfile()
+	p.Samples = append(p.Samples,
+		// same functions at another pc, folds into main.main;main.work
+		Sample{Stack: []Frame{{PC: 0x20, Function: "main.work", File: "main.go", Line: 11}, {Function: "main.main"}}, Values: []int64{2, 20}},
+		Sample{Stack: []Frame{{PC: 0xbeef}, {Function: "main.(*T).b;c d"}}, Values: []int64{1, 5}},
+		Sample{Stack: nil, Values: []int64{7, 70}},
+	)
+	var b bytes.Buffer
+	if err := WriteCollapsed(&b, p); err != nil {
+		t.Fatal(err)
+	}
+	// counts are the last value, like the flame graph
+	want := "0xbeef 10\nmain.(*T).b:c_d;0xbeef 5\nmain.main;main.(*T).a 10\nmain.main;main.work 50\n"
+	if b.String() != want {
+		t.Errorf("got:\n%s\nwant:\n%s", b.String(), want)
+	}
+}
+
+func TestFormatExt(t *testing.T) {
+	for _, format := range Formats {
+		if _, err := FormatExt(format); err != nil {
+			t.Errorf("format %s: %v", format, err)
+		}
+	}
+	if err := testProfile().WriteFormat(io.Discard, "svg"); err == nil {
+		t.Error("unknown format accepted")
+	}
+}
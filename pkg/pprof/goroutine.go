@@ -0,0 +1,103 @@
+package pprof
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/monsterxx03/gospy/pkg/proc"
+)
+
+// GoroutineProfile builds the equivalent of runtime/pprof's goroutine profile
+// from an external read: one sample per unique stack, valued by its count
+func GoroutineProfile(reader proc.ProcessMemReader, showDead bool) (*Profile, error) {
+	p := &Profile{
+		SampleTypes: []ValueType{{Type: "goroutine", Unit: "count"}},
+		PeriodType:  ValueType{Type: "goroutine", Unit: "count"},
+		Period:      1,
+		Time:        time.Now(),
+	}
+	var goroutines []proc.G
+	stacks := make(map[string]*Sample)
+	var order []string
+	unreadable := 0
+	err := reader.Frozen(func() error {
+		var err error
+		goroutines, err = reader.Goroutines(showDead)
+		if err != nil {
+			return fmt.Errorf("failed to get goroutines: %w", err)
+		}
+		for _, g := range goroutines {
+			frames, err := reader.StackTrace(g)
+			if err != nil || len(frames) == 0 {
+				unreadable++
+				continue
+			}
+			key := stackKey(frames)
+			if s, ok := stacks[key]; ok {
+				s.Values[0]++
+				continue
+			}
+			stacks[key] = &Sample{Stack: Frames(frames), Values: []int64{1}}
+			order = append(order, key)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, key := range order {
+		p.Samples = append(p.Samples, *stacks[key])
+	}
+	p.Mappings = Mappings(reader)
+	p.Comments = append(p.Comments, fmt.Sprintf("gospy goroutine profile of pid %d, %d goroutines", reader.Pid(), len(goroutines)))
+	if unreadable > 0 {
+		p.Comments = append(p.Comments, fmt.Sprintf("%d goroutines without a readable stack are not included", unreadable))
+	}
+	return p, nil
+}
+
+// StackProfile wraps the stack of goroutine goid in a single sample profile,
+// so one stack can be shared in the same formats as a whole dump
+func StackProfile(reader proc.ProcessMemReader, goid int64, frames []proc.StackFrame) *Profile {
+	return &Profile{
+		SampleTypes: []ValueType{{Type: "goroutine", Unit: "count"}},
+		PeriodType:  ValueType{Type: "goroutine", Unit: "count"},
+		Period:      1,
+		Time:        time.Now(),
+		Samples:     []Sample{{Stack: Frames(frames), Values: []int64{1}}},
+		Mappings:    Mappings(reader),
+		Comments:    []string{fmt.Sprintf("gospy stack of goroutine %d in pid %d", goid, reader.Pid())},
+	}
+}
+
+// Frames converts stack frames read from a target to profile frames
+func Frames(frames []proc.StackFrame) []Frame {
+	out := make([]Frame, len(frames))
+	for i, f := range frames {
+		out[i] = Frame{PC: f.PC, Function: f.Function, File: f.File, Line: f.Line}
+	}
+	return out
+}
+
+// Mappings returns the target's Go modules as profile mappings
+func Mappings(reader proc.ProcessMemReader) []Mapping {
+	modules, _ := reader.Modules()
+	var mappings []Mapping
+	for _, m := range modules {
+		if m.MaxPC == 0 {
+			continue
+		}
+		mappings = append(mappings, Mapping{Start: m.MinPC, Limit: m.MaxPC, File: m.Path})
+	}
+	return mappings
+}
+
+func stackKey(frames []proc.StackFrame) string {
+	var b strings.Builder
+	for _, f := range frames {
+		fmt.Fprintf(&b, "%x,", f.PC)
+	}
+	return b.String()
+}
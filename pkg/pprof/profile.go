@@ -0,0 +1,245 @@
+// Package pprof builds profiles from external reads of Go processes and
+// encodes them as gzipped profile.proto, readable by go tool pprof
+package pprof
+
+import (
+	"compress/gzip"
+	"io"
+	"time"
+)
+
+// ValueType describes the values of a sample, e.g. goroutine/count
+type ValueType struct {
+	Type string
+	Unit string
+}
+
+// Frame is one symbolized stack frame
+type Frame struct {
+	PC       uint64 // 0 if only the symbol is known
+	Function string
+	File     string
+	Line     int
+}
+
+// Mapping is a module mapped in the target
+type Mapping struct {
+	Start, Limit uint64
+	Offset       uint64
+	File         string
+}
+
+// Sample is a stack, leaf first, with one value per sample type
+type Sample struct {
+	Stack  []Frame
+	Values []int64
+	Labels map[string]string
+}
+
+// Profile is the in-memory form of profile.proto, locations and functions are
+// derived from the sample stacks when encoding
+type Profile struct {
+	SampleTypes []ValueType
+	PeriodType  ValueType
+	Period      int64
+	Time        time.Time
+	Duration    time.Duration
+	Mappings    []Mapping
+	Samples     []Sample
+	Comments    []string
+}
+
+// Write writes the profile gzipped, the format go tool pprof reads
+func (p *Profile) Write(w io.Writer) error {
+	zw := gzip.NewWriter(w)
+	if _, err := zw.Write(p.Encode()); err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+// profile.proto field numbers
+const (
+	profileSampleType    = 1
+	profileSample        = 2
+	profileMapping       = 3
+	profileLocation      = 4
+	profileFunction      = 5
+	profileStringTable   = 6
+	profileTimeNanos     = 9
+	profileDurationNanos = 10
+	profilePeriodType    = 11
+	profilePeriod        = 12
+	profileComment       = 13
+
+	valueTypeType = 1
+	valueTypeUnit = 2
+
+	sampleLocationID = 1
+	sampleValue      = 2
+	sampleLabel      = 3
+
+	labelKey = 1
+	labelStr = 2
+
+	mappingID           = 1
+	mappingMemoryStart  = 2
+	mappingMemoryLimit  = 3
+	mappingFileOffset   = 4
+	mappingFilename     = 5
+	mappingHasFunctions = 7
+	mappingHasFilenames = 8
+	mappingHasLineNums  = 9
+
+	locationID        = 1
+	locationMappingID = 2
+	locationAddress   = 3
+	locationLine      = 4
+
+	lineFunctionID = 1
+	lineLine       = 2
+
+	functionID       = 1
+	functionName     = 2
+	functionSysName  = 3
+	functionFilename = 4
+)
+
+// encoder assigns string, function and location ids while encoding
+type encoder struct {
+	strings   []string
+	stringIDs map[string]int64
+	functions map[[2]string]uint64 // name, file
+	locations map[Frame]uint64
+	funcBuf   protobuf
+	locBuf    protobuf
+	mappings  []Mapping
+}
+
+func (e *encoder) str(s string) int64 {
+	if id, ok := e.stringIDs[s]; ok {
+		return id
+	}
+	id := int64(len(e.strings))
+	e.strings = append(e.strings, s)
+	e.stringIDs[s] = id
+	return id
+}
+
+func (e *encoder) function(name, file string) uint64 {
+	key := [2]string{name, file}
+	if id, ok := e.functions[key]; ok {
+		return id
+	}
+	id := uint64(len(e.functions) + 1)
+	e.functions[key] = id
+	var fn protobuf
+	fn.uint64(functionID, id)
+	fn.int64(functionName, e.str(name))
+	fn.int64(functionSysName, e.str(name))
+	fn.int64(functionFilename, e.str(file))
+	e.funcBuf.bytes(profileFunction, fn.data)
+	return id
+}
+
+// mappingFor returns the 1 based id of the mapping containing pc, 0 if none
+func (e *encoder) mappingFor(pc uint64) uint64 {
+	for i, m := range e.mappings {
+		if pc >= m.Start && pc < m.Limit {
+			return uint64(i + 1)
+		}
+	}
+	return 0
+}
+
+func (e *encoder) location(f Frame) uint64 {
+	if id, ok := e.locations[f]; ok {
+		return id
+	}
+	id := uint64(len(e.locations) + 1)
+	e.locations[f] = id
+	var line protobuf
+	line.uint64(lineFunctionID, e.function(f.Function, f.File))
+	line.int64(lineLine, int64(f.Line))
+	var loc protobuf
+	loc.uint64(locationID, id)
+	if f.PC != 0 {
+		loc.uint64(locationMappingID, e.mappingFor(f.PC))
+		loc.uint64(locationAddress, f.PC)
+	}
+	loc.bytes(locationLine, line.data)
+	e.locBuf.bytes(profileLocation, loc.data)
+	return id
+}
+
+// Encode returns the uncompressed profile.proto bytes
+func (p *Profile) Encode() []byte {
+	e := &encoder{
+		stringIDs: make(map[string]int64),
+		functions: make(map[[2]string]uint64),
+		locations: make(map[Frame]uint64),
+		mappings:  p.Mappings,
+	}
+	e.str("") // string_table[0] must be empty
+
+	var b protobuf
+	valueType := func(field int, vt ValueType) {
+		var v protobuf
+		v.int64(valueTypeType, e.str(vt.Type))
+		v.int64(valueTypeUnit, e.str(vt.Unit))
+		b.bytes(field, v.data)
+	}
+	for _, st := range p.SampleTypes {
+		valueType(profileSampleType, st)
+	}
+
+	for _, s := range p.Samples {
+		var sample protobuf
+		ids := make([]uint64, len(s.Stack))
+		for i, f := range s.Stack {
+			ids[i] = e.location(f)
+		}
+		sample.packedUint64(sampleLocationID, ids)
+		sample.packedInt64(sampleValue, s.Values)
+		for _, k := range sortedKeys(s.Labels) {
+			var label protobuf
+			label.int64(labelKey, e.str(k))
+			label.int64(labelStr, e.str(s.Labels[k]))
+			sample.bytes(sampleLabel, label.data)
+		}
+		b.bytes(profileSample, sample.data)
+	}
+
+	for i, m := range p.Mappings {
+		var mapping protobuf
+		mapping.uint64(mappingID, uint64(i+1))
+		mapping.uint64(mappingMemoryStart, m.Start)
+		mapping.uint64(mappingMemoryLimit, m.Limit)
+		mapping.uint64(mappingFileOffset, m.Offset)
+		mapping.int64(mappingFilename, e.str(m.File))
+		// frames are symbolized already, pprof must not try again
+		mapping.bool(mappingHasFunctions, true)
+		mapping.bool(mappingHasFilenames, true)
+		mapping.bool(mappingHasLineNums, true)
+		b.bytes(profileMapping, mapping.data)
+	}
+
+	b.data = append(b.data, e.locBuf.data...)
+	b.data = append(b.data, e.funcBuf.data...)
+
+	if !p.Time.IsZero() {
+		b.int64(profileTimeNanos, p.Time.UnixNano())
+	}
+	b.int64(profileDurationNanos, int64(p.Duration))
+	valueType(profilePeriodType, p.PeriodType)
+	b.int64(profilePeriod, p.Period)
+	for _, c := range p.Comments {
+		b.int64(profileComment, e.str(c))
+	}
+
+	// the string table is complete only now
+	for _, s := range e.strings {
+		b.string(profileStringTable, s)
+	}
+	return b.data
+}
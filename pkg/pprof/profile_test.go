@@ -0,0 +1,122 @@
+package pprof
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"testing"
+)
+
+// field is one decoded protobuf field, varint value or bytes payload
+type field struct {
+	num    int
+	varint uint64
+	data   []byte
+}
+
+func decodeVarint(t *testing.T, b []byte) (uint64, int) {
+	t.Helper()
+	var x uint64
+	for i, c := range b {
+		x |= uint64(c&0x7f) << (7 * i)
+		if c < 0x80 {
+			return x, i + 1
+		}
+	}
+	t.Fatal("truncated varint")
+	return 0, 0
+}
+
+func decodeFields(t *testing.T, b []byte) []field {
+	t.Helper()
+	var fields []field
+	for len(b) > 0 {
+		key, n := decodeVarint(t, b)
+		b = b[n:]
+		f := field{num: int(key >> 3)}
+		switch key & 7 {
+		case wireVarint:
+			f.varint, n = decodeVarint(t, b)
+			b = b[n:]
+		case wireBytes:
+			l, n := decodeVarint(t, b)
+			f.data = b[n : n+int(l)]
+			b = b[n+int(l):]
+		default:
+			t.Fatalf("unexpected wire type %d", key&7)
+		}
+		fields = append(fields, f)
+	}
+	return fields
+}
+
+func TestEncode(t *testing.T) {
+	leaf := Frame{PC: 0x401010, Function: "runtime.gopark", File: "proc.go", Line: 10}
+	p := &Profile{
+		SampleTypes: []ValueType{{Type: "goroutine", Unit: "count"}},
+		PeriodType:  ValueType{Type: "goroutine", Unit: "count"},
+		Period:      1,
+		Mappings:    []Mapping{{Start: 0x401000, Limit: 0x500000, File: "/app"}},
+		Samples: []Sample{
+			{Stack: []Frame{leaf, {PC: 0x402000, Function: "main.a", File: "main.go", Line: 3}}, Values: []int64{5}},
+			{Stack: []Frame{leaf, {PC: 0x403000, Function: "main.b", File: "main.go", Line: 7}}, Values: []int64{2}},
+		},
+	}
+
+	var buf bytes.Buffer
+	if err := p.Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	zr, err := gzip.NewReader(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := io.ReadAll(zr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var strs []string
+	counts := make(map[int]int)
+	var values []uint64
+	for _, f := range decodeFields(t, data) {
+		counts[f.num]++
+		switch f.num {
+		case profileStringTable:
+			strs = append(strs, string(f.data))
+		case profileSample:
+			for _, sf := range decodeFields(t, f.data) {
+				if sf.num == sampleValue {
+					v, _ := decodeVarint(t, sf.data)
+					values = append(values, v)
+				}
+			}
+		}
+	}
+
+	if len(strs) == 0 || strs[0] != "" {
+		t.Fatalf("string table must start with the empty string: %q", strs)
+	}
+	// gopark is shared by both stacks, so 3 locations and 3 functions
+	if counts[profileLocation] != 3 || counts[profileFunction] != 3 {
+		t.Errorf("%d locations, %d functions, want 3 and 3", counts[profileLocation], counts[profileFunction])
+	}
+	if counts[profileMapping] != 1 || counts[profileSample] != 2 {
+		t.Errorf("%d mappings, %d samples, want 1 and 2", counts[profileMapping], counts[profileSample])
+	}
+	if len(values) != 2 || values[0] != 5 || values[1] != 2 {
+		t.Errorf("sample values %v, want [5 2]", values)
+	}
+	seen := make(map[string]bool)
+	for _, s := range strs {
+		if seen[s] {
+			t.Errorf("string %q interned twice", s)
+		}
+		seen[s] = true
+	}
+	for _, want := range []string{"goroutine", "count", "runtime.gopark", "main.a", "main.b", "/app"} {
+		if !seen[want] {
+			t.Errorf("string table misses %q", want)
+		}
+	}
+}
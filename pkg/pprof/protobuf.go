@@ -0,0 +1,88 @@
+package pprof
+
+import "sort"
+
+// protobuf appends protocol buffer fields, just the wire types profile.proto uses
+type protobuf struct {
+	data []byte
+}
+
+const (
+	wireVarint = 0
+	wireBytes  = 2
+)
+
+func (b *protobuf) varint(x uint64) {
+	for x >= 0x80 {
+		b.data = append(b.data, byte(x)|0x80)
+		x >>= 7
+	}
+	b.data = append(b.data, byte(x))
+}
+
+func (b *protobuf) key(field, wire int) {
+	b.varint(uint64(field)<<3 | uint64(wire))
+}
+
+// uint64 writes a varint field, zero values are omitted as in proto3
+func (b *protobuf) uint64(field int, x uint64) {
+	if x == 0 {
+		return
+	}
+	b.key(field, wireVarint)
+	b.varint(x)
+}
+
+func (b *protobuf) int64(field int, x int64) {
+	b.uint64(field, uint64(x))
+}
+
+func (b *protobuf) bool(field int, x bool) {
+	if x {
+		b.uint64(field, 1)
+	}
+}
+
+func (b *protobuf) bytes(field int, x []byte) {
+	b.key(field, wireBytes)
+	b.varint(uint64(len(x)))
+	b.data = append(b.data, x...)
+}
+
+// string always writes the field, the empty string table entry must be present
+func (b *protobuf) string(field int, s string) {
+	b.key(field, wireBytes)
+	b.varint(uint64(len(s)))
+	b.data = append(b.data, s...)
+}
+
+func (b *protobuf) packedUint64(field int, xs []uint64) {
+	if len(xs) == 0 {
+		return
+	}
+	var packed protobuf
+	for _, x := range xs {
+		packed.varint(x)
+	}
+	b.bytes(field, packed.data)
+}
+
+func (b *protobuf) packedInt64(field int, xs []int64) {
+	if len(xs) == 0 {
+		return
+	}
+	var packed protobuf
+	for _, x := range xs {
+		packed.varint(uint64(x))
+	}
+	b.bytes(field, packed.data)
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
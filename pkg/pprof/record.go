@@ -0,0 +1,301 @@
+package pprof
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/monsterxx03/gospy/pkg/proc"
+)
+
+// maxRate bounds the sample rate, every sample stops each running thread
+const maxRate = 1000
+
+// Mode selects what a recording samples
+type Mode string
+
+const (
+	// ModeCPU samples the goroutines running on a thread the kernel has on CPU
+	ModeCPU Mode = "cpu"
+	// ModeOffCPU samples the goroutines blocked in a wait state or a syscall
+	ModeOffCPU Mode = "offcpu"
+)
+
+// WaitReasonLabel is the sample label holding the wait reason in off-CPU profiles
+const WaitReasonLabel = "wait_reason"
+
+// RecordOptions controls a sampling recording
+type RecordOptions struct {
+	Duration time.Duration // stop after this long, 0 records until ctx is done
+	Rate     int           // samples per second
+	Mode     Mode          // ModeCPU if empty
+}
+
+// Record periodically samples the target and builds a profile, driven from
+// outside instead of by runtime/pprof. Recording stops early when ctx is done
+// or the target exits; what was sampled until then is still returned.
+//
+// ModeCPU counts the goroutines of threads the kernel reports on CPU, like a
+// CPU profile, and needs a local target built for amd64 or arm64. ModeOffCPU weights the stack of every blocked goroutine by the
+// wall time it was seen blocked for, labeled with its wait reason, like a
+// block profile but covering all wait states, without SetBlockProfileRate.
+func Record(ctx context.Context, reader proc.ProcessMemReader, opts RecordOptions) (*Profile, error) {
+	if opts.Rate <= 0 {
+		return nil, errors.New("sample rate must be positive")
+	}
+	switch opts.Mode {
+	case "", ModeCPU:
+		return recordCPU(ctx, reader, opts)
+	case ModeOffCPU:
+		return recordOffCPU(ctx, reader, opts)
+	}
+	return nil, fmt.Errorf("unknown recording mode %q", opts.Mode)
+}
+
+func recordCPU(ctx context.Context, reader proc.ProcessMemReader, opts RecordOptions) (*Profile, error) {
+	if err := proc.CheckThreadUnwinding(reader); err != nil {
+		return nil, fmt.Errorf("cpu profiles need on-CPU stacks: %w", err)
+	}
+	// the first sample loads symbols and type offsets, keep it out of the recording
+	if _, err := reader.SampleThreads(); err != nil {
+		return nil, fmt.Errorf("failed to sample threads: %w", err)
+	}
+	counter := newStackCounter(opts.Rate)
+	p := &Profile{
+		SampleTypes: []ValueType{{Type: "samples", Unit: "count"}, {Type: "cpu", Unit: "nanoseconds"}},
+		PeriodType:  ValueType{Type: "cpu", Unit: "nanoseconds"},
+		Period:      counter.period,
+		Time:        time.Now(),
+	}
+	onCPU, approximate := 0, 0
+	ticks, stopErr := runTicks(ctx, opts, func(elapsed time.Duration) error {
+		threads, err := reader.SampleThreads()
+		if err != nil {
+			return err
+		}
+		for _, t := range threads {
+			if !t.OnCPU || len(t.Frames) == 0 {
+				continue
+			}
+			onCPU++
+			if !t.Exact {
+				approximate++
+			}
+			counter.add(t.Frames, nil, elapsed)
+		}
+		return nil
+	})
+	p.Duration = time.Since(p.Time)
+	p.Samples = counter.samples()
+	p.Mappings = Mappings(reader)
+	p.Comments = append(p.Comments,
+		fmt.Sprintf("gospy cpu profile of pid %d, %d ticks with %d threads on cpu over %s (%.0f Hz, %d Hz requested)",
+			reader.Pid(), ticks, onCPU, p.Duration.Round(time.Millisecond), float64(ticks)/p.Duration.Seconds(), opts.Rate))
+	checkRate(p, ticks, opts.Rate)
+	if approximate > 0 {
+		p.Comments = append(p.Comments, fmt.Sprintf("%d samples use the goroutine's last scheduled pc, registers were unavailable", approximate))
+	}
+	if stopErr != nil {
+		p.Comments = append(p.Comments, fmt.Sprintf("recording stopped early: %v", stopErr))
+	}
+	return p, nil
+}
+
+func recordOffCPU(ctx context.Context, reader proc.ProcessMemReader, opts RecordOptions) (*Profile, error) {
+	// a blocked goroutine's stack doesn't change until it runs again, so stacks
+	// are reused for as long as the goroutine stays at the same sched pc/sp
+	type stackID struct {
+		goid   int64
+		pc, sp uint64
+	}
+	stacks := make(map[stackID][]proc.StackFrame)
+	sample := func() ([]proc.G, error) {
+		goroutines, err := reader.Goroutines(false)
+		if err != nil {
+			return nil, err
+		}
+		seen := make(map[stackID][]proc.StackFrame, len(stacks))
+		for _, g := range goroutines {
+			if !blocked(g) {
+				continue
+			}
+			id := stackID{g.Goid, g.Sched.PC, g.Sched.SP}
+			frames, ok := stacks[id]
+			if !ok {
+				frames, _ = reader.StackTrace(g)
+			}
+			seen[id] = frames
+		}
+		stacks = seen
+		return goroutines, nil
+	}
+	if _, err := sample(); err != nil {
+		return nil, fmt.Errorf("failed to get goroutines: %w", err)
+	}
+
+	counter := newStackCounter(opts.Rate)
+	p := &Profile{
+		SampleTypes: []ValueType{{Type: "samples", Unit: "count"}, {Type: "delay", Unit: "nanoseconds"}},
+		PeriodType:  ValueType{Type: "delay", Unit: "nanoseconds"},
+		Period:      counter.period,
+		Time:        time.Now(),
+	}
+	blockedSamples, unreadable := 0, 0
+	ticks, stopErr := runTicks(ctx, opts, func(elapsed time.Duration) error {
+		goroutines, err := sample()
+		if err != nil {
+			return err
+		}
+		for _, g := range goroutines {
+			if !blocked(g) {
+				continue
+			}
+			frames := stacks[stackID{g.Goid, g.Sched.PC, g.Sched.SP}]
+			if len(frames) == 0 {
+				unreadable++
+				continue
+			}
+			blockedSamples++
+			counter.add(frames, map[string]string{WaitReasonLabel: waitReason(g)}, elapsed)
+		}
+		return nil
+	})
+	p.Duration = time.Since(p.Time)
+	p.Samples = counter.samples()
+	p.Mappings = Mappings(reader)
+	p.Comments = append(p.Comments,
+		fmt.Sprintf("gospy off-cpu profile of pid %d, %d ticks with %d blocked goroutines over %s (%.0f Hz, %d Hz requested)",
+			reader.Pid(), ticks, blockedSamples, p.Duration.Round(time.Millisecond), float64(ticks)/p.Duration.Seconds(), opts.Rate))
+	checkRate(p, ticks, opts.Rate)
+	if unreadable > 0 {
+		p.Comments = append(p.Comments, fmt.Sprintf("%d samples of goroutines without a readable stack are not included", unreadable))
+	}
+	if stopErr != nil {
+		p.Comments = append(p.Comments, fmt.Sprintf("recording stopped early: %v", stopErr))
+	}
+	return p, nil
+}
+
+// blocked reports whether g is off CPU for a reason of its own, runnable
+// goroutines are waiting for a P and show up as scheduling latency instead
+func blocked(g proc.G) bool {
+	switch strings.TrimPrefix(g.Status, "scan") {
+	case "waiting", "syscall":
+		return true
+	}
+	return false
+}
+
+func waitReason(g proc.G) string {
+	if strings.TrimPrefix(g.Status, "scan") == "syscall" {
+		return "syscall"
+	}
+	if g.WaitReason == "" {
+		return "unknown"
+	}
+	return g.WaitReason
+}
+
+// runTicks calls sample at the end of every sampling period until ctx is done, the
+// duration elapsed or sample fails. sample gets the wall time since the previous
+// sample, which is what it stands for: when a read takes longer than a period the
+// ticker drops ticks, so a sample can cover much more than 1/rate. A sample that
+// would likely end past the deadline, judging by the previous one, isn't started.
+// It returns the number of samples taken and the error that stopped it early.
+func runTicks(ctx context.Context, opts RecordOptions, sample func(elapsed time.Duration) error) (int, error) {
+	var deadline time.Time
+	if opts.Duration > 0 {
+		deadline = time.Now().Add(opts.Duration)
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithDeadline(ctx, deadline)
+		defer cancel()
+	}
+	ticker := time.NewTicker(time.Second / time.Duration(opts.Rate))
+	defer ticker.Stop()
+	// each sample stands for the time since the one before it, n periods take n samples
+	ticks := 0
+	last := time.Now()
+	var cost time.Duration // how long the previous sample took
+	for {
+		select {
+		case <-ctx.Done():
+			return ticks, nil
+		case <-ticker.C:
+		}
+		start := time.Now()
+		if !deadline.IsZero() && start.Add(cost).After(deadline) {
+			return ticks, nil
+		}
+		if err := sample(start.Sub(last)); err != nil {
+			// most likely the target exited
+			return ticks, err
+		}
+		last = start
+		cost = time.Since(start)
+		ticks++
+	}
+}
+
+// checkRate warns when reads were too slow to keep up with the requested
+// rate. Samples are weighted by elapsed time so the profile stays accurate,
+// but it has less resolution than asked for.
+func checkRate(p *Profile, ticks, rate int) {
+	achieved := float64(ticks) / p.Duration.Seconds()
+	if achieved >= float64(rate)/2 {
+		return
+	}
+	msg := fmt.Sprintf("achieved %.0f Hz, far below the requested %d Hz: each sample takes longer than a period, lower --rate", achieved, rate)
+	log.Printf("WARNING: %s", msg)
+	p.Comments = append(p.Comments, msg)
+}
+
+// stackCounter sums samples per unique stack and labels, each worth the wall
+// time since the previous sample
+type stackCounter struct {
+	period int64 // nominal sampling period, for Profile.Period
+	byKey  map[string]*Sample
+	order  []string
+}
+
+func newStackCounter(rate int) *stackCounter {
+	return &stackCounter{period: int64(time.Second) / int64(rate), byKey: make(map[string]*Sample)}
+}
+
+func (c *stackCounter) add(frames []proc.StackFrame, labels map[string]string, elapsed time.Duration) {
+	key := stackKey(frames)
+	for _, k := range sortedKeys(labels) {
+		key += k + "=" + labels[k] + ","
+	}
+	if s, ok := c.byKey[key]; ok {
+		s.Values[0]++
+		s.Values[1] += int64(elapsed)
+		return
+	}
+	c.byKey[key] = &Sample{Stack: Frames(frames), Values: []int64{1, int64(elapsed)}, Labels: labels}
+	c.order = append(c.order, key)
+}
+
+func (c *stackCounter) samples() []Sample {
+	samples := make([]Sample, 0, len(c.order))
+	for _, key := range c.order {
+		samples = append(samples, *c.byKey[key])
+	}
+	return samples
+}
+
+// ParseRate parses a sampling rate such as "100hz", "100Hz" or "100"
+func ParseRate(s string) (int, error) {
+	n := strings.TrimSuffix(strings.ToLower(strings.TrimSpace(s)), "hz")
+	rate, err := strconv.Atoi(n)
+	if err != nil || rate <= 0 {
+		return 0, fmt.Errorf("invalid sample rate %q, want e.g. 100hz", s)
+	}
+	if rate > maxRate {
+		return 0, fmt.Errorf("sample rate %q is above the maximum of %dhz", s, maxRate)
+	}
+	return rate, nil
+}
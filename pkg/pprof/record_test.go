@@ -0,0 +1,76 @@
+package pprof
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestParseRate(t *testing.T) {
+	for in, want := range map[string]int{"100hz": 100, "99Hz": 99, " 250 ": 250, "1000HZ": 1000} {
+		got, err := ParseRate(in)
+		if err != nil || got != want {
+			t.Errorf("ParseRate(%q) = %d, %v, want %d", in, got, err, want)
+		}
+	}
+	for _, in := range []string{"", "hz", "0hz", "-5hz", "10khz", "1001hz"} {
+		if _, err := ParseRate(in); err == nil {
+			t.Errorf("ParseRate(%q) succeeded", in)
+		}
+	}
+}
+
+func TestRunTicksSlowSamples(t *testing.T) {
+	// reads take 3 periods, every sample must cover the time since the
+	// previous one and the recording must not run past its duration
+	opts := RecordOptions{Duration: 200 * time.Millisecond, Rate: 100}
+	var covered time.Duration
+	start := time.Now()
+	ticks, err := runTicks(context.Background(), opts, func(elapsed time.Duration) error {
+		covered += elapsed
+		time.Sleep(30 * time.Millisecond)
+		return nil
+	})
+	took := time.Since(start)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ticks == 0 || ticks > 7 {
+		t.Errorf("got %d ticks, want 1-7 at 30ms per sample", ticks)
+	}
+	if covered < 150*time.Millisecond || covered > opts.Duration {
+		t.Errorf("samples cover %s of a %s recording", covered, opts.Duration)
+	}
+	if took > opts.Duration+20*time.Millisecond {
+		t.Errorf("recording took %s, past its %s duration", took, opts.Duration)
+	}
+}
+
+func TestWaitReasons(t *testing.T) {
+	chanRecv := []Frame{{Function: "runtime.gopark"}, {Function: "runtime.chanrecv1"}, {Function: "main.worker"}}
+	lock := []Frame{{Function: "runtime.gopark"}, {Function: "sync.(*Mutex).Lock"}, {Function: "github.com/x/db.(*Pool).Get"}, {Function: "main.handler"}}
+	select_ := []Frame{{Function: "runtime.gopark"}, {Function: "runtime.selectgo"}, {Function: "runtime.bgsweep"}, {Function: "runtime.goexit"}}
+	p := &Profile{
+		Duration: time.Second,
+		Samples: []Sample{
+			{Stack: chanRecv, Values: []int64{10, 1e9}, Labels: map[string]string{WaitReasonLabel: "chan receive"}},
+			{Stack: lock, Values: []int64{20, 2e9}, Labels: map[string]string{WaitReasonLabel: "sync.Mutex.Lock"}},
+			{Stack: chanRecv[:2], Values: []int64{5, 5e8}, Labels: map[string]string{WaitReasonLabel: "chan receive"}},
+			{Stack: select_, Values: []int64{5, 5e8}, Labels: map[string]string{WaitReasonLabel: "select"}},
+		},
+	}
+	want := []WaitReasonStat{
+		{Reason: "sync.Mutex.Lock", Samples: 20, Blocked: 2 * time.Second, Share: 0.5, AvgGoroutines: 2, TopCaller: "github.com/x/db.(*Pool).Get"},
+		{Reason: "chan receive", Samples: 15, Blocked: 1500 * time.Millisecond, Share: 0.375, AvgGoroutines: 1.5, TopCaller: "main.worker"},
+		{Reason: "select", Samples: 5, Blocked: 500 * time.Millisecond, Share: 0.125, AvgGoroutines: 0.5, TopCaller: "runtime.bgsweep"},
+	}
+	got := WaitReasons(p)
+	if len(got) != len(want) {
+		t.Fatalf("got %d reasons, want %d: %+v", len(got), len(want), got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("reason %d:\ngot  %+v\nwant %+v", i, got[i], want[i])
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package pprof
+
+import (
+	"encoding/json"
+	"io"
+)
+
+// speedscope's file format, see
+// https://github.com/jlfwong/speedscope/blob/main/src/lib/file-format-spec.ts
+type speedscopeFile struct {
+	Schema             string              `json:"$schema"`
+	Shared             speedscopeShared    `json:"shared"`
+	Profiles           []speedscopeProfile `json:"profiles"`
+	Name               string              `json:"name"`
+	ActiveProfileIndex int                 `json:"activeProfileIndex"`
+	Exporter           string              `json:"exporter"`
+}
+
+type speedscopeShared struct {
+	Frames []speedscopeFrame `json:"frames"`
+}
+
+type speedscopeFrame struct {
+	Name string `json:"name"`
+	File string `json:"file,omitempty"`
+}
+
+type speedscopeProfile struct {
+	Type       string  `json:"type"`
+	Name       string  `json:"name"`
+	Unit       string  `json:"unit"`
+	StartValue int64   `json:"startValue"`
+	EndValue   int64   `json:"endValue"`
+	Samples    [][]int `json:"samples"` // frame indexes, root first
+	Weights    []int64 `json:"weights"`
+}
+
+// WriteSpeedscope writes the profile as a speedscope sampled profile, weighted
+// by the last sample value like pprof's default view
+func WriteSpeedscope(w io.Writer, p *Profile) error {
+	vt := p.valueType()
+	unit := "none"
+	if vt.Unit == "nanoseconds" {
+		unit = "nanoseconds"
+	}
+	prof := speedscopeProfile{
+		Type:    "sampled",
+		Name:    p.title(),
+		Unit:    unit,
+		Samples: [][]int{},
+		Weights: []int64{},
+	}
+	file := speedscopeFile{
+		Schema:   "https://www.speedscope.app/file-format-schema.json",
+		Shared:   speedscopeShared{Frames: []speedscopeFrame{}},
+		Name:     p.title(),
+		Exporter: "gospy",
+	}
+
+	// frames are functions, the lines of different call sites would split them
+	frameIDs := make(map[[2]string]int)
+	idx := p.valueIndex()
+	for _, s := range p.Samples {
+		if idx >= len(s.Values) || len(s.Stack) == 0 {
+			continue
+		}
+		stack := make([]int, len(s.Stack))
+		for i, f := range s.Stack {
+			key := [2]string{frameName(f), f.File}
+			id, ok := frameIDs[key]
+			if !ok {
+				id = len(file.Shared.Frames)
+				frameIDs[key] = id
+				file.Shared.Frames = append(file.Shared.Frames, speedscopeFrame{Name: key[0], File: key[1]})
+			}
+			stack[len(s.Stack)-1-i] = id
+		}
+		prof.Samples = append(prof.Samples, stack)
+		prof.Weights = append(prof.Weights, s.Values[idx])
+		prof.EndValue += s.Values[idx]
+	}
+	file.Profiles = []speedscopeProfile{prof}
+	return json.NewEncoder(w).Encode(file)
+}
@@ -0,0 +1,98 @@
+package pprof
+
+import (
+	"sort"
+	"strings"
+	"time"
+)
+
+// WaitReasonStat is the blocked time an off-CPU profile attributes to one wait reason
+type WaitReasonStat struct {
+	Reason        string
+	Samples       int64
+	Blocked       time.Duration // summed over goroutines
+	Share         float64       // of all blocked time, 0-1
+	AvgGoroutines float64       // goroutines blocked for this reason at any time, on average
+	TopCaller     string        // the caller outside the standard library blocked the longest
+}
+
+// WaitReasons summarizes an off-CPU profile by wait reason, most blocked first
+func WaitReasons(p *Profile) []WaitReasonStat {
+	stats := make(map[string]*WaitReasonStat)
+	callers := make(map[string]map[string]int64)
+	var total int64
+	for _, s := range p.Samples {
+		if len(s.Values) < 2 {
+			continue
+		}
+		reason := s.Labels[WaitReasonLabel]
+		st, ok := stats[reason]
+		if !ok {
+			st = &WaitReasonStat{Reason: reason}
+			stats[reason] = st
+			callers[reason] = make(map[string]int64)
+		}
+		st.Samples += s.Values[0]
+		st.Blocked += time.Duration(s.Values[1])
+		total += s.Values[1]
+		if caller := blockingCaller(s.Stack); caller != "" {
+			callers[reason][caller] += s.Values[1]
+		}
+	}
+
+	out := make([]WaitReasonStat, 0, len(stats))
+	for reason, st := range stats {
+		if total > 0 {
+			st.Share = float64(st.Blocked) / float64(total)
+		}
+		if p.Duration > 0 {
+			st.AvgGoroutines = float64(st.Blocked) / float64(p.Duration)
+		}
+		var top int64
+		for caller, blocked := range callers[reason] {
+			if blocked > top || (blocked == top && caller < st.TopCaller) {
+				st.TopCaller, top = caller, blocked
+			}
+		}
+		out = append(out, *st)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Blocked != out[j].Blocked {
+			return out[i].Blocked > out[j].Blocked
+		}
+		return out[i].Reason < out[j].Reason
+	})
+	return out
+}
+
+// blockingCaller returns the innermost frame outside the standard library. If
+// the whole stack is in it, e.g. for runtime background workers, the
+// goroutine's entry function says more than the leaf, which is always gopark.
+func blockingCaller(stack []Frame) string {
+	for _, f := range stack {
+		if !isStdFunc(f.Function) {
+			return f.Function
+		}
+	}
+	for i := len(stack) - 1; i >= 0; i-- {
+		if stack[i].Function != "runtime.goexit" {
+			return stack[i].Function
+		}
+	}
+	return ""
+}
+
+// isStdFunc reports whether a function belongs to the standard library, whose
+// import paths have no dot in their first element
+func isStdFunc(name string) bool {
+	if name == "" {
+		return true
+	}
+	first := name
+	if i := strings.IndexByte(first, '/'); i >= 0 {
+		first = first[:i]
+	} else if i := strings.IndexByte(first, '.'); i >= 0 {
+		first = first[:i]
+	}
+	return first != "main" && !strings.Contains(first, ".")
+}
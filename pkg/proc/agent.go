@@ -0,0 +1,250 @@
+package proc
+
+import (
+	"bufio"
+	"crypto/tls"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// The agent protocol lets gospy read a process on another host through
+// `gospy agent`, which only serves raw memory, /proc/<pid>/maps and the files
+// mapped by the process. Symbols and DWARF are decoded on the client.
+//
+// Both sides first send agentHello, then the client sends requests and the
+// agent answers each in order:
+//
+//	request:  u32 length | u8 op     | body
+//	response: u32 length | u8 status | body, an error message unless status is 0
+//
+// Integers are little endian, the bodies are:
+//
+//	agentOpOpen:     u32 pid -> AgentTarget as JSON
+//	agentOpRead:     u32 pid | u32 n | n x (u64 addr | u32 size) -> n x u32 bytes read | the bytes
+//	agentOpReadFile: u32 pid | u64 offset | u32 size | path, "" for the executable -> the bytes, short at EOF
+//	agentOpMaps:     u32 pid -> /proc/<pid>/maps
+//
+// Other requests for a pid are only answered after it was opened on the connection.
+
+const agentHello = "GOSPYAG\x01"
+
+const (
+	agentOpOpen byte = iota + 1
+	agentOpRead
+	agentOpReadFile
+	agentOpMaps
+)
+
+const (
+	agentStatusOK  byte = 0
+	agentStatusErr byte = 1
+)
+
+const (
+	maxAgentFrame  = 32 << 20
+	maxAgentRead   = 16 << 20 // bytes per agentOpRead, larger batches are split
+	maxAgentRanges = 1 << 16  // ranges per agentOpRead
+	agentFileChunk = 4 << 20  // bytes per agentOpReadFile
+	agentTimeout   = 30 * time.Second
+)
+
+// AgentTarget describes a process opened through the agent
+type AgentTarget struct {
+	PID        int    `json:"pid"`
+	Exe        string `json:"exe"` // executable path in the target's mount namespace
+	ExeSize    int64  `json:"exe_size"`
+	GNUBuildID string `json:"gnu_build_id,omitempty"`
+	GoBuildID  string `json:"go_build_id,omitempty"`
+	Auxv       []byte `json:"auxv"`               // /proc/<pid>/auxv, for the static base
+	Nanotime   int64  `json:"nanotime,omitempty"` // the host's runtime.nanotime when the target was opened
+}
+
+func writeAgentFrame(w *bufio.Writer, kind byte, body []byte) error {
+	var header [5]byte
+	binary.LittleEndian.PutUint32(header[:], uint32(len(body)+1))
+	header[4] = kind
+	if _, err := w.Write(header[:]); err != nil {
+		return err
+	}
+	if _, err := w.Write(body); err != nil {
+		return err
+	}
+	return w.Flush()
+}
+
+func readAgentFrame(r io.Reader) (byte, []byte, error) {
+	var header [5]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return 0, nil, err
+	}
+	n := binary.LittleEndian.Uint32(header[:])
+	if n == 0 || n > maxAgentFrame {
+		return 0, nil, fmt.Errorf("invalid agent frame of %d bytes", n)
+	}
+	body := make([]byte, n-1)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return 0, nil, err
+	}
+	return header[4], body, nil
+}
+
+// agentHandshake exchanges agentHello on a new connection
+func agentHandshake(conn net.Conn, rw *bufio.ReadWriter) error {
+	conn.SetDeadline(time.Now().Add(agentTimeout))
+	defer conn.SetDeadline(time.Time{})
+	if _, err := rw.WriteString(agentHello); err != nil {
+		return err
+	}
+	if err := rw.Flush(); err != nil {
+		return err
+	}
+	hello := make([]byte, len(agentHello))
+	if _, err := io.ReadFull(rw, hello); err != nil {
+		return err
+	}
+	if string(hello) != agentHello {
+		return errors.New("peer is not a gospy agent of this version")
+	}
+	return nil
+}
+
+// agentClient is a connection to an agent, requests are serialized
+type agentClient struct {
+	mu   sync.Mutex
+	conn net.Conn
+	rw   *bufio.ReadWriter
+}
+
+// dialAgent connects to addr, a unix socket as unix:/path or a host:port
+// reached with tlsConfig
+func dialAgent(addr string, tlsConfig *tls.Config) (*agentClient, error) {
+	var conn net.Conn
+	var err error
+	if path, ok := strings.CutPrefix(addr, "unix:"); ok {
+		conn, err = net.DialTimeout("unix", path, agentTimeout)
+	} else {
+		if tlsConfig == nil {
+			return nil, errors.New("agents are only reachable over TCP with TLS")
+		}
+		dialer := &tls.Dialer{NetDialer: &net.Dialer{Timeout: agentTimeout}, Config: tlsConfig}
+		conn, err = dialer.Dial("tcp", addr)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to agent %s: %w", addr, err)
+	}
+	c := &agentClient{conn: conn, rw: bufio.NewReadWriter(bufio.NewReader(conn), bufio.NewWriter(conn))}
+	if err := agentHandshake(conn, c.rw); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to connect to agent %s: %w", addr, err)
+	}
+	return c, nil
+}
+
+func (c *agentClient) Close() error {
+	return c.conn.Close()
+}
+
+// call sends one request and waits for its response
+func (c *agentClient) call(op byte, body []byte) ([]byte, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.conn.SetDeadline(time.Now().Add(agentTimeout))
+	defer c.conn.SetDeadline(time.Time{})
+	if err := writeAgentFrame(c.rw.Writer, op, body); err != nil {
+		return nil, fmt.Errorf("agent request failed: %w", err)
+	}
+	status, resp, err := readAgentFrame(c.rw)
+	if err != nil {
+		return nil, fmt.Errorf("agent request failed: %w", err)
+	}
+	if status != agentStatusOK {
+		return nil, fmt.Errorf("agent: %s", resp)
+	}
+	return resp, nil
+}
+
+func (c *agentClient) open(pid int) (*AgentTarget, error) {
+	resp, err := c.call(agentOpOpen, binary.LittleEndian.AppendUint32(nil, uint32(pid)))
+	if err != nil {
+		return nil, err
+	}
+	var t AgentTarget
+	if err := json.Unmarshal(resp, &t); err != nil {
+		return nil, fmt.Errorf("invalid agent response: %w", err)
+	}
+	return &t, nil
+}
+
+// readBatch reads bufs[i] from addrs[i] in as few round trips as the frame
+// limits allow, and returns how many bytes of each were read
+func (c *agentClient) readBatch(pid int, addrs []uint64, bufs [][]byte) ([]int, error) {
+	counts := make([]int, 0, len(bufs))
+	for start := 0; start < len(bufs); {
+		end, size := start, 0
+		for end < len(bufs) && end-start < maxAgentRanges && (end == start || size+len(bufs[end]) <= maxAgentRead) {
+			size += len(bufs[end])
+			end++
+		}
+		if size > maxAgentRead {
+			return counts, fmt.Errorf("read of %d bytes at 0x%x is too large", size, addrs[start])
+		}
+		req := binary.LittleEndian.AppendUint32(nil, uint32(pid))
+		req = binary.LittleEndian.AppendUint32(req, uint32(end-start))
+		for i := start; i < end; i++ {
+			req = binary.LittleEndian.AppendUint64(req, addrs[i])
+			req = binary.LittleEndian.AppendUint32(req, uint32(len(bufs[i])))
+		}
+		resp, err := c.call(agentOpRead, req)
+		if err != nil {
+			return counts, err
+		}
+		data := resp[min(len(resp), 4*(end-start)):]
+		for i := start; i < end; i++ {
+			if len(resp) < 4 {
+				return counts, errors.New("truncated agent response")
+			}
+			n := int(binary.LittleEndian.Uint32(resp))
+			resp = resp[4:]
+			if n > len(bufs[i]) || n > len(data) {
+				return counts, errors.New("truncated agent response")
+			}
+			copy(bufs[i], data[:n])
+			data = data[n:]
+			counts = append(counts, n)
+		}
+		start = end
+	}
+	return counts, nil
+}
+
+// readFile copies the file the target maps at path, "" for its executable, to w
+func (c *agentClient) readFile(pid int, path string, w io.Writer) error {
+	for off := uint64(0); ; {
+		req := binary.LittleEndian.AppendUint32(nil, uint32(pid))
+		req = binary.LittleEndian.AppendUint64(req, off)
+		req = binary.LittleEndian.AppendUint32(req, agentFileChunk)
+		req = append(req, path...)
+		resp, err := c.call(agentOpReadFile, req)
+		if err != nil {
+			return err
+		}
+		if _, err := w.Write(resp); err != nil {
+			return err
+		}
+		if len(resp) < agentFileChunk {
+			return nil
+		}
+		off += uint64(len(resp))
+	}
+}
+
+func (c *agentClient) maps(pid int) ([]byte, error) {
+	return c.call(agentOpMaps, binary.LittleEndian.AppendUint32(nil, uint32(pid)))
+}
@@ -0,0 +1,217 @@
+//go:build linux
+
+package proc
+
+import (
+	"bufio"
+	"bytes"
+	"debug/elf"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	bin "github.com/monsterxx03/gospy/pkg/binary"
+)
+
+// agentIdleTimeout closes connections of clients that went away silently
+const agentIdleTimeout = 10 * time.Minute
+
+// ServeAgent answers agent protocol requests on l for the processes allow
+// permits, until accepting fails. It never writes to or stops a target.
+func ServeAgent(l net.Listener, allow *Allowlist) error {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return err
+		}
+		go func() {
+			defer conn.Close()
+			s := &agentSession{allow: allow, targets: make(map[int]*os.File), peer: conn.RemoteAddr().String()}
+			defer s.close()
+			if err := s.serve(conn); err != nil && !errors.Is(err, io.EOF) {
+				log.Printf("agent: %s: %v", s.peer, err)
+			}
+		}()
+	}
+}
+
+// agentSession is one client connection and the targets it opened
+type agentSession struct {
+	allow   *Allowlist
+	targets map[int]*os.File // pid -> /proc/<pid>/mem
+	peer    string
+}
+
+func (s *agentSession) close() {
+	for _, fd := range s.targets {
+		fd.Close()
+	}
+}
+
+func (s *agentSession) serve(conn net.Conn) error {
+	rw := bufio.NewReadWriter(bufio.NewReader(conn), bufio.NewWriter(conn))
+	if err := agentHandshake(conn, rw); err != nil {
+		return err
+	}
+	for {
+		conn.SetReadDeadline(time.Now().Add(agentIdleTimeout))
+		op, body, err := readAgentFrame(rw)
+		if err != nil {
+			return err
+		}
+		conn.SetWriteDeadline(time.Now().Add(agentTimeout))
+		resp, err := s.handle(op, body)
+		if err != nil {
+			err = writeAgentFrame(rw.Writer, agentStatusErr, []byte(err.Error()))
+		} else {
+			err = writeAgentFrame(rw.Writer, agentStatusOK, resp)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func (s *agentSession) handle(op byte, body []byte) ([]byte, error) {
+	if len(body) < 4 {
+		return nil, errors.New("malformed request")
+	}
+	pid := int(binary.LittleEndian.Uint32(body))
+	body = body[4:]
+	if op == agentOpOpen {
+		return s.open(pid)
+	}
+	fd, ok := s.targets[pid]
+	if !ok {
+		return nil, fmt.Errorf("pid %d is not open", pid)
+	}
+	switch op {
+	case agentOpRead:
+		return readRanges(fd, body)
+	case agentOpReadFile:
+		if len(body) < 12 {
+			return nil, errors.New("malformed request")
+		}
+		off := binary.LittleEndian.Uint64(body)
+		size := min(binary.LittleEndian.Uint32(body[8:]), agentFileChunk)
+		return s.readFile(pid, string(body[12:]), off, size)
+	case agentOpMaps:
+		if err := s.allow.Check(pid); err != nil {
+			return nil, err
+		}
+		return os.ReadFile(fmt.Sprintf("/proc/%d/maps", pid))
+	}
+	return nil, fmt.Errorf("unknown op %d", op)
+}
+
+func (s *agentSession) open(pid int) ([]byte, error) {
+	if err := s.allow.Check(pid); err != nil {
+		log.Printf("agent: %s: denied pid %d", s.peer, pid)
+		return nil, err
+	}
+	t := AgentTarget{PID: pid}
+	var err error
+	if t.Auxv, err = os.ReadFile(fmt.Sprintf("/proc/%d/auxv", pid)); err != nil {
+		return nil, fmt.Errorf("failed to read auxv: %w", err)
+	}
+	if t.Exe, err = processExe(pid); err != nil {
+		return nil, fmt.Errorf("failed to read process exe link: %w", err)
+	}
+	exe, err := elf.Open(fmt.Sprintf("/proc/%d/exe", pid))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open executable: %w", err)
+	}
+	t.GNUBuildID = hex.EncodeToString(bin.GNUBuildID(exe))
+	t.GoBuildID = bin.GoBuildID(exe)
+	exe.Close()
+	if st, err := os.Stat(fmt.Sprintf("/proc/%d/exe", pid)); err == nil {
+		t.ExeSize = st.Size()
+	}
+	t.Nanotime = nanotime()
+
+	if _, ok := s.targets[pid]; !ok {
+		fd, err := os.Open(fmt.Sprintf("/proc/%d/mem", pid))
+		if err != nil {
+			return nil, fmt.Errorf("failed to open /proc/%d/mem: %w", pid, err)
+		}
+		s.targets[pid] = fd
+	}
+	log.Printf("agent: %s: opened pid %d (%s)", s.peer, pid, t.Exe)
+	return json.Marshal(t)
+}
+
+// readRanges serves agentOpRead. The mem fd stays bound to the process it was
+// opened for, a reused pid only makes reads fail.
+func readRanges(fd *os.File, body []byte) ([]byte, error) {
+	if len(body) < 4 {
+		return nil, errors.New("malformed request")
+	}
+	n := int(binary.LittleEndian.Uint32(body))
+	body = body[4:]
+	if n > maxAgentRanges || len(body) != 12*n {
+		return nil, errors.New("malformed request")
+	}
+	total := 0
+	for i := 0; i < n; i++ {
+		total += int(binary.LittleEndian.Uint32(body[12*i+8:]))
+	}
+	if total > maxAgentRead {
+		return nil, fmt.Errorf("read of %d bytes is too large", total)
+	}
+
+	resp := make([]byte, 4*n, 4*n+total)
+	for i := 0; i < n; i++ {
+		addr := binary.LittleEndian.Uint64(body[12*i:])
+		size := int(binary.LittleEndian.Uint32(body[12*i+8:]))
+		data := resp[len(resp) : len(resp)+size]
+		read, _ := fd.ReadAt(data, int64(addr)) // a short count tells the client
+		binary.LittleEndian.PutUint32(resp[4*i:], uint32(read))
+		resp = resp[:len(resp)+read]
+	}
+	return resp, nil
+}
+
+// readFile serves the executable or a file the target has mapped, nothing else
+func (s *agentSession) readFile(pid int, path string, off uint64, size uint32) ([]byte, error) {
+	if err := s.allow.Check(pid); err != nil {
+		return nil, err
+	}
+	open := fmt.Sprintf("/proc/%d/exe", pid)
+	if path != "" {
+		maps, err := os.ReadFile(fmt.Sprintf("/proc/%d/maps", pid))
+		if err != nil {
+			return nil, err
+		}
+		files, err := parseMaps(bytes.NewReader(maps))
+		if err != nil {
+			return nil, err
+		}
+		mapped := false
+		for _, f := range files {
+			mapped = mapped || f.path == path
+		}
+		if !mapped || strings.Contains(path, "/../") {
+			return nil, fmt.Errorf("%s is not mapped by pid %d", path, pid)
+		}
+		open = fmt.Sprintf("/proc/%d/root%s", pid, path)
+	}
+	f, err := os.Open(open)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	buf := make([]byte, size)
+	n, err := f.ReadAt(buf, int64(off))
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+	return buf[:n], nil
+}
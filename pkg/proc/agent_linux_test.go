@@ -0,0 +1,166 @@
+//go:build linux
+
+package proc
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+	"unsafe"
+)
+
+// startAgent serves the agent protocol on a unix socket and returns its address
+func startAgent(t *testing.T, allow *Allowlist) string {
+	t.Helper()
+	if _, err := os.Stat("/proc/self/mem"); err != nil {
+		t.Skipf("/proc/self/mem unavailable: %v", err)
+	}
+	path := filepath.Join(t.TempDir(), "agent.sock")
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	go ServeAgent(l, allow)
+	return "unix:" + path
+}
+
+// startFixture runs testdata/fixture until the test ends, test binaries have
+// no symbols to read themselves with
+func startFixture(t *testing.T) int {
+	t.Helper()
+	cmd := exec.Command(buildFixture(t, runtime.GOARCH), "-wait")
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		stdin.Close()
+		cmd.Wait()
+	})
+	// the greeting is printed once the runtime is initialized
+	if _, err := bufio.NewReader(stdout).ReadString('\n'); err != nil {
+		t.Fatal(err)
+	}
+	return cmd.Process.Pid
+}
+
+func TestRemoteMemReader(t *testing.T) {
+	started := time.Now()
+	pid := startFixture(t)
+	// the downloaded executable is cached there, set after the build that uses GOCACHE
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	addr := startAgent(t, &Allowlist{PIDs: []int{pid}})
+
+	for i := 0; i < 2; i++ { // the second reader loads the cached executable
+		r, err := NewRemoteMemReader(addr, nil, pid, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer r.Close()
+		rt, err := r.RuntimeInfo()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if rt.GoVersion != runtime.Version() {
+			t.Errorf("go version %q, want %q", rt.GoVersion, runtime.Version())
+		}
+		// the agent's clock is the target's
+		if up := rt.Uptime(); up <= 0 || up > time.Since(started) {
+			t.Errorf("uptime %v, want within the %v since the fixture started", up, time.Since(started))
+		}
+		before := nanotime()
+		gs, err := r.Goroutines(false)
+		if err != nil || len(gs) == 0 {
+			t.Fatalf("goroutines: %d, %v", len(gs), err)
+		}
+		// give the agent's reported clock some slack for the round trip
+		if now, slack := gs[0].Nanotime, int64(time.Second); now < before-slack || now > nanotime()+slack {
+			t.Errorf("goroutines read at target clock %d, not during the read from %d", now, before)
+		}
+	}
+	cached, _ := filepath.Glob(filepath.Join(os.Getenv("XDG_CACHE_HOME"), "gospy", "binaries", "*"))
+	if len(cached) != 1 {
+		t.Errorf("cached binaries: %v", cached)
+	}
+}
+
+func TestRemoteReadBatch(t *testing.T) {
+	addr := startAgent(t, &Allowlist{PIDs: []int{os.Getpid()}})
+	agent, err := dialAgent(addr, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer agent.Close()
+	if _, err := agent.open(os.Getpid()); err != nil {
+		t.Fatal(err)
+	}
+	r := &remoteMemReader{agent: agent, target: &AgentTarget{PID: os.Getpid()}}
+
+	// larger than one request, so the batch is split
+	objs := make([][]byte, 3*maxAgentRead/(64<<10))
+	addrs := make([]uint64, len(objs))
+	bufs := make([][]byte, len(objs))
+	for i := range objs {
+		objs[i] = bytes.Repeat([]byte{byte(i)}, 64<<10)
+		addrs[i] = uint64(uintptr(unsafe.Pointer(&objs[i][0])))
+		bufs[i] = make([]byte, len(objs[i]))
+	}
+	if err := r.readBatch(addrs, bufs); err != nil {
+		t.Fatal(err)
+	}
+	for i := range bufs {
+		if !bytes.Equal(bufs[i], objs[i]) {
+			t.Fatalf("object %d differs", i)
+		}
+	}
+
+	addrs[5] = 0x10 // never mapped
+	if err := r.readBatch(addrs, bufs); err == nil || !strings.Contains(err.Error(), "0x10") {
+		t.Errorf("expected an error mentioning 0x10, got %v", err)
+	}
+	runtime.KeepAlive(objs)
+}
+
+func TestAgentDenies(t *testing.T) {
+	exe, err := os.Readlink("/proc/self/exe")
+	if err != nil {
+		t.Skip(err)
+	}
+	addr := startAgent(t, &Allowlist{Exes: []string{filepath.Dir(exe) + "/*"}})
+	agent, err := dialAgent(addr, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer agent.Close()
+
+	if _, err := agent.maps(os.Getpid()); err == nil {
+		t.Error("maps of a pid that wasn't opened")
+	}
+	if _, err := agent.open(os.Getppid()); err == nil || !strings.Contains(err.Error(), "not allowed") {
+		t.Errorf("opened the parent process: %v", err)
+	}
+	if _, err := agent.open(os.Getpid()); err != nil {
+		t.Fatalf("own executable not allowed: %v", err)
+	}
+	for _, path := range []string{"/etc/passwd", exe + "/../../../etc/passwd"} {
+		if err := agent.readFile(os.Getpid(), path, io.Discard); err == nil || !strings.Contains(err.Error(), "not mapped") {
+			t.Errorf("read %s: %v", path, err)
+		}
+	}
+}
@@ -0,0 +1,173 @@
+package proc
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// ProcessReport is one process' part of an AggregateReport
+type ProcessReport struct {
+	PID        int      `json:"pid"`
+	GoVersion  string   `json:"go_version"`
+	Goroutines int      `json:"goroutines"`
+	MemStat    *MemStat `json:"memstats,omitempty"`
+	Error      string   `json:"error,omitempty"` // set if the process couldn't be read
+}
+
+// GoroutineGroup counts goroutines with the same start function across processes
+type GoroutineGroup struct {
+	Function string         `json:"function"`
+	Total    int            `json:"total"`
+	PerPID   map[int]int    `json:"per_pid"`
+	Status   map[string]int `json:"status"`
+}
+
+// AggregateReport merges several processes, typically replicas of one service
+type AggregateReport struct {
+	Processes []ProcessReport  `json:"processes"` // in reader order
+	Groups    []GoroutineGroup `json:"groups"`    // by Total, descending
+}
+
+// Aggregate reads all readers concurrently and merges their goroutines by
+// start function. A process that fails to read is reported with its error
+// instead of failing the whole report.
+func Aggregate(readers []ProcessMemReader, showDead bool) *AggregateReport {
+	report := &AggregateReport{}
+	var goroutines [][]G
+	report.Processes, goroutines, _ = readProcesses(readers, showDead, false)
+
+	groups := make(map[string]*GoroutineGroup)
+	for i, gs := range goroutines {
+		pid := report.Processes[i].PID
+		for _, g := range gs {
+			funcName := g.StartFuncName
+			if funcName == "" {
+				funcName = "unknown"
+			}
+			group := groups[funcName]
+			if group == nil {
+				group = &GoroutineGroup{Function: funcName, PerPID: make(map[int]int), Status: make(map[string]int)}
+				groups[funcName] = group
+			}
+			group.Total++
+			group.PerPID[pid]++
+			group.Status[g.Status]++
+		}
+	}
+	for _, group := range groups {
+		report.Groups = append(report.Groups, *group)
+	}
+	sort.Slice(report.Groups, func(i, j int) bool {
+		if report.Groups[i].Total != report.Groups[j].Total {
+			return report.Groups[i].Total > report.Groups[j].Total
+		}
+		return report.Groups[i].Function < report.Groups[j].Function
+	})
+	return report
+}
+
+// StackGroup counts goroutines in the same state with the same stack across
+// processes, like an entry of a debug=1 goroutine profile
+type StackGroup struct {
+	State  string       `json:"state"`  // wait reason of waiting goroutines, the status otherwise
+	Frames []StackFrame `json:"frames"` // as unwound in the first process, leaf first
+	Total  int          `json:"total"`
+	PerPID map[int]int  `json:"per_pid"`
+}
+
+// StackReport merges the goroutine dumps of several processes
+type StackReport struct {
+	Processes []ProcessReport `json:"processes"` // in reader order
+	Stacks    []StackGroup    `json:"stacks"`    // by Total, descending
+}
+
+// AggregateStacks reads all readers concurrently and merges their goroutines
+// by state and stack. Frames are compared by function, file and line, so
+// replicas built from the same source group together even if their PCs differ.
+func AggregateStacks(readers []ProcessMemReader, showDead bool) *StackReport {
+	report := &StackReport{}
+	var goroutines [][]G
+	var stacks [][][]StackFrame
+	report.Processes, goroutines, stacks = readProcesses(readers, showDead, true)
+
+	groups := make(map[string]*StackGroup)
+	var order []string
+	for i, gs := range goroutines {
+		pid := report.Processes[i].PID
+		for j, g := range gs {
+			state := g.Status
+			if g.WaitReason != "" {
+				state = g.WaitReason
+			}
+			var key strings.Builder
+			key.WriteString(state)
+			for _, f := range stacks[i][j] {
+				fmt.Fprintf(&key, "\n%s %s:%d", f.Function, f.File, f.Line)
+			}
+			group := groups[key.String()]
+			if group == nil {
+				group = &StackGroup{State: state, Frames: stacks[i][j], PerPID: make(map[int]int)}
+				groups[key.String()] = group
+				order = append(order, key.String())
+			}
+			group.Total++
+			group.PerPID[pid]++
+		}
+	}
+	for _, key := range order {
+		report.Stacks = append(report.Stacks, *groups[key])
+	}
+	sort.SliceStable(report.Stacks, func(i, j int) bool {
+		return report.Stacks[i].Total > report.Stacks[j].Total
+	})
+	return report
+}
+
+// readProcesses reads every reader concurrently, each one frozen if it was
+// opened WithFreeze. withStacks also unwinds every goroutine, a stack that
+// can't be unwound is left empty.
+func readProcesses(readers []ProcessMemReader, showDead, withStacks bool) ([]ProcessReport, [][]G, [][][]StackFrame) {
+	processes := make([]ProcessReport, len(readers))
+	goroutines := make([][]G, len(readers))
+	stacks := make([][][]StackFrame, len(readers))
+
+	var wg sync.WaitGroup
+	for i, r := range readers {
+		wg.Add(1)
+		go func(i int, r ProcessMemReader) {
+			defer wg.Done()
+			pr := &processes[i]
+			pr.PID = r.Pid()
+			err := r.Frozen(func() error {
+				rt, err := r.RuntimeInfo()
+				if err != nil {
+					return err
+				}
+				pr.GoVersion = rt.GoVersion
+				// partial memory stats are still worth reporting
+				if pr.MemStat, _ = r.MemStat(); pr.MemStat == nil {
+					return fmt.Errorf("failed to get memory stats")
+				}
+				if goroutines[i], err = r.Goroutines(showDead); err != nil {
+					return err
+				}
+				if withStacks {
+					stacks[i] = make([][]StackFrame, len(goroutines[i]))
+					for j, g := range goroutines[i] {
+						stacks[i][j], _ = r.StackTrace(g)
+					}
+				}
+				return nil
+			})
+			if err != nil {
+				pr.Error = err.Error()
+				goroutines[i], stacks[i] = nil, nil
+			}
+			pr.Goroutines = len(goroutines[i])
+		}(i, r)
+	}
+	wg.Wait()
+	return processes, goroutines, stacks
+}
@@ -0,0 +1,106 @@
+package proc
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// ErrNotAllowed is returned for processes an Allowlist doesn't permit
+var ErrNotAllowed = errors.New("not allowed")
+
+// Allowlist selects the processes a server may read: by pid, by the
+// executable path inside the process' mount namespace, with patterns as in
+// filepath.Match, or by cgroup, which allows the processes in that cgroup and
+// the cgroups below it. The zero value allows nothing.
+type Allowlist struct {
+	PIDs    []int
+	Exes    []string
+	Cgroups []string
+}
+
+// Empty reports whether the allowlist has no entries
+func (a *Allowlist) Empty() bool {
+	return len(a.PIDs) == 0 && len(a.Exes) == 0 && len(a.Cgroups) == 0
+}
+
+// Validate returns an error for malformed entries
+func (a *Allowlist) Validate() error {
+	for _, pattern := range a.Exes {
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid executable pattern %q: %w", pattern, err)
+		}
+	}
+	for _, cgroup := range a.Cgroups {
+		if !strings.HasPrefix(cgroup, "/") {
+			return fmt.Errorf("invalid cgroup %q, want an absolute path like in /proc/<pid>/cgroup", cgroup)
+		}
+	}
+	return nil
+}
+
+// Check returns an error wrapping ErrNotAllowed unless pid is allowed. Pids
+// are reused, so it must be checked again before every access that goes
+// through /proc/<pid>.
+func (a *Allowlist) Check(pid int) error {
+	if slices.Contains(a.PIDs, pid) {
+		return nil
+	}
+	// an unreadable file is most likely a process that exited
+	if len(a.Exes) > 0 {
+		if exe, err := processExe(pid); err == nil {
+			for _, pattern := range a.Exes {
+				if ok, _ := filepath.Match(pattern, exe); ok {
+					return nil
+				}
+			}
+		}
+	}
+	if len(a.Cgroups) > 0 {
+		if data, err := os.ReadFile(fmt.Sprintf("/proc/%d/cgroup", pid)); err == nil {
+			for _, cgroup := range a.Cgroups {
+				if inCgroup(parseCgroupPaths(data), cgroup) {
+					return nil
+				}
+			}
+		}
+	}
+	return fmt.Errorf("pid %d is %w", pid, ErrNotAllowed)
+}
+
+// processExe returns the executable path of pid inside its mount namespace
+func processExe(pid int) (string, error) {
+	exe, err := os.Readlink(fmt.Sprintf("/proc/%d/exe", pid))
+	return strings.TrimSuffix(exe, " (deleted)"), err
+}
+
+// parseCgroupPaths returns the paths of /proc/<pid>/cgroup, one per hierarchy
+// (hierarchy-ID:controllers:path)
+func parseCgroupPaths(data []byte) []string {
+	var paths []string
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	for sc.Scan() {
+		fields := strings.SplitN(sc.Text(), ":", 3)
+		if len(fields) == 3 {
+			paths = append(paths, fields[2])
+		}
+	}
+	return paths
+}
+
+// inCgroup reports whether any of paths is cgroup or below it
+func inCgroup(paths []string, cgroup string) bool {
+	cgroup = path.Clean(cgroup)
+	for _, p := range paths {
+		if p == cgroup || cgroup == "/" || strings.HasPrefix(p, cgroup+"/") {
+			return true
+		}
+	}
+	return false
+}
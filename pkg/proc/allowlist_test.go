@@ -0,0 +1,42 @@
+package proc
+
+import (
+	"errors"
+	"os"
+	"testing"
+)
+
+func TestInCgroup(t *testing.T) {
+	v1 := parseCgroupPaths([]byte("12:memory:/kubepods/pod1/abc\n1:name=systemd:/kubepods/pod1/abc\n"))
+	v2 := parseCgroupPaths([]byte("0::/system.slice/app.service\n"))
+	for _, c := range []struct {
+		paths  []string
+		cgroup string
+		want   bool
+	}{
+		{v1, "/kubepods/pod1", true},
+		{v1, "/kubepods/pod1/", true},
+		{v1, "/kubepods/pod1/abc", true},
+		{v1, "/kubepods/pod", false},
+		{v1, "/kubepods/pod2", false},
+		{v2, "/system.slice/app.service", true},
+		{v2, "/system.slice/app", false},
+		{v2, "/", true},
+	} {
+		if got := inCgroup(c.paths, c.cgroup); got != c.want {
+			t.Errorf("inCgroup(%v, %q) = %v, want %v", c.paths, c.cgroup, got, c.want)
+		}
+	}
+}
+
+func TestAllowlistCheck(t *testing.T) {
+	if err := (&Allowlist{}).Check(os.Getpid()); !errors.Is(err, ErrNotAllowed) {
+		t.Errorf("empty allowlist: %v", err)
+	}
+	if err := (&Allowlist{Cgroups: []string{"/"}}).Check(os.Getpid()); err != nil {
+		t.Errorf("root cgroup: %v", err)
+	}
+	if err := (&Allowlist{Cgroups: []string{"relative"}}).Validate(); err == nil {
+		t.Error("relative cgroup is valid")
+	}
+}
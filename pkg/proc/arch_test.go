@@ -0,0 +1,251 @@
+package proc
+
+import (
+	"debug/elf"
+	"encoding/binary"
+	"errors"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	bin "github.com/monsterxx03/gospy/pkg/binary"
+)
+
+// elfMemory serves reads from the PT_LOAD segments of an executable, the way
+// they would be mapped in a process that hasn't modified its static data
+type elfMemory struct {
+	commonMemReader
+	loader bin.BinaryLoader
+	progs  []*elf.Prog
+}
+
+func (m *elfMemory) ReadAt(p []byte, off int64) (int, error) {
+	addr := uint64(off)
+	for _, prog := range m.progs {
+		if addr < prog.Vaddr || addr+uint64(len(p)) > prog.Vaddr+prog.Memsz {
+			continue
+		}
+		// bytes past Filesz are .bss, zero filled
+		clear(p)
+		start := addr - prog.Vaddr
+		if start < prog.Filesz {
+			n := min(uint64(len(p)), prog.Filesz-start)
+			if _, err := prog.ReadAt(p[:n], int64(start)); err != nil {
+				return 0, err
+			}
+		}
+		return len(p), nil
+	}
+	return 0, errors.New("unmapped")
+}
+
+func (m *elfMemory) GetBinaryLoader() bin.BinaryLoader { return m.loader }
+func (m *elfMemory) GetStaticBase() uint64             { return 0 }
+
+// buildFixture cross-compiles testdata/fixture for linux/goarch, with extra go build flags
+func buildFixture(t *testing.T, goarch string, flags ...string) string {
+	t.Helper()
+	out := filepath.Join(t.TempDir(), "fixture-"+goarch)
+	cmd := exec.Command("go", append(append([]string{"build", "-o", out}, flags...), "./testdata/fixture")...)
+	cmd.Env = append(cmd.Environ(), "GOOS=linux", "GOARCH="+goarch, "CGO_ENABLED=0")
+	if output, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("build fixture: %v\n%s", err, output)
+	}
+	return out
+}
+
+func openFixture(t *testing.T, path string) *elfMemory {
+	t.Helper()
+	loader := bin.NewBinaryLoader()
+	if err := loader.Load(path); err != nil {
+		t.Fatal(err)
+	}
+	m := &elfMemory{loader: loader}
+	for _, prog := range loader.GetFile().(*elf.File).Progs {
+		if prog.Type == elf.PT_LOAD {
+			m.progs = append(m.progs, prog)
+		}
+	}
+	m.commonMemReader = commonMemReader{reader: m}
+	return m
+}
+
+func TestArchitectures(t *testing.T) {
+	if testing.Short() {
+		t.Skip("cross-compiles fixtures")
+	}
+	if _, err := exec.LookPath("go"); err != nil {
+		t.Skip("go toolchain not found")
+	}
+
+	tests := []struct {
+		goarch  string
+		ptrSize int
+		order   binary.ByteOrder
+	}{
+		{"amd64", 8, binary.LittleEndian},
+		{"386", 4, binary.LittleEndian},
+		{"arm", 4, binary.LittleEndian},
+		{"arm64", 8, binary.LittleEndian},
+		{"ppc64le", 8, binary.LittleEndian},
+		{"s390x", 8, binary.BigEndian},
+		{"riscv64", 8, binary.LittleEndian},
+	}
+	for _, tt := range tests {
+		t.Run(tt.goarch, func(t *testing.T) {
+			t.Parallel()
+			m := openFixture(t, buildFixture(t, tt.goarch))
+			r := &m.commonMemReader
+
+			if got := r.ptrSize(); got != tt.ptrSize {
+				t.Errorf("ptrSize = %d, want %d", got, tt.ptrSize)
+			}
+			if got := r.byteOrder(); got != tt.order {
+				t.Errorf("byteOrder = %v, want %v", got, tt.order)
+			}
+
+			addr := func(name string) uint64 {
+				t.Helper()
+				a, err := m.loader.FindVariableAddress(name)
+				if err != nil {
+					t.Fatal(err)
+				}
+				return a
+			}
+
+			if got, err := r.readString(addr("main.greeting")); err != nil || got != "hello from fixture" {
+				t.Errorf("readString = %q, %v", got, err)
+			}
+			want := []string{"alpha", "beta", "gamma"}
+			if got, err := r.readStringSlice(addr("main.words")); err != nil || !reflect.DeepEqual(got, want) {
+				t.Errorf("readStringSlice = %q, %v", got, err)
+			}
+			if got, err := r.readUint64(addr("main.magic")); err != nil || got != 0x0102030405060708 {
+				t.Errorf("readUint64 = 0x%x, %v", got, err)
+			}
+
+			rt := r.readStaticRuntimeInfo()
+			if rt.GoVersion == "" {
+				t.Error("go version not read")
+			}
+			if rt.BuildInfo == nil {
+				t.Error("build info not read")
+			}
+
+			testParseP(t, r)
+			testParseG(t, r, addr("main.main"))
+		})
+	}
+}
+
+// testParseP lays out a runtime.p in target format using the fixture's DWARF
+// offsets and checks parsePFromBatch decodes it
+func testParseP(t *testing.T, r *commonMemReader) {
+	t.Helper()
+	dwarf, err := r.GetBinaryLoader().GetDWARFLoader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	size, err := dwarf.GetStructSize("runtime.p")
+	if err != nil {
+		t.Fatal(err)
+	}
+	offset := func(field string) uint64 {
+		t.Helper()
+		off, err := dwarf.GetStructOffset("runtime.p", field)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return off
+	}
+
+	order := r.byteOrder()
+	data := make([]byte, size)
+	order.PutUint32(data[offset("id"):], 3)
+	order.PutUint32(data[offset("status"):], 1)
+	order.PutUint32(data[offset("schedtick"):], 42)
+	if r.ptrSize() == 4 {
+		order.PutUint32(data[offset("mcache"):], 0x8000)
+	} else {
+		order.PutUint64(data[offset("mcache"):], 0x8000)
+	}
+
+	p, err := r.parsePFromBatch(data, 0x1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.ID != 3 || p.SchedTick != 42 || p.MCache != 0x8000 || p.Status != parsePStatus(1) {
+		t.Errorf("parsed %+v", p)
+	}
+}
+
+// testParseG lays out a waiting runtime.g in target format using the fixture's
+// DWARF offsets and checks parseGoroutineFromBatch and parseSchedInfo decode it
+func testParseG(t *testing.T, r *commonMemReader, mainPC uint64) {
+	t.Helper()
+	dwarf, err := r.GetBinaryLoader().GetDWARFLoader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	size, err := dwarf.GetStructSize("runtime.g")
+	if err != nil {
+		t.Fatal(err)
+	}
+	offset := func(typ, field string) uint64 {
+		t.Helper()
+		off, err := dwarf.GetStructOffset(typ, field)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return off
+	}
+
+	order := r.byteOrder()
+	data := make([]byte, size)
+	putPtr := func(off, v uint64) {
+		if r.ptrSize() == 4 {
+			order.PutUint32(data[off:], uint32(v))
+		} else {
+			order.PutUint64(data[off:], v)
+		}
+	}
+	waitReasons := r.waitReasonMap()
+	const reason = 14 // named in every version's table
+	if waitReasons[reason] == "" {
+		t.Fatalf("no wait reason %d for %s", reason, r.staticRuntimeInfo().GoVersion)
+	}
+	stack, sched := offset("runtime.g", "stack"), offset("runtime.g", "sched")
+	putPtr(stack+offset("runtime.stack", "lo"), 0x10000)
+	putPtr(stack+offset("runtime.stack", "hi"), 0x18000)
+	putPtr(sched+offset("runtime.gobuf", "pc"), mainPC)
+	putPtr(sched+offset("runtime.gobuf", "sp"), 0x17f00)
+	putPtr(sched+offset("runtime.gobuf", "bp"), 0x17f80)
+	order.PutUint64(data[offset("runtime.g", "goid"):], 42)
+	order.PutUint32(data[offset("runtime.g", "atomicstatus"):], 4) // _Gwaiting
+	data[offset("runtime.g", "waitreason")] = reason
+	putPtr(offset("runtime.g", "startpc"), mainPC)
+	putPtr(offset("runtime.g", "gopc"), mainPC+4)
+	order.PutUint64(data[offset("runtime.g", "parentGoid"):], 1)
+	order.PutUint64(data[offset("runtime.g", "waitsince"):], 12345)
+
+	g, err := r.parseGoroutineFromBatch(data, 0x2000, waitReasons)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if g.Goid != 42 || g.Status != "waiting" || g.WaitReason != waitReasons[reason] ||
+		g.StartPC != mainPC || !strings.HasPrefix(g.StartFuncName, "main.main") ||
+		g.CreatorPC != mainPC+4 || g.CreatedBy != "main.main" || g.ParentGoid != 1 || g.WaitSince != 12345 ||
+		g.Stack != (Stack{Lo: 0x10000, Hi: 0x18000}) {
+		t.Errorf("parsed %+v", g)
+	}
+
+	var sg G
+	if err := r.parseSchedInfo(&sg, data, 0x2000, dwarf); err != nil {
+		t.Fatal(err)
+	}
+	if sg.Sched != (Sched{PC: mainPC, SP: 0x17f00, BP: 0x17f80}) || !strings.HasPrefix(sg.FuncName, "main.main") {
+		t.Errorf("parsed sched %+v, func %q", sg.Sched, sg.FuncName)
+	}
+}
@@ -0,0 +1,98 @@
+package proc
+
+import (
+	"debug/buildinfo"
+	"fmt"
+	"runtime/debug"
+)
+
+// Module describes a Go module linked into the binary
+type Module struct {
+	Path    string  `json:"path"`
+	Version string  `json:"version"`
+	Sum     string  `json:"sum,omitempty"`
+	Replace *Module `json:"replace,omitempty"`
+}
+
+// BuildSetting is a key/value build setting such as GOOS or vcs.revision
+type BuildSetting struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+// BuildInfo is the build information embedded by the Go linker
+type BuildInfo struct {
+	GoVersion string         `json:"go_version"`
+	Path      string         `json:"path"` // main package path
+	Main      Module         `json:"main"`
+	Deps      []Module       `json:"deps"`
+	Settings  []BuildSetting `json:"settings"`
+}
+
+// Setting returns the value of a build setting, or "" if it's not set
+func (b *BuildInfo) Setting(key string) string {
+	for _, s := range b.Settings {
+		if s.Key == key {
+			return s.Value
+		}
+	}
+	return ""
+}
+
+// ReadBuildInfoFile reads build info from an executable on disk
+func ReadBuildInfoFile(path string) (*BuildInfo, error) {
+	bi, err := buildinfo.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return newBuildInfo(bi), nil
+}
+
+func newBuildInfo(bi *debug.BuildInfo) *BuildInfo {
+	b := &BuildInfo{
+		GoVersion: bi.GoVersion,
+		Path:      bi.Path,
+		Main:      convertModule(&bi.Main),
+		Deps:      make([]Module, 0, len(bi.Deps)),
+		Settings:  make([]BuildSetting, 0, len(bi.Settings)),
+	}
+	for _, dep := range bi.Deps {
+		b.Deps = append(b.Deps, convertModule(dep))
+	}
+	for _, s := range bi.Settings {
+		b.Settings = append(b.Settings, BuildSetting{Key: s.Key, Value: s.Value})
+	}
+	return b
+}
+
+func convertModule(m *debug.Module) Module {
+	mod := Module{Path: m.Path, Version: m.Version, Sum: m.Sum}
+	if m.Replace != nil {
+		replace := convertModule(m.Replace)
+		mod.Replace = &replace
+	}
+	return mod
+}
+
+// readBuildInfo reads runtime.modinfo from process memory, the same string
+// runtime/debug.ReadBuildInfo parses inside the target
+func (r *commonMemReader) readBuildInfo(goVersion string) (*BuildInfo, error) {
+	addr, err := r.GetBinaryLoader().FindVariableAddress("runtime.modinfo")
+	if err != nil {
+		return nil, fmt.Errorf("find modinfo symbol: %w", err)
+	}
+	modinfo, err := r.readString(r.GetStaticBase() + addr)
+	if err != nil {
+		return nil, fmt.Errorf("read modinfo: %w", err)
+	}
+	// modinfo is wrapped in 16 byte sentinels on both ends
+	if len(modinfo) < 32 {
+		return nil, fmt.Errorf("modinfo not present (built without module support?)")
+	}
+	bi, err := debug.ParseBuildInfo(modinfo[16 : len(modinfo)-16])
+	if err != nil {
+		return nil, fmt.Errorf("parse modinfo: %w", err)
+	}
+	bi.GoVersion = goVersion
+	return newBuildInfo(bi), nil
+}
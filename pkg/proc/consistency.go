@@ -0,0 +1,77 @@
+package proc
+
+import (
+	"fmt"
+	"time"
+)
+
+// ConsistencyReport describes differences between two back to back reads of
+// the goroutine list. On a running target any difference means a single read
+// may have been torn, i.e. mixed state from before and after a change.
+type ConsistencyReport struct {
+	Goroutines int           `json:"goroutines"` // goroutines in the first read
+	Appeared   int           `json:"appeared"`   // only in the second read
+	Vanished   int           `json:"vanished"`   // only in the first read
+	Status     int           `json:"status"`     // status or wait reason changed
+	Moved      int           `json:"moved"`      // scheduled PC/SP changed
+	Elapsed    time.Duration `json:"elapsed"`    // time between the start of both reads
+}
+
+// Torn reports whether anything changed between the reads
+func (c *ConsistencyReport) Torn() bool {
+	return c.Appeared+c.Vanished+c.Status+c.Moved > 0
+}
+
+func (c *ConsistencyReport) String() string {
+	if !c.Torn() {
+		return fmt.Sprintf("consistent: %d goroutines unchanged across reads %s apart", c.Goroutines, c.Elapsed)
+	}
+	return fmt.Sprintf("torn: of %d goroutines %d appeared, %d vanished, %d changed status, %d moved within %s",
+		c.Goroutines, c.Appeared, c.Vanished, c.Status, c.Moved, c.Elapsed)
+}
+
+// CheckConsistency reads all goroutines twice and compares the results. Run it
+// inside Frozen to verify the freeze, outside to see how much the target moves.
+func CheckConsistency(r ProcessMemReader) (*ConsistencyReport, error) {
+	start := time.Now()
+	first, err := r.Goroutines(true)
+	if err != nil {
+		return nil, err
+	}
+	second := time.Now()
+	// inside Frozen the page cache is pinned and would just repeat the first read
+	if v, ok := r.(interface{ newView() }); ok {
+		v.newView()
+	}
+	again, err := r.Goroutines(true)
+	if err != nil {
+		return nil, err
+	}
+	report := CompareGoroutines(first, again)
+	report.Elapsed = second.Sub(start)
+	return report, nil
+}
+
+// CompareGoroutines compares two reads of the goroutine list, matching goroutines by G address
+func CompareGoroutines(before, after []G) *ConsistencyReport {
+	report := &ConsistencyReport{Goroutines: len(before)}
+	prev := make(map[uint64]G, len(before))
+	for _, g := range before {
+		prev[g.Address] = g
+	}
+	for _, g := range after {
+		old, ok := prev[g.Address]
+		if !ok || old.Goid != g.Goid {
+			report.Appeared++
+			continue
+		}
+		delete(prev, g.Address)
+		if old.AtomicStatus != g.AtomicStatus || old.WaitReason != g.WaitReason {
+			report.Status++
+		} else if old.Sched != g.Sched {
+			report.Moved++
+		}
+	}
+	report.Vanished = len(prev)
+	return report
+}
@@ -0,0 +1,33 @@
+package proc
+
+import "testing"
+
+func TestCompareGoroutines(t *testing.T) {
+	before := []G{
+		{Address: 0x1000, Goid: 1, AtomicStatus: 4, Sched: Sched{PC: 0x10, SP: 0x20}},
+		{Address: 0x2000, Goid: 2, AtomicStatus: 1},
+		{Address: 0x3000, Goid: 3, AtomicStatus: 4, Sched: Sched{PC: 0x10, SP: 0x20}},
+		{Address: 0x4000, Goid: 4, AtomicStatus: 6},
+	}
+
+	report := CompareGoroutines(before, before)
+	if report.Torn() {
+		t.Fatalf("identical reads reported as torn: %s", report)
+	}
+
+	after := []G{
+		{Address: 0x1000, Goid: 1, AtomicStatus: 4, Sched: Sched{PC: 0x10, SP: 0x20}},
+		{Address: 0x2000, Goid: 2, AtomicStatus: 2},                                   // status changed
+		{Address: 0x3000, Goid: 3, AtomicStatus: 4, Sched: Sched{PC: 0x18, SP: 0x20}}, // moved
+		{Address: 0x4000, Goid: 9, AtomicStatus: 1},                                   // G reused
+		{Address: 0x5000, Goid: 10, AtomicStatus: 1},
+	}
+	report = CompareGoroutines(before, after)
+	want := ConsistencyReport{Goroutines: 4, Appeared: 2, Vanished: 1, Status: 1, Moved: 1}
+	if *report != want {
+		t.Errorf("got %+v, want %+v", *report, want)
+	}
+	if !report.Torn() {
+		t.Error("expected torn report")
+	}
+}
@@ -0,0 +1,74 @@
+//go:build linux
+
+package proc
+
+import (
+	"debug/buildinfo"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// minContainerIDLen avoids matching unrelated cgroup paths with a short id
+const minContainerIDLen = 12
+
+// FindContainerPid returns the host pid of the Go process running in the
+// container whose id (or id prefix, as printed by docker/crictl) appears in
+// the process' cgroup path. It fails if the container runs several Go processes.
+func FindContainerPid(id string) (int, error) {
+	if len(id) < minContainerIDLen {
+		return 0, fmt.Errorf("container id %q too short, need at least %d characters", id, minContainerIDLen)
+	}
+	pids, err := containerPids(id)
+	if err != nil {
+		return 0, err
+	}
+	if len(pids) == 0 {
+		return 0, fmt.Errorf("no process found in container %s", id)
+	}
+
+	var goPids []int
+	for _, pid := range pids {
+		if _, err := buildinfo.ReadFile(fmt.Sprintf("/proc/%d/exe", pid)); err == nil {
+			goPids = append(goPids, pid)
+		}
+	}
+	switch len(goPids) {
+	case 0:
+		return 0, fmt.Errorf("no Go process found in container %s (pids %v)", id, pids)
+	case 1:
+		return goPids[0], nil
+	default:
+		return 0, fmt.Errorf("container %s runs several Go processes %v, pick one with --pid", id, goPids)
+	}
+}
+
+// containerPids returns the pids whose cgroup path contains id, sorted
+func containerPids(id string) ([]int, error) {
+	entries, err := os.ReadDir("/proc")
+	if err != nil {
+		return nil, err
+	}
+	var pids []int
+	for _, e := range entries {
+		pid, err := strconv.Atoi(e.Name())
+		if err != nil {
+			continue
+		}
+		cgroup, err := os.ReadFile(fmt.Sprintf("/proc/%d/cgroup", pid))
+		if err != nil {
+			if errors.Is(err, os.ErrPermission) {
+				return nil, fmt.Errorf("failed to read cgroup of pid %d: %w", pid, err)
+			}
+			continue // process exited
+		}
+		if strings.Contains(string(cgroup), id) {
+			pids = append(pids, pid)
+		}
+	}
+	sort.Ints(pids)
+	return pids, nil
+}
@@ -0,0 +1,76 @@
+package proc
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// GoProcess is a running Go program found by FindGoProcesses
+type GoProcess struct {
+	PID        int           `json:"pid"`
+	Name       string        `json:"name"`        // executable base name
+	Command    string        `json:"command"`     // command line
+	Exe        string        `json:"exe"`         // executable path usable from gospy
+	GoVersion  string        `json:"go_version"`  // empty if unknown
+	ModulePath string        `json:"module_path"` // main module
+	Goroutines int           `json:"goroutines"`  // live goroutines, -1 if not counted
+	RSS        uint64        `json:"rss"`         // resident memory in bytes
+	Uptime     time.Duration `json:"uptime"`
+}
+
+// Matches reports whether the process has executable or argv[0] base name
+// name, and its command line matches re. Empty name and nil re match anything.
+func (p *GoProcess) Matches(name string, re *regexp.Regexp) bool {
+	if name != "" && p.Name != name && filepath.Base(strings.SplitN(p.Command, " ", 2)[0]) != name {
+		return false
+	}
+	return re == nil || re.MatchString(p.Command)
+}
+
+// FindGoProcessPid returns the pid of the only Go process matching name and re
+func FindGoProcessPid(name string, re *regexp.Regexp) (int, error) {
+	pids, err := FindGoProcessPids(name, re)
+	if err != nil {
+		return 0, err
+	}
+	if len(pids) > 1 {
+		return 0, fmt.Errorf("several Go processes match %v, pick one with --pid", pids)
+	}
+	return pids[0], nil
+}
+
+// CountGoroutines attaches to pid to count its live goroutines, which needs
+// root and loads the binary's DWARF. It returns -1 if pid can't be read.
+func CountGoroutines(pid int) int {
+	r, err := NewProcessMemReader(pid, "")
+	if err != nil {
+		return -1
+	}
+	defer r.Close()
+	gs, err := r.Goroutines(false)
+	if err != nil {
+		return -1
+	}
+	return len(gs)
+}
+
+// FindGoProcessPids returns the pids of all Go processes matching name and re
+func FindGoProcessPids(name string, re *regexp.Regexp) ([]int, error) {
+	procs, err := FindGoProcesses()
+	if err != nil {
+		return nil, err
+	}
+	var pids []int
+	for _, p := range procs {
+		if p.Matches(name, re) {
+			pids = append(pids, p.PID)
+		}
+	}
+	if len(pids) == 0 {
+		return nil, fmt.Errorf("no matching Go process found")
+	}
+	return pids, nil
+}
@@ -0,0 +1,112 @@
+//go:build linux
+
+package proc
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	bin "github.com/monsterxx03/gospy/pkg/binary"
+)
+
+// userHZ is the kernel's USER_HZ, the unit of /proc/<pid>/stat times. It's 100
+// on every architecture Go supports on Linux.
+const userHZ = 100
+
+// FindGoProcesses scans /proc for Go programs, sorted by pid. Goroutines are
+// not counted, see CountGoroutines.
+func FindGoProcesses() ([]GoProcess, error) {
+	entries, err := os.ReadDir("/proc")
+	if err != nil {
+		return nil, err
+	}
+	self := os.Getpid()
+	var procs []GoProcess
+	for _, e := range entries {
+		pid, err := strconv.Atoi(e.Name())
+		if err != nil || pid == self {
+			continue
+		}
+		p, ok := inspectProcess(pid)
+		if !ok {
+			continue
+		}
+		procs = append(procs, p)
+	}
+	sort.Slice(procs, func(i, j int) bool { return procs[i].PID < procs[j].PID })
+	return procs, nil
+}
+
+// inspectProcess returns process info if pid runs a Go binary. Kernel threads
+// and processes that exit or can't be inspected are skipped.
+func inspectProcess(pid int) (GoProcess, bool) {
+	exe, err := bin.ResolveExePath(pid)
+	if err != nil {
+		return GoProcess{}, false
+	}
+	info, ok := bin.IdentifyGoBinary(exe)
+	if !ok {
+		return GoProcess{}, false
+	}
+	p := GoProcess{
+		PID:        pid,
+		Exe:        exe,
+		GoVersion:  info.GoVersion,
+		ModulePath: info.ModulePath,
+		Goroutines: -1,
+	}
+	if target, err := os.Readlink(fmt.Sprintf("/proc/%d/exe", pid)); err == nil {
+		p.Name = filepath.Base(strings.TrimSuffix(target, " (deleted)"))
+	}
+	if cmdline, err := os.ReadFile(fmt.Sprintf("/proc/%d/cmdline", pid)); err == nil {
+		p.Command = string(bytes.TrimRight(bytes.ReplaceAll(cmdline, []byte{0}, []byte{' '}), " "))
+	}
+	if statm, err := os.ReadFile(fmt.Sprintf("/proc/%d/statm", pid)); err == nil {
+		if fields := strings.Fields(string(statm)); len(fields) > 1 {
+			pages, _ := strconv.ParseUint(fields[1], 10, 64)
+			p.RSS = pages * uint64(os.Getpagesize())
+		}
+	}
+	p.Uptime = processUptime(pid)
+	return p, true
+}
+
+// processUptime derives the process age from starttime in /proc/<pid>/stat
+func processUptime(pid int) time.Duration {
+	stat, err := os.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil {
+		return 0
+	}
+	// comm may contain spaces, fields after it start at the last ')'
+	i := bytes.LastIndexByte(stat, ')')
+	if i < 0 {
+		return 0
+	}
+	fields := strings.Fields(string(stat[i+1:]))
+	if len(fields) < 20 {
+		return 0
+	}
+	start, err := strconv.ParseUint(fields[19], 10, 64) // field 22, starttime
+	if err != nil {
+		return 0
+	}
+	uptime, err := os.ReadFile("/proc/uptime")
+	if err != nil {
+		return 0
+	}
+	var sysUptime float64
+	if _, err := fmt.Sscanf(string(uptime), "%f", &sysUptime); err != nil {
+		return 0
+	}
+	age := sysUptime - float64(start)/userHZ
+	if age < 0 {
+		return 0
+	}
+	return time.Duration(age * float64(time.Second))
+}
@@ -0,0 +1,257 @@
+//go:build linux
+
+package proc
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// freezeProcess stops all threads of pid until the returned thaw is called or
+// budget elapses, whichever comes first. ptrace is tried first since it only
+// affects the target, the cgroup v2 freezer is used when ptrace isn't possible
+// (e.g. a debugger is already attached) and the target is alone in its cgroup.
+func freezeProcess(pid int, budget time.Duration) (func() error, error) {
+	thaw, err := ptraceFreeze(pid, budget)
+	if err == nil {
+		return thaw, nil
+	}
+	thaw, cgErr := cgroupFreeze(pid, budget)
+	if cgErr == nil {
+		return thaw, nil
+	}
+	return nil, fmt.Errorf("ptrace: %v; cgroup freezer: %v", err, cgErr)
+}
+
+// ptraceFreeze seizes and interrupts every thread. All ptrace requests must come
+// from the same OS thread, so the tracer lives in its own locked goroutine. If
+// gospy dies while tracing, the kernel detaches and resumes the threads.
+func ptraceFreeze(pid int, budget time.Duration) (func() error, error) {
+	ready := make(chan error, 1)
+	release := make(chan struct{})
+	done := make(chan error, 1)
+
+	go func() {
+		// the thread is discarded when this goroutine exits without unlocking
+		runtime.LockOSThread()
+
+		threads, err := seizeAll(pid)
+		if err != nil {
+			detachAll(threads)
+			ready <- err
+			return
+		}
+		ready <- nil
+
+		timer := time.NewTimer(budget)
+		defer timer.Stop()
+		exceeded := false
+		select {
+		case <-release:
+		case <-timer.C:
+			exceeded = true
+		}
+		err = detachAll(threads)
+		if err == nil && exceeded {
+			err = fmt.Errorf("%w (%s)", ErrFreezeBudgetExceeded, budget)
+		}
+		done <- err
+	}()
+
+	if err := <-ready; err != nil {
+		return nil, err
+	}
+	return onceThaw(release, done), nil
+}
+
+// seizedThread is a thread stopped by seizeAll and the signal it was about
+// to receive, which has to be handed back on detach or it is lost
+type seizedThread struct {
+	tid int
+	sig int
+}
+
+// seizeAll attaches to every thread, rescanning until no new threads show up
+func seizeAll(pid int) ([]seizedThread, error) {
+	seized := make(map[int]bool)
+	var threads []seizedThread
+	for pass := 0; pass < 5; pass++ {
+		current, err := listThreads(pid)
+		if err != nil {
+			return threads, err
+		}
+		added := false
+		for _, tid := range current {
+			if seized[tid] {
+				continue
+			}
+			if err := unix.PtraceSeize(tid); err != nil {
+				if errors.Is(err, unix.ESRCH) {
+					continue // thread exited
+				}
+				return threads, fmt.Errorf("PTRACE_SEIZE %d: %w", tid, err)
+			}
+			seized[tid] = true
+			added = true
+			if err := unix.PtraceInterrupt(tid); err != nil {
+				threads = append(threads, seizedThread{tid: tid})
+				return threads, fmt.Errorf("PTRACE_INTERRUPT %d: %w", tid, err)
+			}
+			var ws unix.WaitStatus
+			if _, err := unix.Wait4(tid, &ws, unix.WALL, nil); err != nil {
+				threads = append(threads, seizedThread{tid: tid})
+				return threads, fmt.Errorf("wait for %d: %w", tid, err)
+			}
+			if !ws.Stopped() {
+				continue // thread exited, nothing to detach
+			}
+			t := seizedThread{tid: tid}
+			if int(ws>>16) != unix.PTRACE_EVENT_STOP {
+				// signal-delivery-stop, the signal is suppressed unless passed on detach
+				t.sig = int(ws.StopSignal())
+			}
+			threads = append(threads, t)
+		}
+		if !added {
+			return threads, nil
+		}
+	}
+	return threads, nil
+}
+
+func detachAll(threads []seizedThread) error {
+	var errs []error
+	for _, t := range threads {
+		if err := ptraceDetach(t.tid, t.sig); err != nil && !errors.Is(err, unix.ESRCH) {
+			errs = append(errs, fmt.Errorf("PTRACE_DETACH %d: %w", t.tid, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func listThreads(pid int) ([]int, error) {
+	entries, err := os.ReadDir(fmt.Sprintf("/proc/%d/task", pid))
+	if err != nil {
+		return nil, err
+	}
+	tids := make([]int, 0, len(entries))
+	for _, e := range entries {
+		if tid, err := strconv.Atoi(e.Name()); err == nil {
+			tids = append(tids, tid)
+		}
+	}
+	return tids, nil
+}
+
+// cgroupFreeze freezes the target's cgroup v2. A frozen cgroup is not resumed
+// when gospy is killed, so SIGINT/SIGTERM thaw it before exiting.
+func cgroupFreeze(pid int, budget time.Duration) (func() error, error) {
+	dir, err := cgroupV2Dir(pid)
+	if err != nil {
+		return nil, err
+	}
+	procs, err := os.ReadFile(filepath.Join(dir, "cgroup.procs"))
+	if err != nil {
+		return nil, err
+	}
+	if members := strings.Fields(string(procs)); len(members) != 1 || members[0] != strconv.Itoa(pid) {
+		return nil, fmt.Errorf("cgroup %s has %d processes, refusing to freeze them all", dir, len(members))
+	}
+
+	freezeFile := filepath.Join(dir, "cgroup.freeze")
+	if err := os.WriteFile(freezeFile, []byte("1"), 0); err != nil {
+		return nil, err
+	}
+	thawCgroup := func() error {
+		return os.WriteFile(freezeFile, []byte("0"), 0)
+	}
+	if err := waitFrozen(dir, budget); err != nil {
+		thawCgroup()
+		return nil, err
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	release := make(chan struct{})
+	done := make(chan error, 1)
+	go func() {
+		defer signal.Stop(signals)
+		timer := time.NewTimer(budget)
+		defer timer.Stop()
+		select {
+		case <-release:
+			done <- thawCgroup()
+		case <-timer.C:
+			err := thawCgroup()
+			if err == nil {
+				err = fmt.Errorf("%w (%s)", ErrFreezeBudgetExceeded, budget)
+			}
+			done <- err
+		case sig := <-signals:
+			thawCgroup()
+			signal.Stop(signals)
+			syscall.Kill(os.Getpid(), sig.(syscall.Signal))
+		}
+	}()
+	return onceThaw(release, done), nil
+}
+
+// waitFrozen polls cgroup.events until the kernel reports the cgroup frozen
+func waitFrozen(dir string, budget time.Duration) error {
+	deadline := time.Now().Add(budget)
+	for time.Now().Before(deadline) {
+		events, err := os.ReadFile(filepath.Join(dir, "cgroup.events"))
+		if err != nil {
+			return err
+		}
+		if strings.Contains(string(events), "frozen 1") {
+			return nil
+		}
+		time.Sleep(time.Millisecond)
+	}
+	return fmt.Errorf("cgroup %s not frozen within %s", dir, budget)
+}
+
+func cgroupV2Dir(pid int) (string, error) {
+	f, err := os.Open(fmt.Sprintf("/proc/%d/cgroup", pid))
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if path, ok := strings.CutPrefix(scanner.Text(), "0::"); ok {
+			dir := filepath.Join("/sys/fs/cgroup", path)
+			if _, err := os.Stat(filepath.Join(dir, "cgroup.freeze")); err != nil {
+				return "", fmt.Errorf("cgroup freezer unavailable: %w", err)
+			}
+			return dir, nil
+		}
+	}
+	return "", errors.New("process is not in a cgroup v2 hierarchy")
+}
+
+// onceThaw returns a thaw func that releases the freezer once and reports its result on every call
+func onceThaw(release chan struct{}, done chan error) func() error {
+	var once sync.Once
+	var err error
+	return func() error {
+		once.Do(func() {
+			close(release)
+			err = <-done
+		})
+		return err
+	}
+}
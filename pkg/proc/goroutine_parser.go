@@ -1,7 +1,6 @@
 package proc
 
 import (
-	"encoding/binary"
 	"errors"
 	"fmt"
 	"log"
@@ -31,10 +30,10 @@ func (r *commonMemReader) parseStackInfo(g *G, data []byte, gAddr uint64, dwarfL
 	}
 
 	// Read stack.lo from batch data
-	lo := binary.LittleEndian.Uint64(data[stackOffset+loOffset:])
+	lo := r.ptrAt(data, stackOffset+loOffset)
 
 	// Read stack.hi from batch data
-	hi := binary.LittleEndian.Uint64(data[stackOffset+hiOffset:])
+	hi := r.ptrAt(data, stackOffset+hiOffset)
 
 	g.Stack = Stack{Lo: lo, Hi: hi}
 	return nil
@@ -61,16 +60,20 @@ func (r *commonMemReader) parseSchedInfo(g *G, data []byte, gAddr uint64, dwarfL
 	}
 
 	// Read pc from batch data
-	pc := binary.LittleEndian.Uint64(data[schedOffset+pcOffset:])
+	pc := r.ptrAt(data, schedOffset+pcOffset)
 
 	// Read sp from batch data
-	sp := binary.LittleEndian.Uint64(data[schedOffset+spOffset:])
+	sp := r.ptrAt(data, schedOffset+spOffset)
 
 	g.Sched = Sched{PC: pc, SP: sp}
+	// bp is only maintained on frame pointer architectures
+	if bpOffset, err := dwarfLoader.GetStructOffset("runtime.gobuf", "bp"); err == nil {
+		g.Sched.BP = r.ptrAt(data, schedOffset+bpOffset)
+	}
 
 	// Get function name if PC is valid
 	if pc != 0 {
-		funcLoc := r.GetBinaryLoader().PCToFuncLoc(pc - r.GetStaticBase())
+		funcLoc := r.pcToFuncLoc(pc)
 		if funcLoc != nil {
 			g.FuncName = funcLoc.Desc()
 		}
@@ -115,26 +118,35 @@ func (r *commonMemReader) parseStatus(status uint32) string {
 	return fmt.Sprintf("unknown(%d)", status)
 }
 
-// parseWaitReason parses the wait reason for a waiting goroutine from batch data
-func (r *commonMemReader) parseWaitReason(data []byte, gAddr uint64, dwarfLoader bin.DWARFLoader) string {
-	rt, err := r.RuntimeInfo()
-	if err != nil {
-		return fmt.Sprintf("version_error(%v)", err)
-	}
+// waitReasonMap returns the wait reason names of the target's Go version
+func (r *commonMemReader) waitReasonMap() map[uint8]string {
+	return registry.GetWaitReasonMap(r.staticRuntimeInfo().GoVersion)
+}
 
+// parseWaitReason parses the wait reason for a waiting goroutine from batch data
+func (r *commonMemReader) parseWaitReason(data []byte, waitReasons map[uint8]string, dwarfLoader bin.DWARFLoader) string {
 	waitReasonOffset, err := dwarfLoader.GetStructOffset("runtime.g", "waitreason")
 	if err != nil {
 		return fmt.Sprintf("offset_error(%v)", err)
 	}
 	reason := data[waitReasonOffset]
 
-	if name, ok := registry.GetWaitReasonMap(rt.GoVersion)[reason]; ok {
+	if name, ok := waitReasons[reason]; ok {
 		return name
 	}
 	return fmt.Sprintf("unknown(%d)", reason)
 }
 
 func (r *commonMemReader) Goroutines(showDead bool) ([]G, error) {
+	r.cache.refresh()
+	return r.goroutines(showDead)
+}
+
+// goroutines is Goroutines within the current page cache generation
+func (r *commonMemReader) goroutines(showDead bool) ([]G, error) {
+	// best effort, without moduledata only the executable's frames resolve
+	_ = r.refreshModules()
+
 	// Get the address of runtime.allgs symbol
 	allgsAddr, err := r.GetBinaryLoader().FindVariableAddress("runtime.allgs")
 	if err != nil {
@@ -164,15 +176,18 @@ func (r *commonMemReader) Goroutines(showDead bool) ([]G, error) {
 	}
 
 	// Parse each goroutine from the batch data
+	waitReasons := r.waitReasonMap()
+	now := r.clock()
 	gs := make([]G, 0, len(ptrs))
 	for i, ptr := range ptrs {
 		if ptr == 0 {
 			continue
 		}
-		g, err := r.parseGoroutineFromBatch(gData[i*int(gSize):(i+1)*int(gSize)], ptr)
+		g, err := r.parseGoroutineFromBatch(gData[i*int(gSize):(i+1)*int(gSize)], ptr, waitReasons)
 		if err != nil {
 			return nil, fmt.Errorf("failed to parse goroutine at 0x%x: %w", ptr, err)
 		}
+		g.Nanotime = now
 		if showDead || g.Status != "dead" {
 			gs = append(gs, g)
 		}
@@ -187,6 +202,15 @@ func (r *commonMemReader) Goroutines(showDead bool) ([]G, error) {
 }
 
 func (r *commonMemReader) GetGoroutineStackTraceByGoID(goid int64) ([]StackFrame, error) {
+	r.cache.refresh()
+	return r.goroutineStackTraceByGoID(goid)
+}
+
+// goroutineStackTraceByGoID is GetGoroutineStackTraceByGoID within the current page cache generation
+func (r *commonMemReader) goroutineStackTraceByGoID(goid int64) ([]StackFrame, error) {
+	// best effort, without moduledata only the executable's frames resolve
+	_ = r.refreshModules()
+
 	// First get the goroutine by ID
 	g, err := r.getGoroutineByGoid(goid)
 	if err != nil {
@@ -252,7 +276,7 @@ func (r *commonMemReader) getGoroutineByGoid(goid int64) (G, error) {
 				return G{}, fmt.Errorf("failed to read goroutine at 0x%x: %w", ptr, err)
 			}
 
-			return r.parseGoroutineFromBatch(data, ptr)
+			return r.parseGoroutineFromBatch(data, ptr, r.waitReasonMap())
 		}
 	}
 
@@ -260,25 +284,25 @@ func (r *commonMemReader) getGoroutineByGoid(goid int64) (G, error) {
 }
 
 // parseBasicInfoFromBatch parses basic goroutine info from pre-read batch data
-func (r *commonMemReader) parseBasicInfoFromBatch(g *G, data []byte, gAddr uint64, dwarfLoader bin.DWARFLoader) error {
+func (r *commonMemReader) parseBasicInfoFromBatch(g *G, data []byte, waitReasons map[uint8]string, dwarfLoader bin.DWARFLoader) error {
 	// Parse Goid
 	goidOffset, err := dwarfLoader.GetStructOffset("runtime.g", "goid")
 	if err != nil {
 		return fmt.Errorf("failed to get goid offset: %w", err)
 	}
-	g.Goid = int64(binary.LittleEndian.Uint64(data[goidOffset:]))
+	g.Goid = int64(r.byteOrder().Uint64(data[goidOffset:]))
 
 	// Parse status
 	statusOffset, err := dwarfLoader.GetStructOffset("runtime.g", "atomicstatus")
 	if err != nil {
 		return fmt.Errorf("failed to get status offset: %w", err)
 	}
-	g.AtomicStatus = binary.LittleEndian.Uint32(data[statusOffset:])
+	g.AtomicStatus = r.byteOrder().Uint32(data[statusOffset:])
 	g.Status = r.parseStatus(g.AtomicStatus)
 
 	// Parse wait reason if needed
 	if g.Status == "waiting" {
-		g.WaitReason = r.parseWaitReason(data, gAddr, dwarfLoader)
+		g.WaitReason = r.parseWaitReason(data, waitReasons, dwarfLoader)
 	}
 
 	// Parse startpc (goroutine's starting function)
@@ -286,21 +310,100 @@ func (r *commonMemReader) parseBasicInfoFromBatch(g *G, data []byte, gAddr uint6
 	if err != nil {
 		return fmt.Errorf("failed to get startpc offset: %w", err)
 	}
-	g.StartPC = binary.LittleEndian.Uint64(data[startpcOffset:])
+	g.StartPC = r.ptrAt(data, startpcOffset)
 
 	// Get start function name if startpc is valid
 	if g.StartPC != 0 {
-		funcLoc := r.GetBinaryLoader().PCToFuncLoc(g.StartPC - r.GetStaticBase())
+		funcLoc := r.pcToFuncLoc(g.StartPC)
 		if funcLoc != nil {
 			g.StartFuncName = funcLoc.Desc()
 		}
 	}
 
+	// The go statement that created it. The main goroutine's gopc points into the
+	// bootstrap code, tracebacks leave it out too.
+	if gopcOffset, err := dwarfLoader.GetStructOffset("runtime.g", "gopc"); err == nil && g.Goid != 1 {
+		g.CreatorPC = r.ptrAt(data, gopcOffset)
+		if g.CreatorPC != 0 {
+			// gopc is the return address of the newproc call
+			if funcLoc := r.pcToFuncLoc(g.CreatorPC - 1); funcLoc != nil {
+				g.CreatedBy = funcLoc.Func.Name
+			}
+		}
+	}
+	// parentGoid is Go 1.21+
+	if parentOffset, err := dwarfLoader.GetStructOffset("runtime.g", "parentGoid"); err == nil {
+		g.ParentGoid = int64(r.byteOrder().Uint64(data[parentOffset:]))
+	}
+	if waitsinceOffset, err := dwarfLoader.GetStructOffset("runtime.g", "waitsince"); err == nil && g.Status == "waiting" {
+		g.WaitSince = int64(r.byteOrder().Uint64(data[waitsinceOffset:]))
+	}
+
 	return nil
 }
 
-// parseGoroutineFromBatch parses a goroutine from pre-read batch data
-func (r *commonMemReader) parseGoroutineFromBatch(data []byte, gAddr uint64) (G, error) {
+// unwindFramePointers walks the frame pointer chain Go keeps on amd64 and
+// arm64: [fp] holds the caller's frame pointer, [fp+ptrSize] the return address
+func (r *commonMemReader) unwindFramePointers(g G) []StackFrame {
+	return r.unwindFrom(g.Sched.PC, g.Sched.SP, g.Sched.BP, g.Stack)
+}
+
+// unwindFrom walks frame pointers from the given registers. The chain may
+// cross stacks, e.g. from g0 back to the goroutine after systemstack, but
+// never leaves the stacks given.
+func (r *commonMemReader) unwindFrom(pc, sp, fp uint64, stacks ...Stack) []StackFrame {
+	ptrSize := uint64(r.ptrSize())
+	record := make([]byte, 2*ptrSize)
+	stackOf := func(addr uint64) int {
+		for i, st := range stacks {
+			if addr >= st.Lo && addr+2*ptrSize <= st.Hi {
+				return i
+			}
+		}
+		return -1
+	}
+	var frames []StackFrame
+	for len(frames) < maxStackDepth {
+		// return addresses point after the call, look up the call itself
+		lookup := pc
+		if len(frames) > 0 {
+			lookup--
+		}
+		loc := r.pcToFuncLoc(lookup)
+		if loc == nil {
+			break
+		}
+		frames = append(frames, StackFrame{
+			PC:       pc,
+			SP:       sp,
+			Function: loc.Func.Name,
+			File:     loc.File,
+			Line:     loc.Line,
+			Func:     loc.Func,
+		})
+		if loc.Func.Name == "runtime.goexit" {
+			break
+		}
+		stack := stackOf(fp)
+		if stack < 0 {
+			break
+		}
+		if _, err := r.ReadAt(record, int64(fp)); err != nil {
+			break
+		}
+		nextFP, retPC := r.ptrAt(record, 0), r.ptrAt(record, ptrSize)
+		// frame pointers only grow towards stack.hi within a stack
+		if retPC == 0 || (nextFP != 0 && stackOf(nextFP) == stack && nextFP <= fp) {
+			break
+		}
+		pc, sp, fp = retPC, fp+2*ptrSize, nextFP
+	}
+	return frames
+}
+
+// parseGoroutineFromBatch parses a goroutine from pre-read batch data, with
+// the wait reason names of waitReasonMap
+func (r *commonMemReader) parseGoroutineFromBatch(data []byte, gAddr uint64, waitReasons map[uint8]string) (G, error) {
 	g := G{Address: gAddr}
 	dwarfLoader, err := r.GetBinaryLoader().GetDWARFLoader()
 	if err != nil {
@@ -308,7 +411,7 @@ func (r *commonMemReader) parseGoroutineFromBatch(data []byte, gAddr uint64) (G,
 	}
 
 	// Parse basic info from batch data
-	if err := r.parseBasicInfoFromBatch(&g, data, gAddr, dwarfLoader); err != nil {
+	if err := r.parseBasicInfoFromBatch(&g, data, waitReasons, dwarfLoader); err != nil {
 		return g, err
 	}
 
@@ -325,10 +428,23 @@ func (r *commonMemReader) parseGoroutineFromBatch(data []byte, gAddr uint64) (G,
 	return g, nil
 }
 
+// StackTrace unwinds a goroutine returned by Goroutines, leaf first
+func (r *commonMemReader) StackTrace(g G) ([]StackFrame, error) {
+	return r.getGoroutineStackTrace(g)
+}
+
 func (r *commonMemReader) getGoroutineStackTrace(g G) ([]StackFrame, error) {
+	if g.Sched.BP != 0 {
+		switch r.GetBinaryLoader().Arch() {
+		case "amd64", "arm64":
+			if frames := r.unwindFramePointers(g); len(frames) > 0 {
+				return frames, nil
+			}
+		}
+	}
+
 	// it's fragle
-	bin := r.GetBinaryLoader()
-	ptrSize := bin.PtrSize()
+	ptrSize := r.ptrSize()
 	var frames []StackFrame
 	currentPC := g.Sched.PC
 	if currentPC == 0 {
@@ -350,7 +466,7 @@ func (r *commonMemReader) getGoroutineStackTrace(g G) ([]StackFrame, error) {
 			}
 
 		}
-		loc := bin.PCToFuncLoc(currentPC - r.GetStaticBase())
+		loc := r.pcToFuncLoc(currentPC)
 		if loc != nil {
 			frames = append(frames, StackFrame{
 				PC:       currentPC,
@@ -369,7 +485,7 @@ func (r *commonMemReader) getGoroutineStackTrace(g G) ([]StackFrame, error) {
 				log.Printf("Warning: Encountered %s at depth %d. Subsequent frames might be inaccuratge due to simple unwind logic.", loc.Func.Name, d)
 			}
 		}
-		returnPC, err := r.readUint64(currentSP)
+		returnPC, err := r.readPtr(currentSP)
 		if err != nil {
 			log.Printf("Stopping unwind: Failed to read PC from SP 0x%x at depth %d: %v", currentSP, d, err)
 			break
@@ -384,7 +500,7 @@ func (r *commonMemReader) getGoroutineStackTrace(g G) ([]StackFrame, error) {
 	}
 
 	if len(frames) == 0 && currentPC != 0 {
-		loc := bin.PCToFuncLoc(currentPC - r.GetStaticBase())
+		loc := r.pcToFuncLoc(currentPC)
 		if loc != nil {
 			frames = append(frames, StackFrame{
 				PC:       currentPC,
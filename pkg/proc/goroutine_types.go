@@ -1,6 +1,9 @@
 package proc
 
-import "debug/gosym"
+import (
+	"debug/gosym"
+	"time"
+)
 
 // Constants for goroutine status (must match runtime2.go exactly)
 const (
@@ -59,6 +62,22 @@ type G struct {
 	FuncName      string `json:"func_name"`       // currently running function name
 	StartPC       uint64 `json:"start_pc"`        // starting function address
 	StartFuncName string `json:"start_func_name"` // starting function name
+	CreatorPC     uint64 `json:"creator_pc"`      // pc of the go statement that created it, 0 if none
+	CreatedBy     string `json:"created_by"`      // function containing that go statement
+	ParentGoid    int64  `json:"parent_goid"`     // goroutine that created it, 0 before Go 1.21
+	WaitSince     int64  `json:"-"`               // runtime nanotime when it started waiting, 0 if unknown
+	Nanotime      int64  `json:"-"`               // target's runtime nanotime when it was read, 0 if unknown
+}
+
+// WaitDuration is how long the goroutine had been waiting when it was read,
+// like the minutes in a panic traceback. The runtime only records it at the
+// first GC after the goroutine blocked, so it's 0 for short waits. It's 0 too
+// if the reader doesn't know the target's clock, like for cores.
+func (g G) WaitDuration() time.Duration {
+	if g.WaitSince <= 0 || g.Nanotime < g.WaitSince {
+		return 0
+	}
+	return time.Duration(g.Nanotime - g.WaitSince)
 }
 
 type Stack struct {
@@ -69,13 +88,14 @@ type Stack struct {
 type Sched struct {
 	PC uint64 `json:"pc"` // program counter
 	SP uint64 `json:"sp"` // stack pointer
+	BP uint64 `json:"bp"` // frame pointer, 0 if the runtime doesn't save it
 }
 
 type StackFrame struct {
-	PC       uint64
-	SP       uint64
-	Function string
-	File     string
-	Line     int
-	Func     *gosym.Func // Store the gosym Func for potential later use
+	PC       uint64      `json:"pc"`
+	SP       uint64      `json:"sp"`
+	Function string      `json:"function"`
+	File     string      `json:"file"`
+	Line     int         `json:"line"`
+	Func     *gosym.Func `json:"-"` // Store the gosym Func for potential later use
 }
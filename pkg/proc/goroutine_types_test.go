@@ -0,0 +1,31 @@
+package proc
+
+import (
+	"testing"
+	"time"
+)
+
+func TestWaitDurationAndUptime(t *testing.T) {
+	const now = int64(time.Hour)
+	tests := []struct {
+		name     string
+		since    int64 // WaitSince and InitTime
+		nanotime int64
+		want     time.Duration
+	}{
+		{"live", now - int64(3*time.Minute), now, 3 * time.Minute},
+		{"no clock", now - int64(3*time.Minute), 0, 0},
+		{"not recorded", 0, now, 0},
+		{"clock behind", now + 1, now, 0},
+	}
+	for _, tt := range tests {
+		g := G{WaitSince: tt.since, Nanotime: tt.nanotime}
+		if got := g.WaitDuration(); got != tt.want {
+			t.Errorf("%s: WaitDuration() = %v, want %v", tt.name, got, tt.want)
+		}
+		rt := Runtime{InitTime: tt.since, Nanotime: tt.nanotime}
+		if got := rt.Uptime(); got != tt.want {
+			t.Errorf("%s: Uptime() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
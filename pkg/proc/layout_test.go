@@ -0,0 +1,109 @@
+package proc
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+
+	bin "github.com/monsterxx03/gospy/pkg/binary"
+)
+
+// TestRuntimeStructSpecs checks that every struct and field looked up with a
+// constant name is listed in bin.RuntimeStructSpecs, which drives gen-layouts
+// and the warm-up before freezing.
+func TestRuntimeStructSpecs(t *testing.T) {
+	files, err := filepath.Glob("*.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fset := token.NewFileSet()
+	for _, name := range files {
+		if strings.HasSuffix(name, "_test.go") {
+			continue
+		}
+		f, err := parser.ParseFile(fset, name, nil, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// loop variables ranging over constant names, e.g. for _, field := range []string{"g0", "curg"}
+		ranged := make(map[string][]string)
+		ast.Inspect(f, func(n ast.Node) bool {
+			loop, ok := n.(*ast.RangeStmt)
+			if !ok {
+				return true
+			}
+			lit, ok := loop.X.(*ast.CompositeLit)
+			if !ok {
+				return true
+			}
+			for _, elt := range lit.Elts {
+				if kv, ok := elt.(*ast.KeyValueExpr); ok {
+					if id, ok := loop.Key.(*ast.Ident); ok {
+						ranged[id.Name] = append(ranged[id.Name], stringLit(kv.Key)...)
+					}
+				} else if id, ok := loop.Value.(*ast.Ident); ok {
+					ranged[id.Name] = append(ranged[id.Name], stringLit(elt)...)
+				}
+			}
+			return true
+		})
+		names := func(e ast.Expr) []string {
+			if id, ok := e.(*ast.Ident); ok {
+				return ranged[id.Name]
+			}
+			return stringLit(e)
+		}
+
+		ast.Inspect(f, func(n ast.Node) bool {
+			call, ok := n.(*ast.CallExpr)
+			if !ok {
+				return true
+			}
+			sel, ok := call.Fun.(*ast.SelectorExpr)
+			if !ok {
+				return true
+			}
+			pos := fset.Position(call.Pos())
+			switch sel.Sel.Name {
+			case "GetStructSize":
+				for _, typ := range names(call.Args[0]) {
+					if specFields(typ) == nil {
+						t.Errorf("%s: %s is missing from bin.RuntimeStructSpecs", pos, typ)
+					}
+				}
+			case "GetStructOffset":
+				for _, typ := range names(call.Args[0]) {
+					for _, field := range names(call.Args[1]) {
+						if !slices.Contains(specFields(typ), field) {
+							t.Errorf("%s: %s.%s is missing from bin.RuntimeStructSpecs", pos, typ, field)
+						}
+					}
+				}
+			}
+			return true
+		})
+	}
+}
+
+func stringLit(e ast.Expr) []string {
+	if lit, ok := e.(*ast.BasicLit); ok && lit.Kind == token.STRING {
+		if s, err := strconv.Unquote(lit.Value); err == nil {
+			return []string{s}
+		}
+	}
+	return nil
+}
+
+func specFields(typ string) []string {
+	for _, spec := range bin.RuntimeStructSpecs {
+		if spec.Type == typ {
+			return spec.Fields
+		}
+	}
+	return nil
+}
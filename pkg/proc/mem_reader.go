@@ -7,9 +7,15 @@ import (
 type ProcessMemReader interface {
 	io.ReaderAt
 	Close() error
+	Pid() int
 	RuntimeInfo() (*Runtime, error)
 	Goroutines(showDead bool) ([]G, error)
 	GetGoroutineStackTraceByGoID(goid int64) ([]StackFrame, error)
+	StackTrace(g G) ([]StackFrame, error)
 	Ps() ([]P, error)
 	MemStat() (*MemStat, error)
+	Frozen(fn func() error) error
+	CacheStats() ReadStats
+	Modules() ([]LoadedModule, error)
+	SampleThreads() ([]ThreadSample, error)
 }
@@ -3,14 +3,23 @@ package proc
 import (
 	"bytes"
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"io"
+	"log"
 	"sync"
 	"unsafe"
 
 	bin "github.com/monsterxx03/gospy/pkg/binary"
 )
 
+// Upper bounds for lengths read from the target, a torn read or a wrong
+// layout must not turn into a huge allocation
+const (
+	maxStringLen      = 1 << 20 // modinfo and environment values are far smaller
+	maxStringSliceLen = 1 << 16 // args and environment entries
+)
+
 type reader interface {
 	io.ReaderAt
 	GetBinaryLoader() bin.BinaryLoader
@@ -26,9 +35,106 @@ type reader interface {
 	readPtrSlice(addr uint64) ([]uint64, error)
 }
 
+// batchReader is implemented by backends that can read many ranges in a few syscalls
+type batchReader interface {
+	readBatch(addrs []uint64, bufs [][]byte) error
+}
+
+// clockReader is implemented by backends that know the target's monotonic
+// clock (runtime.nanotime), wait durations and uptime are measured against it
+type clockReader interface {
+	targetNanotime() int64 // 0 if unknown
+}
+
+// clock is the target's runtime.nanotime now, or when a snapshot was
+// captured. 0 if the backend doesn't know it.
+func (r *commonMemReader) clock() int64 {
+	if cr, ok := r.reader.(clockReader); ok {
+		return cr.targetNanotime()
+	}
+	return 0
+}
+
 type commonMemReader struct {
 	reader
 	pid int
+
+	// freeze stops the target and returns a func resuming it, nil if freezing is disabled
+	freeze func() (thaw func() error, err error)
+	warmed bool // symbols and DWARF offsets loaded before the first freeze
+
+	staticOnce sync.Once
+	static     *Runtime // see staticRuntimeInfo, per reader since pids are reused and remote pids collide
+
+	cache   *pageCache  // nil for readers that don't benefit, e.g. cores and snapshots
+	modules moduleTable // shared libraries and plugins, see refreshModules
+}
+
+// Pid returns the target process ID
+func (r *commonMemReader) Pid() int {
+	return r.pid
+}
+
+// ReadAt reads target memory through the page cache if the reader has one.
+// All decoding goes through here, the platform ReadAt is the uncached path.
+func (r *commonMemReader) ReadAt(p []byte, off int64) (int, error) {
+	if r.cache == nil {
+		return r.reader.ReadAt(p, off)
+	}
+	return r.cache.readAt(r.reader, p, off)
+}
+
+// CacheStats returns page cache statistics, all zero if the reader has no cache
+func (r *commonMemReader) CacheStats() ReadStats {
+	return r.cache.snapshotStats()
+}
+
+// newView makes the next reads go to the target again, even inside Frozen
+func (r *commonMemReader) newView() {
+	r.cache.newGeneration()
+}
+
+// Frozen runs fn with the target stopped when the reader was created
+// WithFreeze, otherwise it just runs fn. The target is always resumed, a
+// budget overrun is logged since the reads are then likely torn.
+func (r *commonMemReader) Frozen(fn func() error) error {
+	// all reads in fn are one generation of the page cache
+	r.cache.pin()
+	defer r.cache.unpin()
+
+	if r.freeze == nil {
+		return fn()
+	}
+	if !r.warmed {
+		// symbols and DWARF offsets are loaded lazily, which can take longer
+		// than the whole budget, so load them with the target still running
+		r.warmLayout()
+		r.warmed = true
+	}
+	thaw, err := r.freeze()
+	if err != nil {
+		return fmt.Errorf("failed to freeze process %d: %w", r.pid, err)
+	}
+	fnErr := fn()
+	if err := thaw(); err != nil {
+		if !errors.Is(err, ErrFreezeBudgetExceeded) {
+			return fmt.Errorf("failed to resume process %d: %w", r.pid, err)
+		}
+		log.Printf("WARNING: %v", err)
+	}
+	return fnErr
+}
+
+// warmLayout loads the parts of a read that never change: symbols, DWARF
+// struct offsets and the static runtime info. Nothing per goroutine or P.
+func (r *commonMemReader) warmLayout() {
+	r.staticRuntimeInfo()
+	if _, err := r.GetBinaryLoader().GetSymbols(); err != nil {
+		return
+	}
+	if dwarfLoader, err := r.GetBinaryLoader().GetDWARFLoader(); err == nil {
+		bin.ExtractLayout(dwarfLoader, r.staticRuntimeInfo().GoVersion, bin.RuntimeStructSpecs)
+	}
 }
 
 func (r *commonMemReader) readBool(addr uint64) (bool, error) {
@@ -49,7 +155,7 @@ func (r *commonMemReader) readUint16(addr uint64) (uint16, error) {
 	if _, err := r.ReadAt(buf, int64(addr)); err != nil {
 		return 0, fmt.Errorf("ReadUint16 failed: %w", err)
 	}
-	return binary.LittleEndian.Uint16(buf), nil
+	return r.byteOrder().Uint16(buf), nil
 }
 
 func (r *commonMemReader) readUint32(addr uint64) (uint32, error) {
@@ -57,7 +163,7 @@ func (r *commonMemReader) readUint32(addr uint64) (uint32, error) {
 	if _, err := r.ReadAt(buf, int64(addr)); err != nil {
 		return 0, fmt.Errorf("ReadUint32 failed: %w", err)
 	}
-	return binary.LittleEndian.Uint32(buf), nil
+	return r.byteOrder().Uint32(buf), nil
 }
 
 func (r *commonMemReader) readUint64(addr uint64) (uint64, error) {
@@ -65,7 +171,40 @@ func (r *commonMemReader) readUint64(addr uint64) (uint64, error) {
 	if _, err := r.ReadAt(buf, int64(addr)); err != nil {
 		return 0, fmt.Errorf("ReadUint64 failed: %w", err)
 	}
-	return binary.LittleEndian.Uint64(buf), nil
+	return r.byteOrder().Uint64(buf), nil
+}
+
+// readPtr reads a target pointer (uintptr), 4 or 8 bytes depending on the target
+func (r *commonMemReader) readPtr(addr uint64) (uint64, error) {
+	buf := make([]byte, r.ptrSize())
+	if _, err := r.ReadAt(buf, int64(addr)); err != nil {
+		return 0, fmt.Errorf("ReadPtr failed: %w", err)
+	}
+	return r.ptrAt(buf, 0), nil
+}
+
+// byteOrder returns the target's byte order, little endian if unknown
+func (r *commonMemReader) byteOrder() binary.ByteOrder {
+	if loader := r.GetBinaryLoader(); loader != nil {
+		return loader.ByteOrder()
+	}
+	return binary.LittleEndian
+}
+
+// ptrSize returns the target's pointer size, 8 if unknown
+func (r *commonMemReader) ptrSize() int {
+	if loader := r.GetBinaryLoader(); loader != nil {
+		return loader.PtrSize()
+	}
+	return 8
+}
+
+// ptrAt decodes a target pointer (or int/uint/uintptr) at off in data
+func (r *commonMemReader) ptrAt(data []byte, off uint64) uint64 {
+	if r.ptrSize() == 4 {
+		return uint64(r.byteOrder().Uint32(data[off:]))
+	}
+	return r.byteOrder().Uint64(data[off:])
 }
 
 func (r *commonMemReader) readInt8(addr uint64) (int8, error) {
@@ -89,17 +228,22 @@ func (r *commonMemReader) readInt64(addr uint64) (int64, error) {
 }
 
 func (r *commonMemReader) readString(addr uint64) (string, error) {
-	header := make([]byte, 16)
+	// string header: data pointer + length, each pointer sized
+	ptrSize := uint64(r.ptrSize())
+	header := make([]byte, 2*ptrSize)
 	if _, err := r.ReadAt(header, int64(addr)); err != nil {
 		return "", fmt.Errorf("failed to read string header: %w", err)
 	}
 
-	dataPtr := binary.LittleEndian.Uint64(header[:8])
-	strLen := binary.LittleEndian.Uint64(header[8:16])
+	dataPtr := r.ptrAt(header, 0)
+	strLen := r.ptrAt(header, ptrSize)
 
 	if dataPtr == 0 || strLen == 0 {
 		return "", nil
 	}
+	if strLen > maxStringLen {
+		return "", fmt.Errorf("implausible string length %d at 0x%x", strLen, addr)
+	}
 
 	data := make([]byte, strLen)
 	if _, err := r.ReadAt(data, int64(dataPtr)); err != nil {
@@ -109,6 +253,50 @@ func (r *commonMemReader) readString(addr uint64) (string, error) {
 	return string(data), nil
 }
 
+// readStringSlice reads a Go []string from memory
+func (r *commonMemReader) readStringSlice(addr uint64) ([]string, error) {
+	ptrSize := uint64(r.ptrSize())
+	buf := sliceHeaderPool.Get().([]byte)
+	defer sliceHeaderPool.Put(buf)
+	header := buf[:3*ptrSize]
+
+	if _, err := r.ReadAt(header, int64(addr)); err != nil {
+		return nil, fmt.Errorf("failed to read slice header: %w", err)
+	}
+	dataPtr := r.ptrAt(header, 0)
+	length := r.ptrAt(header, ptrSize)
+	if dataPtr == 0 || length == 0 {
+		return nil, nil
+	}
+	if length > maxStringSliceLen {
+		return nil, fmt.Errorf("implausible string slice length %d at 0x%x", length, addr)
+	}
+
+	// each element is a string header: data pointer + length
+	strHeaderSize := 2 * ptrSize
+	headers := make([]byte, length*strHeaderSize)
+	if _, err := r.ReadAt(headers, int64(dataPtr)); err != nil {
+		return nil, fmt.Errorf("failed to read string headers: %w", err)
+	}
+	strs := make([]string, length)
+	for i := range strs {
+		strPtr := r.ptrAt(headers, uint64(i)*strHeaderSize)
+		strLen := r.ptrAt(headers, uint64(i)*strHeaderSize+ptrSize)
+		if strPtr == 0 || strLen == 0 {
+			continue
+		}
+		if strLen > maxStringLen {
+			return nil, fmt.Errorf("implausible length %d of string %d at 0x%x", strLen, i, addr)
+		}
+		data := make([]byte, strLen)
+		if _, err := r.ReadAt(data, int64(strPtr)); err != nil {
+			return nil, fmt.Errorf("failed to read string data: %w", err)
+		}
+		strs[i] = string(data)
+	}
+	return strs, nil
+}
+
 // readSlice reads a Go slice from memory and returns its raw data and length
 var sliceHeaderPool = sync.Pool{
 	New: func() interface{} {
@@ -117,20 +305,20 @@ var sliceHeaderPool = sync.Pool{
 }
 
 func (r *commonMemReader) readSlice(addr uint64) ([]byte, uint64, error) {
-	// Slice header layout (64-bit):
-	// 0-7: data pointer
-	// 8-15: length
-	// 16-23: capacity
-	header := sliceHeaderPool.Get().([]byte)
-	defer sliceHeaderPool.Put(header)
+	// Slice header layout, each field pointer sized:
+	// data pointer, length, capacity
+	ptrSize := uint64(r.ptrSize())
+	buf := sliceHeaderPool.Get().([]byte)
+	defer sliceHeaderPool.Put(buf)
+	header := buf[:3*ptrSize]
 
 	if _, err := r.ReadAt(header, int64(addr)); err != nil {
 		return nil, 0, fmt.Errorf("failed to read slice header: %w", err)
 	}
 
-	dataPtr := binary.LittleEndian.Uint64(header[:8])
-	length := binary.LittleEndian.Uint64(header[8:16])
-	capacity := binary.LittleEndian.Uint64(header[16:24])
+	dataPtr := r.ptrAt(header, 0)
+	length := r.ptrAt(header, ptrSize)
+	capacity := r.ptrAt(header, 2*ptrSize)
 
 	if dataPtr == 0 || length == 0 {
 		return nil, 0, nil
@@ -140,8 +328,7 @@ func (r *commonMemReader) readSlice(addr uint64) ([]byte, uint64, error) {
 		return nil, 0, fmt.Errorf("invalid slice: length (%d) > capacity (%d)", length, capacity)
 	}
 
-	ptrSize := r.GetBinaryLoader().PtrSize()
-	data := make([]byte, length*uint64(ptrSize))
+	data := make([]byte, length*ptrSize)
 	if _, err := r.ReadAt(data, int64(dataPtr)); err != nil {
 		return nil, 0, fmt.Errorf("failed to read slice data: %w", err)
 	}
@@ -149,6 +336,24 @@ func (r *commonMemReader) readSlice(addr uint64) ([]byte, uint64, error) {
 	return data, length, nil
 }
 
+// readSliceHeader reads the data pointer and length of a Go slice
+func (r *commonMemReader) readSliceHeader(addr uint64) (uint64, uint64, error) {
+	ptrSize := uint64(r.ptrSize())
+	buf := sliceHeaderPool.Get().([]byte)
+	defer sliceHeaderPool.Put(buf)
+	header := buf[:3*ptrSize]
+
+	if _, err := r.ReadAt(header, int64(addr)); err != nil {
+		return 0, 0, fmt.Errorf("failed to read slice header: %w", err)
+	}
+	dataPtr := r.ptrAt(header, 0)
+	length := r.ptrAt(header, ptrSize)
+	if dataPtr == 0 {
+		return 0, 0, nil
+	}
+	return dataPtr, length, nil
+}
+
 // readPtrSlice reads a slice of pointers from memory
 // readStruct reads a struct from memory into the provided struct pointer
 func (r *commonMemReader) readStruct(addr uint64, out interface{}) error {
@@ -158,7 +363,7 @@ func (r *commonMemReader) readStruct(addr uint64, out interface{}) error {
 	if err != nil {
 		return fmt.Errorf("failed to read struct: %w", err)
 	}
-	return binary.Read(bytes.NewReader(buf), binary.LittleEndian, out)
+	return binary.Read(bytes.NewReader(buf), r.byteOrder(), out)
 }
 
 // readArray reads an array from memory in one operation
@@ -180,7 +385,24 @@ func (r *commonMemReader) readPtrBatch(ptrs []uint64, gSize uint64) ([]byte, err
 	totalSize := gSize * uint64(len(ptrs))
 	buf := make([]byte, totalSize)
 
-	// Read all ptrs in one batch
+	if br, ok := r.reader.(batchReader); ok {
+		addrs := make([]uint64, 0, len(ptrs))
+		bufs := make([][]byte, 0, len(ptrs))
+		for i, ptr := range ptrs {
+			if ptr == 0 {
+				continue
+			}
+			addrs = append(addrs, ptr)
+			bufs = append(bufs, buf[i*int(gSize):(i+1)*int(gSize)])
+		}
+		if err := br.readBatch(addrs, bufs); err != nil {
+			return nil, fmt.Errorf("failed to read goroutines: %w", err)
+		}
+		r.cache.countDirect(len(bufs) * int(gSize))
+		return buf, nil
+	}
+
+	// Read ptrs one by one
 	for i, ptr := range ptrs {
 		if ptr == 0 {
 			continue
@@ -201,16 +423,11 @@ func (r *commonMemReader) readPtrSlice(addr uint64) ([]uint64, error) {
 	if length == 0 {
 		return nil, nil
 	}
-	ptrSize := r.GetBinaryLoader().PtrSize()
+	ptrSize := uint64(r.ptrSize())
 	pointers := make([]uint64, length)
 
 	for i := uint64(0); i < length; i++ {
-		offset := i * uint64(ptrSize)
-		if ptrSize == 8 {
-			pointers[i] = binary.LittleEndian.Uint64(data[offset : offset+8])
-		} else {
-			pointers[i] = uint64(binary.LittleEndian.Uint32(data[offset : offset+4]))
-		}
+		pointers[i] = r.ptrAt(data, i*ptrSize)
 	}
 
 	return pointers, nil
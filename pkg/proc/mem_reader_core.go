@@ -0,0 +1,373 @@
+//go:build linux
+
+package proc
+
+import (
+	"bytes"
+	"debug/elf"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"strings"
+
+	bin "github.com/monsterxx03/gospy/pkg/binary"
+)
+
+// Note types found in Linux core files
+const (
+	_NT_PRSTATUS = 1
+	_NT_AUXV     = 6
+	_NT_FILE     = 0x46494c45 // "FILE"
+
+	// offset of pr_pid in struct elf_prstatus on 64 and 32-bit Linux
+	prstatusPidOffset64 = 32
+	prstatusPidOffset32 = 24
+)
+
+// coreSegment is a PT_LOAD segment of the core file
+type coreSegment struct {
+	vaddr  uint64
+	memsz  uint64
+	filesz uint64
+	offset uint64
+}
+
+// coreMapping is a file backed mapping listed in NT_FILE
+type coreMapping struct {
+	start, end uint64
+	fileOffset uint64
+	path       string
+}
+
+type coreMemReader struct {
+	commonMemReader
+	core       *os.File
+	segments   []coreSegment // sorted by vaddr
+	mappings   []coreMapping
+	files      map[string]*os.File // opened mapping files, nil if unavailable
+	exePath    string              // executable path as recorded in the core
+	binPath    string              // executable used for analysis
+	bin        bin.BinaryLoader
+	staticBase uint64
+}
+
+func newCoreMemReader(corePath, binPath string, opts *options) (ProcessMemReader, error) {
+	f, err := os.Open(corePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open core file: %w", err)
+	}
+	ef, err := elf.NewFile(f)
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("failed to parse core file: %w", err)
+	}
+	if ef.Type != elf.ET_CORE {
+		f.Close()
+		return nil, fmt.Errorf("%s is not a core file (type %s)", corePath, ef.Type)
+	}
+
+	r := &coreMemReader{core: f, files: make(map[string]*os.File)}
+	wordSize := 8
+	if ef.Class == elf.ELFCLASS32 {
+		wordSize = 4
+	}
+	var pid int
+	var entry uint64
+	for _, prog := range ef.Progs {
+		switch prog.Type {
+		case elf.PT_LOAD:
+			r.segments = append(r.segments, coreSegment{
+				vaddr:  prog.Vaddr,
+				memsz:  prog.Memsz,
+				filesz: prog.Filesz,
+				offset: prog.Off,
+			})
+		case elf.PT_NOTE:
+			data := make([]byte, prog.Filesz)
+			if _, err := prog.ReadAt(data, 0); err != nil {
+				f.Close()
+				return nil, fmt.Errorf("failed to read core notes: %w", err)
+			}
+			if err := r.parseNotes(data, ef.ByteOrder, wordSize, &pid, &entry); err != nil {
+				f.Close()
+				return nil, err
+			}
+		}
+	}
+	sort.Slice(r.segments, func(i, j int) bool { return r.segments[i].vaddr < r.segments[j].vaddr })
+
+	// the first NT_FILE mapping is the executable
+	if len(r.mappings) > 0 {
+		r.exePath = r.mappings[0].path
+	}
+	r.binPath = binPath
+	if r.binPath == "" {
+		r.binPath = r.exePath
+	}
+	if r.binPath == "" {
+		f.Close()
+		return nil, errors.New("core has no NT_FILE note, executable path is required")
+	}
+
+	loader := bin.NewBinaryLoader()
+	if err := loader.Load(r.binPath); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("failed to load binary: %w", err)
+	}
+	if entry == 0 {
+		loader.Close()
+		f.Close()
+		return nil, errors.New("AT_ENTRY not found in core NT_AUXV note")
+	}
+	r.bin = loader
+	r.staticBase = entry - loader.GetFile().(*elf.File).Entry
+	r.commonMemReader = commonMemReader{reader: r, pid: pid}
+
+	if err := r.verifyBinary(); err != nil {
+		if !opts.allowMismatch {
+			r.Close()
+			return nil, err
+		}
+		log.Printf("WARNING: %v, results will likely be wrong", err)
+	}
+	return r, nil
+}
+
+// verifyBinary checks the loaded binary against the build IDs of the
+// executable the core was dumped from. The executable at the path recorded in
+// the core may have been rebuilt since, so it's only used when the core lacks
+// the executable's first page.
+func (r *coreMemReader) verifyBinary() error {
+	file := r.bin.GetFile().(*elf.File)
+	gnu, goID := r.dumpedBuildIDs()
+	if gnu == nil && goID == "" && r.exePath != "" && r.exePath != r.binPath {
+		if exe, err := elf.Open(r.exePath); err == nil {
+			gnu, goID = bin.GNUBuildID(exe), bin.GoBuildID(exe)
+			exe.Close()
+		}
+	}
+	if problems := buildIDProblems(file, gnu, goID); len(problems) > 0 {
+		return fmt.Errorf("%w: %s (pass the crashed executable with --bin)", ErrBinaryMismatch, strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// dumpedBuildIDs returns the build IDs of the crashed executable. Linux dumps
+// the first page of ELF mappings (coredump_filter bit 4, on by default), which
+// holds the notes of Go binaries. Only the core is read: readMapped would read
+// the loaded binary itself.
+func (r *coreMemReader) dumpedBuildIDs() ([]byte, string) {
+	for _, m := range r.mappings {
+		if m.path != r.exePath || m.fileOffset != 0 {
+			continue
+		}
+		i := sort.Search(len(r.segments), func(i int) bool {
+			return r.segments[i].vaddr+r.segments[i].memsz > m.start
+		})
+		if i == len(r.segments) || r.segments[i].vaddr > m.start {
+			return nil, ""
+		}
+		seg := r.segments[i]
+		segOff := m.start - seg.vaddr
+		if segOff >= seg.filesz {
+			return nil, ""
+		}
+		head := make([]byte, min(seg.filesz-segOff, m.end-m.start, 64<<10))
+		n, _ := r.core.ReadAt(head, int64(seg.offset+segOff))
+		return bin.HeaderBuildIDs(head[:n])
+	}
+	return nil, ""
+}
+
+func (r *coreMemReader) parseNotes(data []byte, order binary.ByteOrder, wordSize int, pid *int, entry *uint64) error {
+	pidOffset := prstatusPidOffset64
+	if wordSize == 4 {
+		pidOffset = prstatusPidOffset32
+	}
+	for len(data) >= 12 {
+		namesz := uint64(order.Uint32(data[0:4]))
+		descsz := uint64(order.Uint32(data[4:8]))
+		ntype := order.Uint32(data[8:12])
+		data = data[12:]
+		descOff := alignUp(namesz, 4)
+		if uint64(len(data)) < descOff+descsz {
+			return errors.New("truncated core note")
+		}
+		desc := data[descOff : descOff+descsz]
+
+		switch ntype {
+		case _NT_PRSTATUS:
+			// first thread's prstatus carries the process pid
+			if *pid == 0 && len(desc) >= pidOffset+4 {
+				*pid = int(order.Uint32(desc[pidOffset:]))
+			}
+		case _NT_AUXV:
+			*entry = parseAuxvEntry(desc, wordSize, order)
+		case _NT_FILE:
+			mappings, err := parseNTFile(desc, order, wordSize)
+			if err != nil {
+				return err
+			}
+			r.mappings = mappings
+		}
+
+		next := descOff + alignUp(descsz, 4)
+		if uint64(len(data)) < next {
+			break
+		}
+		data = data[next:]
+	}
+	return nil
+}
+
+// parseNTFile decodes NT_FILE: count, page size, count*(start, end, page offset), then file names.
+// All numbers are words of the core's class.
+func parseNTFile(desc []byte, order binary.ByteOrder, wordSize int) ([]coreMapping, error) {
+	w := uint64(wordSize)
+	word := func(b []byte, i uint64) uint64 {
+		if wordSize == 4 {
+			return uint64(order.Uint32(b[i*w:]))
+		}
+		return order.Uint64(b[i*w:])
+	}
+	if uint64(len(desc)) < 2*w {
+		return nil, errors.New("truncated NT_FILE note")
+	}
+	count := word(desc, 0)
+	pageSize := word(desc, 1)
+	entries := desc[2*w:]
+	if uint64(len(entries)) < count*3*w {
+		return nil, errors.New("truncated NT_FILE entries")
+	}
+	names := bytes.Split(entries[count*3*w:], []byte{0})
+	if uint64(len(names)) < count {
+		return nil, errors.New("truncated NT_FILE names")
+	}
+
+	mappings := make([]coreMapping, count)
+	for i := range mappings {
+		e := uint64(i) * 3
+		mappings[i] = coreMapping{
+			start:      word(entries, e),
+			end:        word(entries, e+1),
+			fileOffset: word(entries, e+2) * pageSize,
+			path:       string(names[i]),
+		}
+	}
+	return mappings, nil
+}
+
+func alignUp(v, align uint64) uint64 {
+	return (v + align - 1) &^ (align - 1)
+}
+
+// ReadAt reads memory at virtual address off. Bytes not dumped into the core
+// (e.g. read-only text/rodata) are read from the backing file in NT_FILE.
+func (r *coreMemReader) ReadAt(p []byte, off int64) (int, error) {
+	n := 0
+	for n < len(p) {
+		addr := uint64(off) + uint64(n)
+		read, err := r.readChunk(p[n:], addr)
+		if err != nil {
+			return n, err
+		}
+		n += read
+	}
+	return n, nil
+}
+
+// readChunk reads from the segment containing addr, up to the segment end
+func (r *coreMemReader) readChunk(p []byte, addr uint64) (int, error) {
+	i := sort.Search(len(r.segments), func(i int) bool {
+		return r.segments[i].vaddr+r.segments[i].memsz > addr
+	})
+	if i == len(r.segments) || r.segments[i].vaddr > addr {
+		return 0, fmt.Errorf("address 0x%x not in core", addr)
+	}
+	seg := r.segments[i]
+	segOff := addr - seg.vaddr
+	if remain := seg.memsz - segOff; uint64(len(p)) > remain {
+		p = p[:remain]
+	}
+
+	if segOff+uint64(len(p)) <= seg.filesz {
+		return r.core.ReadAt(p, int64(seg.offset+segOff))
+	}
+	if segOff < seg.filesz {
+		// partially dumped, read the dumped part first
+		return r.core.ReadAt(p[:seg.filesz-segOff], int64(seg.offset+segOff))
+	}
+	return r.readMapped(p, addr)
+}
+
+// readMapped reads bytes missing from the core from the file mapped at addr,
+// or zeros if the mapping is anonymous
+func (r *coreMemReader) readMapped(p []byte, addr uint64) (int, error) {
+	for _, m := range r.mappings {
+		if addr < m.start || addr >= m.end {
+			continue
+		}
+		if remain := m.end - addr; uint64(len(p)) > remain {
+			p = p[:remain]
+		}
+		f := r.mappingFile(m.path)
+		if f == nil {
+			return 0, fmt.Errorf("address 0x%x is backed by %s, which is not available", addr, m.path)
+		}
+		n, err := f.ReadAt(p, int64(m.fileOffset+addr-m.start))
+		if err == io.EOF {
+			// mapping extends past the end of file
+			clear(p[n:])
+			return len(p), nil
+		}
+		return n, err
+	}
+	clear(p)
+	return len(p), nil
+}
+
+func (r *coreMemReader) mappingFile(path string) *os.File {
+	if f, ok := r.files[path]; ok {
+		return f
+	}
+	openPath := path
+	if path == r.exePath {
+		openPath = r.binPath
+	}
+	f, _ := os.Open(openPath) // nil if unavailable, remembered so we don't retry
+	r.files[path] = f
+	return f
+}
+
+// mappedFile implements moduleMapper with the NT_FILE mappings
+func (r *coreMemReader) mappedFile(addr uint64) (string, string, error) {
+	for _, m := range r.mappings {
+		if addr >= m.start && addr < m.end {
+			return m.path, m.path, nil
+		}
+	}
+	return "", "", fmt.Errorf("no file mapped at 0x%x", addr)
+}
+
+func (r *coreMemReader) Close() error {
+	for _, f := range r.files {
+		if f != nil {
+			f.Close()
+		}
+	}
+	r.closeModules()
+	r.bin.Close()
+	return r.core.Close()
+}
+
+func (r *coreMemReader) GetBinaryLoader() bin.BinaryLoader {
+	return r.bin
+}
+
+func (r *coreMemReader) GetStaticBase() uint64 {
+	return r.staticBase
+}
@@ -0,0 +1,268 @@
+//go:build linux
+
+package proc
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"testing"
+	"time"
+
+	bin "github.com/monsterxx03/gospy/pkg/binary"
+)
+
+// coreNote encodes a note as the kernel writes it into PT_NOTE of a core
+func coreNote(order binary.ByteOrder, typ uint32, desc []byte) []byte {
+	var b bytes.Buffer
+	binary.Write(&b, order, uint32(5))
+	binary.Write(&b, order, uint32(len(desc)))
+	binary.Write(&b, order, typ)
+	b.WriteString("CORE\x00\x00\x00\x00")
+	b.Write(desc)
+	b.Write(make([]byte, alignUp(uint64(len(desc)), 4)-uint64(len(desc))))
+	return b.Bytes()
+}
+
+// words encodes vals as words of the core's class
+func words(order binary.ByteOrder, wordSize int, vals ...uint64) []byte {
+	b := make([]byte, len(vals)*wordSize)
+	for i, v := range vals {
+		if wordSize == 4 {
+			order.PutUint32(b[i*4:], uint32(v))
+		} else {
+			order.PutUint64(b[i*8:], v)
+		}
+	}
+	return b
+}
+
+func TestParseNotes(t *testing.T) {
+	tests := []struct {
+		name      string
+		wordSize  int
+		pidOffset int
+		order     binary.ByteOrder
+	}{
+		{"64-bit", 8, prstatusPidOffset64, binary.LittleEndian},
+		{"32-bit", 4, prstatusPidOffset32, binary.LittleEndian},
+		{"64-bit big endian", 8, prstatusPidOffset64, binary.BigEndian},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			prstatus := func(pid uint32) []byte {
+				desc := make([]byte, tt.pidOffset+64)
+				tt.order.PutUint32(desc[tt.pidOffset:], pid)
+				return desc
+			}
+			ntFile := append(words(tt.order, tt.wordSize,
+				2, 4096, // count, page size
+				0x400000, 0x402000, 0,
+				0x7f0000, 0x7f1000, 3,
+			), "/app\x00/lib/x.so\x00"...)
+			var data []byte
+			for _, note := range [][]byte{
+				coreNote(tt.order, _NT_PRSTATUS, prstatus(1234)),
+				coreNote(tt.order, _NT_PRSTATUS, prstatus(1235)), // another thread
+				coreNote(tt.order, _NT_AUXV, words(tt.order, tt.wordSize, 3, 0x400040, _AT_ENTRY, 0x401000, _AT_NULL, 0)),
+				coreNote(tt.order, _NT_FILE, ntFile),
+			} {
+				data = append(data, note...)
+			}
+
+			r := &coreMemReader{}
+			var pid int
+			var entry uint64
+			if err := r.parseNotes(data, tt.order, tt.wordSize, &pid, &entry); err != nil {
+				t.Fatal(err)
+			}
+			if pid != 1234 || entry != 0x401000 {
+				t.Errorf("got pid %d, entry 0x%x, want 1234, 0x401000", pid, entry)
+			}
+			want := []coreMapping{
+				{start: 0x400000, end: 0x402000, fileOffset: 0, path: "/app"},
+				{start: 0x7f0000, end: 0x7f1000, fileOffset: 3 * 4096, path: "/lib/x.so"},
+			}
+			if !reflect.DeepEqual(r.mappings, want) {
+				t.Errorf("got mappings %+v, want %+v", r.mappings, want)
+			}
+
+			if err := r.parseNotes(data[:len(data)-8], tt.order, tt.wordSize, &pid, &entry); err == nil {
+				t.Error("truncated notes accepted")
+			}
+			short := coreNote(tt.order, _NT_FILE, words(tt.order, tt.wordSize, 3, 4096, 0x400000, 0x402000, 0))
+			if err := r.parseNotes(short, tt.order, tt.wordSize, &pid, &entry); err == nil {
+				t.Error("NT_FILE with missing entries accepted")
+			}
+		})
+	}
+}
+
+func TestCoreVerifyBinary(t *testing.T) {
+	if testing.Short() {
+		t.Skip("builds fixtures")
+	}
+	same := buildFixture(t, runtime.GOARCH)
+	other := buildFixture(t, runtime.GOARCH, "-gcflags=all=-N -l")
+	exe, err := os.ReadFile(same)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// only the executable's first page, as dumped with the default coredump_filter
+	corePath := filepath.Join(t.TempDir(), "core")
+	if err := os.WriteFile(corePath, exe[:4096], 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		bin     string
+		dumped  bool   // the first page is in the core
+		exePath string // the executable recorded in NT_FILE
+		wantErr error
+	}{
+		{name: "same build", bin: same, dumped: true, exePath: "/crashed/fixture"},
+		{name: "other build", bin: other, dumped: true, exePath: "/crashed/fixture", wantErr: ErrBinaryMismatch},
+		// the recorded executable is used when the core lacks its first page
+		{name: "not dumped, other build", bin: other, exePath: same, wantErr: ErrBinaryMismatch},
+		{name: "not dumped, executable gone", bin: other, exePath: "/crashed/fixture"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			core, err := os.Open(corePath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer core.Close()
+			loader := bin.NewBinaryLoader()
+			if err := loader.Load(tt.bin); err != nil {
+				t.Fatal(err)
+			}
+			defer loader.Close()
+
+			seg := coreSegment{vaddr: 0x400000, memsz: 0x2000}
+			if tt.dumped {
+				seg.filesz = 0x1000
+			}
+			r := &coreMemReader{
+				core:     core,
+				segments: []coreSegment{seg},
+				mappings: []coreMapping{{start: 0x400000, end: 0x500000, path: tt.exePath}},
+				exePath:  tt.exePath,
+				binPath:  tt.bin,
+				bin:      loader,
+			}
+			if err := r.verifyBinary(); !errors.Is(err, tt.wantErr) {
+				t.Errorf("got %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// processView is what the commands read from a process, clocks left out
+type processView struct {
+	rt     Runtime
+	gs     []G
+	stacks [][]StackFrame
+}
+
+func readView(t *testing.T, r ProcessMemReader) processView {
+	t.Helper()
+	var v processView
+	rt, err := r.RuntimeInfo()
+	if err != nil {
+		t.Fatal(err)
+	}
+	v.rt, v.rt.Nanotime = *rt, 0
+	if v.gs, err = r.Goroutines(false); err != nil {
+		t.Fatal(err)
+	}
+	for i, g := range v.gs {
+		frames, err := r.StackTrace(g)
+		if err != nil {
+			t.Fatalf("stack of goroutine %d: %v", g.Goid, err)
+		}
+		v.stacks = append(v.stacks, frames)
+		v.gs[i].Nanotime = 0
+	}
+	return v
+}
+
+// TestSnapshotRoundTrip checks that a snapshot captures every range gospy
+// reads: reopened, it must show what the live process does
+func TestSnapshotRoundTrip(t *testing.T) {
+	if testing.Short() {
+		t.Skip("builds fixtures")
+	}
+	pid := startFixture(t)
+	live, err := NewProcessMemReader(pid, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer live.Close()
+
+	// the fixture is idle, but runtime goroutines may still be settling
+	var want, got processView
+	var h *SnapshotHeader
+	var snap ProcessMemReader
+	for attempt := 0; attempt < 5; attempt++ {
+		path := filepath.Join(t.TempDir(), "fixture.gospy")
+		f, err := os.Create(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		h, err = CaptureSnapshot(live, f, true)
+		f.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if snap, err = NewSnapshotMemReader(path, ""); err != nil {
+			t.Fatal(err)
+		}
+		defer snap.Close()
+
+		want, got = readView(t, live), readView(t, snap)
+		if reflect.DeepEqual(got, want) {
+			break
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	if !reflect.DeepEqual(got.rt, want.rt) {
+		t.Errorf("runtime info from the snapshot:\n%+v\nlive:\n%+v", got.rt, want.rt)
+	}
+	if len(got.rt.Warnings) > 0 {
+		t.Errorf("warnings reading the snapshot: %q", got.rt.Warnings)
+	}
+	if len(got.gs) != len(want.gs) {
+		t.Fatalf("%d goroutines in the snapshot, %d live", len(got.gs), len(want.gs))
+	}
+	for i := range want.gs {
+		if !reflect.DeepEqual(got.gs[i], want.gs[i]) {
+			t.Errorf("goroutine from the snapshot:\n%+v\nlive:\n%+v", got.gs[i], want.gs[i])
+		}
+		if len(want.stacks[i]) == 0 || !reflect.DeepEqual(got.stacks[i], want.stacks[i]) {
+			t.Errorf("stack of goroutine %d from the snapshot:\n%v\nlive:\n%v", want.gs[i].Goid, got.stacks[i], want.stacks[i])
+		}
+	}
+	if ps, err := snap.Ps(); err != nil || len(ps) == 0 {
+		t.Errorf("processors from the snapshot: %d, %v", len(ps), err)
+	}
+	if ms, err := snap.MemStat(); err != nil || ms == nil {
+		t.Errorf("memstats from the snapshot: %v", err)
+	}
+
+	// wait durations and uptime are measured against the clock at capture
+	rt, _ := snap.RuntimeInfo()
+	gs, _ := snap.Goroutines(false)
+	if h.Nanotime == 0 || rt.Nanotime != h.Nanotime || gs[0].Nanotime != h.Nanotime {
+		t.Errorf("snapshot clock %d, runtime read at %d, goroutines at %d", h.Nanotime, rt.Nanotime, gs[0].Nanotime)
+	}
+	if up := rt.Uptime(); up <= 0 || up > time.Minute {
+		t.Errorf("uptime at capture %v", up)
+	}
+}
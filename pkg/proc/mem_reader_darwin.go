@@ -12,8 +12,11 @@ package proc
 */
 import "C"
 import (
+	"crypto/tls"
 	"debug/macho"
+	"errors"
 	"fmt"
+	"net"
 	"unsafe"
 
 	bin "github.com/monsterxx03/gospy/pkg/binary"
@@ -27,7 +30,10 @@ type darwinMemReader struct {
 	staticBase uint64
 }
 
-func newProcessMemReader(pid int, binPath string) (ProcessMemReader, error) {
+func newProcessMemReader(pid int, binPath string, opts *options) (ProcessMemReader, error) {
+	if opts.freezeBudget > 0 {
+		return nil, errors.New("freezing the target process is only supported on Linux")
+	}
 	loader := bin.NewBinaryLoader()
 	var err error
 	if binPath != "" {
@@ -49,8 +55,7 @@ func newProcessMemReader(pid int, binPath string) (ProcessMemReader, error) {
 		task: task,
 		bin:  loader,
 	}
-	cr := commonMemReader{reader: dr, pid: pid}
-	dr.commonMemReader = cr
+	dr.commonMemReader = commonMemReader{reader: dr, pid: pid, cache: newPageCache()}
 
 	dr.staticBase, err = dr.getStaticBase()
 	if err != nil {
@@ -59,6 +64,34 @@ func newProcessMemReader(pid int, binPath string) (ProcessMemReader, error) {
 	return dr, nil
 }
 
+func newCoreMemReader(corePath, binPath string, opts *options) (ProcessMemReader, error) {
+	return nil, errors.New("core files are only supported on linux")
+}
+
+func newRemoteMemReader(addr string, tlsConfig *tls.Config, pid int, binPath string, opts *options) (ProcessMemReader, error) {
+	return nil, errors.New("remote targets are only supported on linux")
+}
+
+// ServeAgent is only supported on linux
+func ServeAgent(l net.Listener, allow *Allowlist) error {
+	return errors.New("the agent is only supported on linux")
+}
+
+// FindContainerPid is only supported on linux
+func FindContainerPid(id string) (int, error) {
+	return 0, errors.New("containers are only supported on linux")
+}
+
+// FindGoProcesses is only supported on linux
+func FindGoProcesses() ([]GoProcess, error) {
+	return nil, errors.New("process discovery is only supported on linux")
+}
+
+// binaryIdentity is not implemented for Mach-O, snapshots skip build ID checks
+func binaryIdentity(loader bin.BinaryLoader) (string, string) {
+	return "", ""
+}
+
 func machErrorToString(err C.kern_return_t) string {
 	cStr := C.mach_error_string(err)
 	return C.GoString(cStr)
@@ -112,6 +145,11 @@ func (r *darwinMemReader) GetStaticBase() uint64 {
 	return r.staticBase
 }
 
+// targetNanotime is our own clock, the monotonic clock is the same for every process on the host
+func (r *darwinMemReader) targetNanotime() int64 {
+	return nanotime()
+}
+
 func (r *darwinMemReader) ReadAt(p []byte, off int64) (n int, err error) {
 	var (
 		data  C.vm_offset_t
@@ -142,6 +180,8 @@ func (r *darwinMemReader) Close() error {
 		C.mach_port_deallocate(C.mach_task_self_, r.task)
 		r.task = C.MACH_PORT_NULL
 	}
+	r.closeModules()
+	r.bin.Close()
 	return nil
 }
 
@@ -8,8 +8,10 @@ import (
 	"encoding/binary"
 	"fmt"
 	"io"
+	"log"
 	"os"
 	"path/filepath"
+	"sync"
 
 	bin "github.com/monsterxx03/gospy/pkg/binary"
 )
@@ -20,9 +22,13 @@ type linuxMemReader struct {
 	fd         *os.File
 	bin        bin.BinaryLoader
 	staticBase uint64
+	vmReadv    bool // batch reads use process_vm_readv instead of pread
+
+	tracerOnce sync.Once
+	tracer     *regsTracer // started by the first threadRegs
 }
 
-func newProcessMemReader(pid int, binPath string) (ProcessMemReader, error) {
+func newProcessMemReader(pid int, binPath string, opts *options) (ProcessMemReader, error) {
 	loader := bin.NewBinaryLoader()
 	var err error
 	if binPath != "" {
@@ -36,11 +42,13 @@ func newProcessMemReader(pid int, binPath string) (ProcessMemReader, error) {
 
 	entryPoint, err := getEntryPoint(pid, loader)
 	if err != nil {
+		loader.Close()
 		return nil, fmt.Errorf("failed to calculate static base: %w", err)
 	}
 
 	fd, err := os.Open(fmt.Sprintf("/proc/%d/mem", pid))
 	if err != nil {
+		loader.Close()
 		return nil, fmt.Errorf("failed to open /proc/%d/mem: %w", pid, err)
 	}
 
@@ -50,8 +58,23 @@ func newProcessMemReader(pid int, binPath string) (ProcessMemReader, error) {
 		bin:        loader,
 		staticBase: entryPoint - loader.GetFile().(*elf.File).Entry,
 	}
-	cr := commonMemReader{reader: lr, pid: pid}
-	lr.commonMemReader = cr
+	lr.vmReadv = lr.probeVMReadv(entryPoint)
+	lr.commonMemReader = commonMemReader{reader: lr, pid: pid, cache: newPageCache()}
+	if opts.freezeBudget > 0 {
+		lr.freeze = func() (func() error, error) {
+			return freezeProcess(pid, opts.freezeBudget)
+		}
+	}
+
+	if binPath != "" {
+		if err := lr.verifyBinary(); err != nil {
+			if !opts.allowMismatch {
+				lr.Close()
+				return nil, err
+			}
+			log.Printf("WARNING: %v, results will likely be wrong", err)
+		}
+	}
 	return lr, nil
 }
 
@@ -62,17 +85,18 @@ func getEntryPoint(pid int, loader bin.BinaryLoader) (uint64, error) {
 		return 0, fmt.Errorf("failed to read auxv: %w", err)
 	}
 
-	return parseAuxvEntry(data, loader.(*bin.LinuxBinaryLoader).PtrSize()), nil
+	return parseAuxvEntry(data, loader.PtrSize(), loader.ByteOrder()), nil
 }
 
-func parseAuxvEntry(data []byte, ptrSize int) uint64 {
+// parseAuxvEntry returns AT_ENTRY from an auxiliary vector of ptrSize words
+func parseAuxvEntry(data []byte, ptrSize int, order binary.ByteOrder) uint64 {
 	rd := bytes.NewReader(data)
 	for {
-		tag, err := readUintRaw(rd, binary.LittleEndian, ptrSize)
+		tag, err := readUintRaw(rd, order, ptrSize)
 		if err != nil {
 			return 0
 		}
-		val, err := readUintRaw(rd, binary.LittleEndian, ptrSize)
+		val, err := readUintRaw(rd, order, ptrSize)
 		if err != nil {
 			return 0
 		}
@@ -116,6 +140,11 @@ func (r *linuxMemReader) ReadAt(p []byte, off int64) (n int, err error) {
 }
 
 func (r *linuxMemReader) Close() error {
+	if r.tracer != nil {
+		r.tracer.close()
+	}
+	r.closeModules()
+	r.bin.Close()
 	return r.fd.Close()
 }
 
@@ -126,3 +155,8 @@ func (r *linuxMemReader) GetBinaryLoader() bin.BinaryLoader {
 func (r *linuxMemReader) GetStaticBase() uint64 {
 	return r.staticBase
 }
+
+// targetNanotime is our own clock, CLOCK_MONOTONIC is the same for every process on the host
+func (r *linuxMemReader) targetNanotime() int64 {
+	return nanotime()
+}
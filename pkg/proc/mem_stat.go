@@ -1,9 +1,10 @@
 package proc
 
 import (
-	"encoding/binary"
 	"errors"
 	"fmt"
+
+	bin "github.com/monsterxx03/gospy/pkg/binary"
 )
 
 type MemStat struct {
@@ -45,6 +46,16 @@ type MemStat struct {
 	// EnableGC      bool
 	// DebugGC       bool
 
+	// Heap statistics from runtime.gcController (Go 1.21+), zero if unavailable
+	HeapLive     uint64 `json:"heap_live"`     // bytes in live or unswept objects
+	HeapMarked   uint64 `json:"heap_marked"`   // bytes marked live by the last GC
+	HeapGoal     uint64 `json:"heap_goal"`     // GOGC based heap goal
+	HeapInuse    uint64 `json:"heap_inuse"`    // bytes in in-use spans
+	HeapFree     uint64 `json:"heap_free"`     // bytes in free spans not released to the OS
+	HeapReleased uint64 `json:"heap_released"` // bytes returned to the OS
+	TotalAlloc   uint64 `json:"total_alloc"`   // cumulative bytes allocated
+	TotalFree    uint64 `json:"total_free"`    // cumulative bytes freed
+
 	// Size classes statistics
 	// BySize [61]struct {
 	// 	Size    uint32
@@ -54,6 +65,12 @@ type MemStat struct {
 }
 
 func (r *commonMemReader) MemStat() (*MemStat, error) {
+	r.cache.refresh()
+	return r.memStat()
+}
+
+// memStat is MemStat within the current page cache generation
+func (r *commonMemReader) memStat() (*MemStat, error) {
 	ms := &MemStat{}
 	dwarfLoader, err := r.GetBinaryLoader().GetDWARFLoader()
 	if err != nil {
@@ -94,7 +111,7 @@ func (r *commonMemReader) MemStat() (*MemStat, error) {
 		data, err := r.readArray(arrayAddr, 8, len(ms.PauseNs))
 		if err == nil {
 			for i := 0; i < len(ms.PauseNs); i++ {
-				ms.PauseNs[i] = binary.LittleEndian.Uint64(data[i*8 : (i+1)*8])
+				ms.PauseNs[i] = r.byteOrder().Uint64(data[i*8 : (i+1)*8])
 			}
 		} else {
 			errs = append(errs, fmt.Errorf("failed to read pause_ns array: %w", err))
@@ -107,7 +124,7 @@ func (r *commonMemReader) MemStat() (*MemStat, error) {
 		data, err := r.readArray(arrayAddr, 8, len(ms.PauseEnd))
 		if err == nil {
 			for i := 0; i < len(ms.PauseEnd); i++ {
-				ms.PauseEnd[i] = binary.LittleEndian.Uint64(data[i*8 : (i+1)*8])
+				ms.PauseEnd[i] = r.byteOrder().Uint64(data[i*8 : (i+1)*8])
 			}
 		} else {
 			errs = append(errs, fmt.Errorf("failed to read pause_end array: %w", err))
@@ -123,6 +140,8 @@ func (r *commonMemReader) MemStat() (*MemStat, error) {
 		}
 	}
 
+	r.readHeapStats(ms, dwarfLoader)
+
 	// Return partial results even if some fields failed to read
 	if len(errs) > 0 {
 		return ms, fmt.Errorf("partial read errors: %w", errors.Join(errs...))
@@ -130,3 +149,32 @@ func (r *commonMemReader) MemStat() (*MemStat, error) {
 
 	return ms, nil
 }
+
+// readHeapStats fills the heap fields from runtime.gcController. Best effort,
+// these moved around between Go versions.
+func (r *commonMemReader) readHeapStats(ms *MemStat, dwarfLoader bin.DWARFLoader) {
+	addr, err := r.GetBinaryLoader().FindVariableAddress("runtime.gcController")
+	if err != nil {
+		return
+	}
+	base := r.GetStaticBase() + addr
+	// atomic wrappers and sysMemStat keep the value at offset 0
+	for field, dst := range map[string]*uint64{
+		"heapLive":          &ms.HeapLive,
+		"heapMarked":        &ms.HeapMarked,
+		"gcPercentHeapGoal": &ms.HeapGoal,
+		"heapInUse":         &ms.HeapInuse,
+		"heapFree":          &ms.HeapFree,
+		"heapReleased":      &ms.HeapReleased,
+		"totalAlloc":        &ms.TotalAlloc,
+		"totalFree":         &ms.TotalFree,
+	} {
+		offset, err := dwarfLoader.GetStructOffset("runtime.gcControllerState", field)
+		if err != nil {
+			continue
+		}
+		if val, err := r.readUint64(base + offset); err == nil {
+			*dst = val
+		}
+	}
+}
@@ -0,0 +1,178 @@
+package proc
+
+import (
+	"fmt"
+	"log"
+	"sync"
+
+	bin "github.com/monsterxx03/gospy/pkg/binary"
+)
+
+// maxModules bounds the runtime.moduledata walk in case the list is corrupt
+const maxModules = 256
+
+// LoadedModule is a Go module mapped in the target: the executable, a shared
+// library of a -linkshared build or a plugin
+type LoadedModule struct {
+	Path  string `json:"path"`   // file in the target's mount namespace
+	MinPC uint64 `json:"min_pc"` // [MinPC, MaxPC) covers the module's text
+	MaxPC uint64 `json:"max_pc"`
+	Bias  uint64 `json:"bias"` // runtime address minus link-time address
+
+	loader bin.BinaryLoader // nil if the file couldn't be loaded
+}
+
+// moduleMapper is implemented by readers that know which file backs an address
+type moduleMapper interface {
+	// mappedFile returns the target's path of the file mapped at addr, and a
+	// path gospy can open it with
+	mappedFile(addr uint64) (path, openPath string, err error)
+}
+
+// moduleTable caches the modules found by walking runtime.firstmoduledata
+type moduleTable struct {
+	mu      sync.RWMutex
+	modules []LoadedModule              // modules[0] is the executable
+	loaders map[string]bin.BinaryLoader // by openPath, nil when loading failed
+}
+
+// closeModules closes the files of the shared modules loaded so far
+func (r *commonMemReader) closeModules() {
+	r.modules.mu.Lock()
+	defer r.modules.mu.Unlock()
+	for _, loader := range r.modules.loaders {
+		if loader != nil {
+			loader.Close()
+		}
+	}
+	r.modules.loaders = nil
+}
+
+// Modules returns the Go modules loaded in the target. Without DWARF for
+// runtime.moduledata only the executable is known.
+func (r *commonMemReader) Modules() ([]LoadedModule, error) {
+	if err := r.refreshModules(); err != nil {
+		return []LoadedModule{r.mainModule()}, err
+	}
+	r.modules.mu.RLock()
+	defer r.modules.mu.RUnlock()
+	return append([]LoadedModule(nil), r.modules.modules...), nil
+}
+
+func (r *commonMemReader) mainModule() LoadedModule {
+	return LoadedModule{
+		Path:   r.GetBinaryLoader().Path(),
+		Bias:   r.GetStaticBase(),
+		loader: r.GetBinaryLoader(),
+	}
+}
+
+// refreshModules re-walks runtime.firstmoduledata.next, plugins may have been
+// opened since the last walk
+func (r *commonMemReader) refreshModules() error {
+	loader := r.GetBinaryLoader()
+	dwarfLoader, err := loader.GetDWARFLoader()
+	if err != nil {
+		return fmt.Errorf("failed to get DWARF loader: %w", err)
+	}
+	firstAddr, err := loader.FindVariableAddress("runtime.firstmoduledata")
+	if err != nil {
+		return fmt.Errorf("find firstmoduledata symbol: %w", err)
+	}
+	offsets := make(map[string]uint64)
+	for _, field := range []string{"minpc", "maxpc", "text", "modulename", "next"} {
+		off, err := dwarfLoader.GetStructOffset("runtime.moduledata", field)
+		if err != nil {
+			return fmt.Errorf("failed to get moduledata.%s offset: %w", field, err)
+		}
+		offsets[field] = off
+	}
+
+	var modules []LoadedModule
+	addr := r.GetStaticBase() + firstAddr
+	for i := 0; addr != 0 && i < maxModules; i++ {
+		m := r.mainModule()
+		if m.MinPC, err = r.readPtr(addr + offsets["minpc"]); err != nil {
+			return fmt.Errorf("read moduledata at 0x%x: %w", addr, err)
+		}
+		if m.MaxPC, err = r.readPtr(addr + offsets["maxpc"]); err != nil {
+			return fmt.Errorf("read moduledata at 0x%x: %w", addr, err)
+		}
+		if i > 0 {
+			text, err := r.readPtr(addr + offsets["text"])
+			if err != nil {
+				return fmt.Errorf("read moduledata at 0x%x: %w", addr, err)
+			}
+			name, _ := r.readString(addr + offsets["modulename"])
+			m = r.loadModule(m.MinPC, m.MaxPC, text, name)
+		}
+		modules = append(modules, m)
+
+		if addr, err = r.readPtr(addr + offsets["next"]); err != nil {
+			return fmt.Errorf("read moduledata at 0x%x: %w", addr, err)
+		}
+	}
+
+	r.modules.mu.Lock()
+	r.modules.modules = modules
+	r.modules.mu.Unlock()
+	return nil
+}
+
+// loadModule finds the file backing a shared module and loads its symbols,
+// files are loaded once per reader
+func (r *commonMemReader) loadModule(minPC, maxPC, text uint64, name string) LoadedModule {
+	m := LoadedModule{Path: name, MinPC: minPC, MaxPC: maxPC}
+	mapper, ok := r.reader.(moduleMapper)
+	if !ok {
+		return m
+	}
+	path, openPath, err := mapper.mappedFile(text)
+	if err != nil {
+		return m
+	}
+	m.Path = path
+
+	r.modules.mu.Lock()
+	defer r.modules.mu.Unlock()
+	loader, seen := r.modules.loaders[openPath]
+	if !seen {
+		loader = bin.NewBinaryLoader()
+		if err := loader.Load(openPath); err != nil {
+			log.Printf("WARNING: failed to load module %s, its frames won't be symbolized: %v", path, err)
+			loader = nil
+		}
+		if r.modules.loaders == nil {
+			r.modules.loaders = make(map[string]bin.BinaryLoader)
+		}
+		r.modules.loaders[openPath] = loader
+	}
+	if loader == nil {
+		return m
+	}
+	// every module has its own runtime.text, moduledata.text is where it was mapped
+	linkText, err := loader.FindVariableAddress("runtime.text")
+	if err != nil {
+		return m
+	}
+	m.Bias = text - linkText
+	m.loader = loader
+	return m
+}
+
+// pcToFuncLoc symbolizes a PC with the pclntab of the module containing it,
+// PCs outside all known modules are looked up in the executable
+func (r *commonMemReader) pcToFuncLoc(pc uint64) *bin.FuncLoc {
+	r.modules.mu.RLock()
+	for _, m := range r.modules.modules[min(1, len(r.modules.modules)):] {
+		if pc >= m.MinPC && pc < m.MaxPC {
+			r.modules.mu.RUnlock()
+			if m.loader == nil {
+				return nil
+			}
+			return m.loader.PCToFuncLoc(pc - m.Bias)
+		}
+	}
+	r.modules.mu.RUnlock()
+	return r.GetBinaryLoader().PCToFuncLoc(pc - r.GetStaticBase())
+}
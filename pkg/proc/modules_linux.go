@@ -0,0 +1,72 @@
+//go:build linux
+
+package proc
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// mapsFile is a file backed range of /proc/<pid>/maps
+type mapsFile struct {
+	lo, hi uint64
+	path   string
+}
+
+// parseMaps returns the file backed ranges of a /proc/<pid>/maps listing
+func parseMaps(rd io.Reader) ([]mapsFile, error) {
+	var files []mapsFile
+	scanner := bufio.NewScanner(rd)
+	for scanner.Scan() {
+		// start-end perms offset dev inode path
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 6 || !strings.HasPrefix(fields[5], "/") {
+			continue
+		}
+		start, end, ok := strings.Cut(fields[0], "-")
+		if !ok {
+			continue
+		}
+		lo, err1 := strconv.ParseUint(start, 16, 64)
+		hi, err2 := strconv.ParseUint(end, 16, 64)
+		if err1 != nil || err2 != nil {
+			continue
+		}
+		files = append(files, mapsFile{lo: lo, hi: hi, path: strings.Join(fields[5:], " ")})
+	}
+	return files, scanner.Err()
+}
+
+// fileMappedAt returns the path of the file mapped at addr
+func fileMappedAt(files []mapsFile, addr uint64) (string, error) {
+	for _, f := range files {
+		if addr >= f.lo && addr < f.hi {
+			return f.path, nil
+		}
+	}
+	return "", fmt.Errorf("no file mapped at 0x%x", addr)
+}
+
+// mappedFile implements moduleMapper with /proc/<pid>/maps. The file is
+// opened through /proc/<pid>/root so modules inside containers resolve too.
+func (r *linuxMemReader) mappedFile(addr uint64) (string, string, error) {
+	f, err := os.Open(fmt.Sprintf("/proc/%d/maps", r.pid))
+	if err != nil {
+		return "", "", err
+	}
+	defer f.Close()
+
+	files, err := parseMaps(f)
+	if err != nil {
+		return "", "", err
+	}
+	path, err := fileMappedAt(files, addr)
+	if err != nil {
+		return "", "", err
+	}
+	return path, fmt.Sprintf("/proc/%d/root%s", r.pid, path), nil
+}
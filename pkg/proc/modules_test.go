@@ -0,0 +1,69 @@
+package proc
+
+import (
+	"debug/gosym"
+	"testing"
+
+	bin "github.com/monsterxx03/gospy/pkg/binary"
+)
+
+// stubLoader resolves every PC to its own name, recording the PC it was asked for
+type stubLoader struct {
+	bin.BinaryLoader
+	name string
+	pc   uint64
+}
+
+func (l *stubLoader) PCToFuncLoc(pc uint64) *bin.FuncLoc {
+	l.pc = pc
+	return &bin.FuncLoc{PC: pc, Func: &gosym.Func{Sym: &gosym.Sym{Name: l.name}}}
+}
+
+type stubModuleReader struct {
+	commonMemReader
+	exe *stubLoader
+}
+
+func (r *stubModuleReader) GetBinaryLoader() bin.BinaryLoader { return r.exe }
+func (r *stubModuleReader) GetStaticBase() uint64             { return 0x1000 }
+
+func TestPCToFuncLoc(t *testing.T) {
+	exe := &stubLoader{name: "exe"}
+	plugin := &stubLoader{name: "plugin"}
+	r := &stubModuleReader{exe: exe}
+	r.commonMemReader = commonMemReader{reader: r}
+	r.modules.modules = []LoadedModule{
+		{MinPC: 0x401000, MaxPC: 0x500000, Bias: 0x1000, loader: exe},
+		{MinPC: 0x7f0000100000, MaxPC: 0x7f0000200000, Bias: 0x7f0000000000, loader: plugin},
+		{MinPC: 0x7f0000300000, MaxPC: 0x7f0000400000}, // file not found
+	}
+
+	tests := []struct {
+		pc     uint64
+		loader *stubLoader
+		want   string
+		linkPC uint64
+	}{
+		{0x402000, exe, "exe", 0x401000},
+		{0x7f0000100010, plugin, "plugin", 0x100010},
+		{0x7f0000300010, nil, "", 0},
+		// unknown PCs fall back to the executable, as before modules were walked
+		{0x600000, exe, "exe", 0x5ff000},
+	}
+	for _, tt := range tests {
+		loc := r.pcToFuncLoc(tt.pc)
+		if tt.loader == nil {
+			if loc != nil {
+				t.Errorf("pc 0x%x: got %s, want unresolved", tt.pc, loc.Func.Name)
+			}
+			continue
+		}
+		if loc == nil || loc.Func.Name != tt.want {
+			t.Errorf("pc 0x%x: got %v, want %s", tt.pc, loc, tt.want)
+			continue
+		}
+		if tt.loader.pc != tt.linkPC {
+			t.Errorf("pc 0x%x: looked up 0x%x, want 0x%x", tt.pc, tt.loader.pc, tt.linkPC)
+		}
+	}
+}
@@ -1,11 +1,16 @@
 package proc
 
 import (
-	"encoding/binary"
 	"fmt"
 )
 
 func (r *commonMemReader) Ps() ([]P, error) {
+	r.cache.refresh()
+	return r.ps()
+}
+
+// ps is Ps within the current page cache generation
+func (r *commonMemReader) ps() ([]P, error) {
 	// Get the address of runtime.allp symbol
 	allpAddr, err := r.GetBinaryLoader().FindVariableAddress("runtime.allp")
 	if err != nil {
@@ -62,14 +67,14 @@ func (r *commonMemReader) parsePFromBatch(data []byte, pAddr uint64) (P, error)
 	if err != nil {
 		return p, fmt.Errorf("failed to get id offset: %w", err)
 	}
-	p.ID = int32(binary.LittleEndian.Uint32(data[idOffset:]))
+	p.ID = int32(r.byteOrder().Uint32(data[idOffset:]))
 
 	// Parse status
 	statusOffset, err := dwarfLoader.GetStructOffset("runtime.p", "status")
 	if err != nil {
 		return p, fmt.Errorf("failed to get status offset: %w", err)
 	}
-	status := binary.LittleEndian.Uint32(data[statusOffset:])
+	status := r.byteOrder().Uint32(data[statusOffset:])
 	p.Status = parsePStatus(status)
 
 	// Parse mcache
@@ -77,14 +82,14 @@ func (r *commonMemReader) parsePFromBatch(data []byte, pAddr uint64) (P, error)
 	if err != nil {
 		return p, fmt.Errorf("failed to get mcache offset: %w", err)
 	}
-	p.MCache = binary.LittleEndian.Uint64(data[mcacheOffset:])
+	p.MCache = r.ptrAt(data, mcacheOffset)
 
 	// Parse schedtick
 	schedtickOffset, err := dwarfLoader.GetStructOffset("runtime.p", "schedtick")
 	if err != nil {
 		return p, fmt.Errorf("failed to get schedtick offset: %w", err)
 	}
-	p.SchedTick = binary.LittleEndian.Uint32(data[schedtickOffset:])
+	p.SchedTick = r.byteOrder().Uint32(data[schedtickOffset:])
 
 	return p, nil
 }
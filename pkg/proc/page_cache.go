@@ -0,0 +1,172 @@
+package proc
+
+import (
+	"sync"
+)
+
+const (
+	cachePageSize = 4096
+
+	// maxCachedRead bypasses the cache for reads spanning more pages than this
+	maxCachedRead = 4 * cachePageSize
+
+	// maxCachedPages bounds the cache (64MB), it's cleared when full
+	maxCachedPages = 16384
+)
+
+// ReadStats counts reads issued through a reader's page cache
+type ReadStats struct {
+	Generation uint64 `json:"generation"` // refreshes since the reader was created
+	Reads      uint64 `json:"reads"`      // ReadAt calls from the decoders
+	Hits       uint64 `json:"hits"`       // reads served entirely from cached pages
+	Misses     uint64 `json:"misses"`     // reads that went to the target
+	BytesRead  uint64 `json:"bytes_read"` // bytes read from the target
+}
+
+// HitRate returns the fraction of reads served from the cache
+func (s ReadStats) HitRate() float64 {
+	if s.Reads == 0 {
+		return 0
+	}
+	return float64(s.Hits) / float64(s.Reads)
+}
+
+// pageCache coalesces the many small reads made while decoding one view of the
+// target into page sized reads. Pages are only valid for one generation, a new
+// one starts with every top level call unless Frozen pins it. The exported
+// reader methods refresh once and then call unexported counterparts that
+// don't, internal code only uses those so a view is never split.
+type pageCache struct {
+	mu     sync.Mutex
+	pages  map[uint64][]byte // page address -> contents
+	pinned int
+	stats  ReadStats
+}
+
+func newPageCache() *pageCache {
+	return &pageCache{pages: make(map[uint64][]byte)}
+}
+
+// refresh starts a new generation unless one is pinned
+func (c *pageCache) refresh() {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.pinned == 0 {
+		c.invalidateLocked()
+	}
+}
+
+// newGeneration starts a new generation even if one is pinned
+func (c *pageCache) newGeneration() {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.invalidateLocked()
+}
+
+// pin starts a new generation that lasts until the matching unpin
+func (c *pageCache) pin() {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.pinned == 0 {
+		c.invalidateLocked()
+	}
+	c.pinned++
+}
+
+func (c *pageCache) unpin() {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.pinned--
+}
+
+func (c *pageCache) invalidateLocked() {
+	clear(c.pages)
+	c.stats.Generation++
+}
+
+// countDirect records bytes read from the target bypassing the cache
+func (c *pageCache) countDirect(n int) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.stats.BytesRead += uint64(n)
+}
+
+func (c *pageCache) snapshotStats() ReadStats {
+	if c == nil {
+		return ReadStats{}
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.stats
+}
+
+// readAt serves p from cached pages, filling missing pages from src. If a
+// page can't be read as a whole (e.g. partially captured), p is read directly.
+func (c *pageCache) readAt(src reader, p []byte, off int64) (int, error) {
+	addr := uint64(off)
+	first := addr &^ (cachePageSize - 1)
+	last := (addr + uint64(len(p)) - 1) &^ (cachePageSize - 1)
+	if len(p) == 0 || last-first >= maxCachedRead {
+		return c.readDirect(src, p, off)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.stats.Reads++
+	hit := true
+	n := 0
+	for page := first; page <= last; page += cachePageSize {
+		data, ok := c.pages[page]
+		if !ok {
+			hit = false
+			data = make([]byte, cachePageSize)
+			if _, err := src.ReadAt(data, int64(page)); err != nil {
+				c.stats.Misses++
+				read, err := src.ReadAt(p, off)
+				c.stats.BytesRead += uint64(read)
+				return read, err
+			}
+			c.stats.BytesRead += cachePageSize
+			if len(c.pages) >= maxCachedPages {
+				clear(c.pages)
+			}
+			c.pages[page] = data
+		}
+		start := uint64(0)
+		if page < addr {
+			start = addr - page
+		}
+		n += copy(p[n:], data[start:])
+	}
+	if hit {
+		c.stats.Hits++
+	} else {
+		c.stats.Misses++
+	}
+	return n, nil
+}
+
+func (c *pageCache) readDirect(src reader, p []byte, off int64) (int, error) {
+	n, err := src.ReadAt(p, off)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.stats.Reads++
+	c.stats.Misses++
+	c.stats.BytesRead += uint64(n)
+	return n, err
+}
@@ -0,0 +1,101 @@
+package proc
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	bin "github.com/monsterxx03/gospy/pkg/binary"
+)
+
+// fakeMemory serves reads from a byte slice mapped at base and counts them
+type fakeMemory struct {
+	commonMemReader
+	base  uint64
+	data  []byte
+	reads int
+}
+
+func (m *fakeMemory) ReadAt(p []byte, off int64) (int, error) {
+	m.reads++
+	addr := uint64(off)
+	if addr < m.base || addr+uint64(len(p)) > m.base+uint64(len(m.data)) {
+		return 0, errors.New("unmapped")
+	}
+	return copy(p, m.data[addr-m.base:]), nil
+}
+
+func (m *fakeMemory) GetBinaryLoader() bin.BinaryLoader { return nil }
+func (m *fakeMemory) GetStaticBase() uint64             { return 0 }
+
+func newFakeMemory(base uint64, size int) *fakeMemory {
+	m := &fakeMemory{base: base, data: make([]byte, size)}
+	for i := range m.data {
+		m.data[i] = byte(i * 7)
+	}
+	m.commonMemReader = commonMemReader{reader: m, cache: newPageCache()}
+	return m
+}
+
+func TestPageCache(t *testing.T) {
+	m := newFakeMemory(0x10000, 3*cachePageSize)
+	cr := &m.commonMemReader
+
+	// a read straddling two pages fills both, later reads in them are hits
+	got := make([]byte, 16)
+	if _, err := cr.ReadAt(got, 0x10000+cachePageSize-8); err != nil {
+		t.Fatal(err)
+	}
+	if want := m.data[cachePageSize-8 : cachePageSize+8]; !bytes.Equal(got, want) {
+		t.Fatalf("got %x, want %x", got, want)
+	}
+	for i := 0; i < 100; i++ {
+		if _, err := cr.readUint64(0x10000 + uint64(i*8)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if m.reads != 2 {
+		t.Errorf("target read %d times, want 2", m.reads)
+	}
+	stats := cr.CacheStats()
+	if stats.Reads != 101 || stats.Hits != 100 || stats.BytesRead != 2*cachePageSize {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+
+	// a new generation re-reads the target
+	m.data[0] = 0xff
+	cr.cache.refresh()
+	if v, _ := cr.readUint8(0x10000); v != 0xff {
+		t.Errorf("stale read after refresh: %x", v)
+	}
+
+	// pinned generations survive refresh
+	cr.cache.pin()
+	cr.readUint8(0x10000)
+	m.data[0] = 0xee
+	cr.cache.refresh()
+	if v, _ := cr.readUint8(0x10000); v != 0xff {
+		t.Errorf("pinned page refreshed: %x", v)
+	}
+	// unless a new view is asked for, as CheckConsistency does
+	cr.newView()
+	if v, _ := cr.readUint8(0x10000); v != 0xee {
+		t.Errorf("stale read after newView: %x", v)
+	}
+	cr.cache.unpin()
+}
+
+func TestPageCachePartialPage(t *testing.T) {
+	// memory not covering whole pages, as in snapshots, is read directly
+	m := newFakeMemory(0x10010, 32)
+	got := make([]byte, 8)
+	if _, err := m.commonMemReader.ReadAt(got, 0x10018); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, m.data[8:16]) {
+		t.Fatalf("got %x, want %x", got, m.data[8:16])
+	}
+	if _, err := m.commonMemReader.ReadAt(got, 0x20000); err == nil {
+		t.Fatal("expected error for unmapped address")
+	}
+}
@@ -1,7 +1,73 @@
 package proc
 
+import (
+	"crypto/tls"
+	"errors"
+	"time"
+)
+
+// ErrBinaryMismatch is returned when the binary given by path doesn't match the target process
+var ErrBinaryMismatch = errors.New("binary does not match target process")
+
+// ErrFreezeBudgetExceeded is returned by Frozen when the process was resumed
+// before fn finished because the freeze budget ran out
+var ErrFreezeBudgetExceeded = errors.New("freeze budget exceeded, process resumed early")
+
+type options struct {
+	allowMismatch bool
+	freezeBudget  time.Duration
+}
+
+// Option customizes how NewProcessMemReader attaches to a process
+type Option func(*options)
+
+// WithAllowBinaryMismatch downgrades a binary/process mismatch to a logged warning
+func WithAllowBinaryMismatch() Option {
+	return func(o *options) {
+		o.allowMismatch = true
+	}
+}
+
+// WithFreeze makes Frozen stop all threads of the target while it runs, so
+// reads see a consistent point in time. The process is resumed after budget
+// even if the reads are still in progress. Only supported on Linux.
+func WithFreeze(budget time.Duration) Option {
+	return func(o *options) {
+		o.freezeBudget = budget
+	}
+}
+
 // NewProcessMemReader creates a new memory reader for the specified process.
 // On Linux it uses /proc/<pid>/mem, on Darwin it uses mach_vm_read.
-func NewProcessMemReader(pid int, binPath string) (ProcessMemReader, error) {
-	return newProcessMemReader(pid, binPath)
+func NewProcessMemReader(pid int, binPath string, opts ...Option) (ProcessMemReader, error) {
+	o := &options{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return newProcessMemReader(pid, binPath, o)
+}
+
+// NewCoreMemReader creates a memory reader backed by an ELF core file (gcore or
+// GOTRACEBACK=crash). binPath is the matching executable, if empty the path
+// recorded in the core's NT_FILE note is used. Either way its build ID must
+// match the one dumped in the core, see WithAllowBinaryMismatch. Only
+// supported on Linux.
+func NewCoreMemReader(corePath, binPath string, opts ...Option) (ProcessMemReader, error) {
+	o := &options{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return newCoreMemReader(corePath, binPath, o)
+}
+
+// NewRemoteMemReader reads pid on another host through the gospy agent at
+// addr, unix:/path/to/socket or host:port. TCP requires tlsConfig, normally
+// with a client certificate. The executable is downloaded from the agent
+// unless binPath is given. Only supported on Linux.
+func NewRemoteMemReader(addr string, tlsConfig *tls.Config, pid int, binPath string, opts ...Option) (ProcessMemReader, error) {
+	o := &options{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return newRemoteMemReader(addr, tlsConfig, pid, binPath, o)
 }
@@ -0,0 +1,11 @@
+//go:build linux && amd64
+
+package proc
+
+import "golang.org/x/sys/unix"
+
+const regsSupported = true
+
+func regsPCSPFP(regs *unix.PtraceRegs) (pc, sp, fp uint64) {
+	return regs.Rip, regs.Rsp, regs.Rbp
+}
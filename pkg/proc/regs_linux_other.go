@@ -0,0 +1,13 @@
+//go:build linux && !amd64 && !arm64
+
+package proc
+
+import "golang.org/x/sys/unix"
+
+// unwinding from registers needs frame pointers, which Go only maintains on
+// amd64 and arm64, CheckThreadUnwinding rejects other targets
+const regsSupported = false
+
+func regsPCSPFP(regs *unix.PtraceRegs) (pc, sp, fp uint64) {
+	return 0, 0, 0
+}
@@ -0,0 +1,232 @@
+//go:build linux
+
+package proc
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/tls"
+	"debug/elf"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	bin "github.com/monsterxx03/gospy/pkg/binary"
+)
+
+// remoteMemReader reads a process through a gospy agent. The page cache and
+// readBatch keep the number of round trips per refresh low.
+type remoteMemReader struct {
+	commonMemReader
+	agent      *agentClient
+	target     *AgentTarget
+	opened     time.Time // when the agent reported target.Nanotime
+	bin        bin.BinaryLoader
+	staticBase uint64
+
+	mu       sync.Mutex
+	files    map[string]string // target path -> local copy, for modules
+	tmpFiles []string          // removed on Close
+}
+
+func newRemoteMemReader(addr string, tlsConfig *tls.Config, pid int, binPath string, opts *options) (ProcessMemReader, error) {
+	if opts.freezeBudget > 0 {
+		return nil, errors.New("freezing is not supported through an agent")
+	}
+	agent, err := dialAgent(addr, tlsConfig)
+	if err != nil {
+		return nil, err
+	}
+	r := &remoteMemReader{agent: agent, files: make(map[string]string)}
+	if r.target, err = agent.open(pid); err != nil {
+		agent.Close()
+		return nil, err
+	}
+	r.opened = time.Now()
+
+	if binPath == "" {
+		if binPath, err = r.fetchExecutable(); err != nil {
+			r.Close()
+			return nil, err
+		}
+	}
+	r.bin = bin.NewBinaryLoader()
+	if err := r.bin.Load(binPath); err != nil {
+		r.Close()
+		return nil, fmt.Errorf("failed to load binary: %w", err)
+	}
+	if gnu, goid := binaryIdentity(r.bin); (r.target.GNUBuildID != "" && gnu != "" && gnu != r.target.GNUBuildID) ||
+		(r.target.GoBuildID != "" && goid != "" && goid != r.target.GoBuildID) {
+		err := fmt.Errorf("%w: %s doesn't match the build ID of pid %d", ErrBinaryMismatch, binPath, pid)
+		if !opts.allowMismatch {
+			r.Close()
+			return nil, err
+		}
+		log.Printf("WARNING: %v, results will likely be wrong", err)
+	}
+
+	entryPoint := parseAuxvEntry(r.target.Auxv, r.bin.PtrSize(), r.bin.ByteOrder())
+	if entryPoint == 0 {
+		r.Close()
+		return nil, errors.New("failed to calculate static base: no entry point in auxv")
+	}
+	r.staticBase = entryPoint - r.bin.GetFile().(*elf.File).Entry
+	r.commonMemReader = commonMemReader{reader: r, pid: pid, cache: newPageCache()}
+	return r, nil
+}
+
+// fetchExecutable downloads the target's executable. Copies identified by a
+// build ID are kept in the user cache directory, the next run skips the download.
+func (r *remoteMemReader) fetchExecutable() (string, error) {
+	name := filepath.Base(r.target.Exe)
+	if r.target.GNUBuildID == "" && r.target.GoBuildID == "" {
+		return r.fetchTemp("", name)
+	}
+	id := sha256.Sum256([]byte(r.target.GNUBuildID + "/" + r.target.GoBuildID))
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return r.fetchTemp("", name)
+	}
+	dir = filepath.Join(dir, "gospy", "binaries")
+	cached := filepath.Join(dir, fmt.Sprintf("%s-%s", name, hex.EncodeToString(id[:8])))
+	if st, err := os.Stat(cached); err == nil && st.Size() == r.target.ExeSize {
+		return cached, nil
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return r.fetchTemp("", name)
+	}
+	tmp, err := os.CreateTemp(dir, name+".part-*")
+	if err != nil {
+		return r.fetchTemp("", name)
+	}
+	err = r.agent.readFile(r.target.PID, "", tmp)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), cached)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return "", fmt.Errorf("failed to download executable: %w", err)
+	}
+	return cached, nil
+}
+
+// fetchTemp downloads a file mapped by the target to a temporary file
+func (r *remoteMemReader) fetchTemp(path, name string) (string, error) {
+	tmp, err := os.CreateTemp("", "gospy-remote-*-"+name)
+	if err != nil {
+		return "", err
+	}
+	r.mu.Lock()
+	r.tmpFiles = append(r.tmpFiles, tmp.Name())
+	r.mu.Unlock()
+	err = r.agent.readFile(r.target.PID, path, tmp)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to download %s: %w", name, err)
+	}
+	return tmp.Name(), nil
+}
+
+func (r *remoteMemReader) ReadAt(p []byte, off int64) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	counts, err := r.agent.readBatch(r.target.PID, []uint64{uint64(off)}, [][]byte{p})
+	if err != nil {
+		return 0, err
+	}
+	if counts[0] < len(p) {
+		return counts[0], fmt.Errorf("read at 0x%x: short read of %d bytes", uint64(off)+uint64(counts[0]), len(p)-counts[0])
+	}
+	return counts[0], nil
+}
+
+// readBatch implements batchReader, one round trip for up to maxAgentRead bytes
+func (r *remoteMemReader) readBatch(addrs []uint64, bufs [][]byte) error {
+	counts, err := r.agent.readBatch(r.target.PID, addrs, bufs)
+	if err != nil {
+		return err
+	}
+	for i, n := range counts {
+		if n < len(bufs[i]) {
+			return fmt.Errorf("read at 0x%x: short read of %d bytes", addrs[i], n)
+		}
+	}
+	return nil
+}
+
+// mappedFile implements moduleMapper with the target's maps, the file is
+// downloaded once per reader
+func (r *remoteMemReader) mappedFile(addr uint64) (string, string, error) {
+	maps, err := r.agent.maps(r.target.PID)
+	if err != nil {
+		return "", "", err
+	}
+	files, err := parseMaps(bytes.NewReader(maps))
+	if err != nil {
+		return "", "", err
+	}
+	path, err := fileMappedAt(files, addr)
+	if err != nil {
+		return "", "", err
+	}
+	r.mu.Lock()
+	local, ok := r.files[path]
+	r.mu.Unlock()
+	if !ok {
+		if local, err = r.fetchTemp(path, filepath.Base(path)); err != nil {
+			return "", "", err
+		}
+		r.mu.Lock()
+		r.files[path] = local
+		r.mu.Unlock()
+	}
+	return path, local, nil
+}
+
+// Target returns what the agent reported about the process
+func (r *remoteMemReader) Target() AgentTarget {
+	return *r.target
+}
+
+func (r *remoteMemReader) Close() error {
+	err := r.agent.Close()
+	if r.bin != nil {
+		r.closeModules()
+		r.bin.Close()
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, f := range r.tmpFiles {
+		os.Remove(f)
+	}
+	r.tmpFiles = nil
+	return err
+}
+
+func (r *remoteMemReader) GetBinaryLoader() bin.BinaryLoader {
+	return r.bin
+}
+
+func (r *remoteMemReader) GetStaticBase() uint64 {
+	return r.staticBase
+}
+
+// targetNanotime advances the agent's clock at open by our own monotonic
+// clock, both tick at the same rate. Older agents don't report their clock.
+func (r *remoteMemReader) targetNanotime() int64 {
+	if r.target.Nanotime == 0 {
+		return 0
+	}
+	return r.target.Nanotime + int64(time.Since(r.opened))
+}
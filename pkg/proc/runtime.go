@@ -8,26 +8,56 @@ import (
 
 // G represents a goroutine with detailed information
 type Runtime struct {
-	InitTime  int64  `json:"-"`          // when runtime was initialized(monotime)
-	GoVersion string `json:"go_version"` // Go runtime version
+	InitTime  int64      `json:"-"`                    // when runtime was initialized(monotime)
+	Nanotime  int64      `json:"-"`                    // target's monotime when read, 0 if unknown
+	GoVersion string     `json:"go_version"`           // Go runtime version
+	BuildInfo *BuildInfo `json:"build_info,omitempty"` // module and build settings, nil if unavailable
+
+	// Fields below are re-read on every RuntimeInfo call, the target may change them
+	Args            []string          `json:"args"`               // command line (runtime.argslice)
+	Env             []string          `json:"env"`                // environment as seen by the Go program
+	GOMAXPROCS      int32             `json:"gomaxprocs"`         // effective GOMAXPROCS
+	NumCPU          int32             `json:"ncpu"`               // CPUs detected at startup
+	GODEBUG         string            `json:"godebug"`            // GODEBUG environment last parsed by runtime
+	GODEBUGDefault  string            `json:"godebug_default"`    // defaults from go.mod and //go:debug directives
+	GODEBUGSettings map[string]string `json:"godebug_settings"`   // effective settings, GODEBUG overrides defaults
+	DebugVars       []DebugVar        `json:"debug_vars"`         // runtime debug variables (runtime.debug)
+	Warnings        []string          `json:"warnings,omitempty"` // settings that couldn't be read
 }
 
+// Uptime is how long the target had been running when it was read, 0 if the
+// reader doesn't know the target's clock
 func (r Runtime) Uptime() time.Duration {
-	return time.Duration(nanotime() - r.InitTime)
+	if r.InitTime == 0 || r.Nanotime < r.InitTime {
+		return 0
+	}
+	return time.Duration(r.Nanotime - r.InitTime)
 }
 
-type runtimeCache struct {
-	runtime *Runtime
+func (r *commonMemReader) RuntimeInfo() (*Runtime, error) {
+	r.cache.refresh()
+	return r.runtimeInfo()
 }
 
-var runtimeInfoCache = make(map[int]*runtimeCache) // pid -> runtime info
+// runtimeInfo is RuntimeInfo within the current page cache generation
+func (r *commonMemReader) runtimeInfo() (*Runtime, error) {
+	// copy the cached static info, then read what the process can change
+	rt := *r.staticRuntimeInfo()
+	rt.Nanotime = r.clock()
+	r.readProcessSettings(&rt)
+	return &rt, nil
+}
 
-func (r *commonMemReader) RuntimeInfo() (*Runtime, error) {
-	// Check cache first
-	if cached, ok := runtimeInfoCache[r.pid]; ok {
-		return cached.runtime, nil
-	}
+// staticRuntimeInfo returns the cached part of RuntimeInfo, reading it on first use
+func (r *commonMemReader) staticRuntimeInfo() *Runtime {
+	r.staticOnce.Do(func() {
+		r.static = r.readStaticRuntimeInfo()
+	})
+	return r.static
+}
 
+// readStaticRuntimeInfo reads info that doesn't change during the process lifetime
+func (r *commonMemReader) readStaticRuntimeInfo() *Runtime {
 	rt := &Runtime{}
 
 	// Parse Go version
@@ -49,9 +79,12 @@ func (r *commonMemReader) RuntimeInfo() (*Runtime, error) {
 		}
 	}
 
-	// Cache the result
-	runtimeInfoCache[r.pid] = &runtimeCache{runtime: rt}
-	return rt, nil
+	// Parse build info (main module, deps, build settings)
+	if bi, err := r.readBuildInfo(rt.GoVersion); err == nil {
+		rt.BuildInfo = bi
+	}
+
+	return rt
 }
 
 //go:noescape
@@ -0,0 +1,214 @@
+package proc
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	bin "github.com/monsterxx03/gospy/pkg/binary"
+)
+
+// the runtime has a few dozen, more means the slice header was misread
+const maxDebugVars = 1024
+
+// DebugVar is one runtime debug variable (runtime.dbgvars), as set through GODEBUG
+type DebugVar struct {
+	Name  string `json:"name"`
+	Value int32  `json:"value"`
+}
+
+// readProcessSettings fills the fields of rt that the target may change while
+// running. Older runtimes lack some of the symbols, those fields stay empty.
+// Other failures leave the field empty too and are added to rt.Warnings.
+func (r *commonMemReader) readProcessSettings(rt *Runtime) {
+	record := func(what string, err error) {
+		if err != nil && !errors.Is(err, bin.ErrSymbolNotFound) {
+			rt.Warnings = append(rt.Warnings, fmt.Sprintf("failed to read %s: %v", what, err))
+		}
+	}
+
+	var err error
+	rt.Args, err = r.readStringSliceVar("runtime.argslice")
+	record("args", err)
+
+	// syscall.envs reflects os.Setenv/Unsetenv, runtime.envs is only the initial copy
+	if rt.Env, err = r.readStringSliceVar("syscall.envs"); err != nil || rt.Env == nil {
+		rt.Env, err = r.readStringSliceVar("runtime.envs")
+		record("env", err)
+	}
+	rt.Env = compactEnv(rt.Env)
+
+	rt.GOMAXPROCS, err = r.readInt32Var("runtime.gomaxprocs")
+	record("gomaxprocs", err)
+
+	// runtime.ncpu was renamed to runtime.numCPUStartup in go1.25
+	if rt.NumCPU, err = r.readInt32Var("runtime.numCPUStartup"); err != nil {
+		rt.NumCPU, err = r.readInt32Var("runtime.ncpu")
+		record("ncpu", err)
+	}
+
+	rt.GODEBUGDefault, err = r.readStringVar("runtime.godebugDefault")
+	record("godebugDefault", err)
+	rt.GODEBUG, err = r.readGodebugEnv()
+	record("godebugEnv", err)
+	rt.GODEBUGSettings = mergeGodebug(rt.GODEBUGDefault, rt.GODEBUG)
+
+	rt.DebugVars, err = r.readDebugVars()
+	record("dbgvars", err)
+}
+
+func (r *commonMemReader) readStringVar(name string) (string, error) {
+	addr, err := r.GetBinaryLoader().FindVariableAddress(name)
+	if err != nil {
+		return "", err
+	}
+	return r.readString(r.GetStaticBase() + addr)
+}
+
+func (r *commonMemReader) readInt32Var(name string) (int32, error) {
+	addr, err := r.GetBinaryLoader().FindVariableAddress(name)
+	if err != nil {
+		return 0, err
+	}
+	return r.readInt32(r.GetStaticBase() + addr)
+}
+
+func (r *commonMemReader) readStringSliceVar(name string) ([]string, error) {
+	addr, err := r.GetBinaryLoader().FindVariableAddress(name)
+	if err != nil {
+		return nil, err
+	}
+	return r.readStringSlice(r.GetStaticBase() + addr)
+}
+
+// readGodebugEnv reads runtime.godebugEnv, an atomic.Pointer[string] to the last parsed GODEBUG
+func (r *commonMemReader) readGodebugEnv() (string, error) {
+	addr, err := r.GetBinaryLoader().FindVariableAddress("runtime.godebugEnv")
+	if err != nil {
+		return "", err
+	}
+	ptr, err := r.readPtr(r.GetStaticBase() + addr)
+	if err != nil || ptr == 0 {
+		return "", err
+	}
+	return r.readString(ptr)
+}
+
+// readDebugVars reads the effective value of every runtime debug variable
+func (r *commonMemReader) readDebugVars() ([]DebugVar, error) {
+	addr, err := r.GetBinaryLoader().FindVariableAddress("runtime.dbgvars")
+	if err != nil {
+		return nil, err
+	}
+	dwarfLoader, err := r.GetBinaryLoader().GetDWARFLoader()
+	if err != nil {
+		return nil, err
+	}
+	typ, err := dwarfLoader.GetVariableType("runtime.dbgvars")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get dbgvars type: %w", err)
+	}
+
+	// []*dbgVar since go1.21, a slice of values before
+	var ptrs []uint64
+	switch typ {
+	case "[]*runtime.dbgVar":
+		if ptrs, err = r.readPtrSlice(r.GetStaticBase() + addr); err != nil {
+			return nil, err
+		}
+	case "[]runtime.dbgVar":
+		size, err := dwarfLoader.GetStructSize("runtime.dbgVar")
+		if err != nil {
+			return nil, fmt.Errorf("failed to get dbgVar size: %w", err)
+		}
+		data, length, err := r.readSliceHeader(r.GetStaticBase() + addr)
+		if err != nil {
+			return nil, err
+		}
+		if length > maxDebugVars {
+			return nil, fmt.Errorf("implausible number of debug vars: %d", length)
+		}
+		for i := uint64(0); i < length; i++ {
+			ptrs = append(ptrs, data+i*size)
+		}
+	default:
+		return nil, fmt.Errorf("unexpected dbgvars type %q", typ)
+	}
+	if len(ptrs) > maxDebugVars {
+		return nil, fmt.Errorf("implausible number of debug vars: %d", len(ptrs))
+	}
+
+	offsets := make(map[string]uint64)
+	for _, field := range []string{"name", "value"} {
+		offset, err := dwarfLoader.GetStructOffset("runtime.dbgVar", field)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get dbgVar.%s offset: %w", field, err)
+		}
+		offsets[field] = offset
+	}
+	// atomic is Go 1.21+
+	atomicOffset, atomicErr := dwarfLoader.GetStructOffset("runtime.dbgVar", "atomic")
+
+	vars := make([]DebugVar, 0, len(ptrs))
+	for _, ptr := range ptrs {
+		if ptr == 0 {
+			continue
+		}
+		name, err := r.readString(ptr + offsets["name"])
+		if err != nil {
+			return vars, err
+		}
+		v := DebugVar{Name: name}
+
+		// atomic vars can change at runtime, value vars are only set at startup
+		var valuePtr uint64
+		if atomicErr == nil {
+			valuePtr, _ = r.readPtr(ptr + atomicOffset)
+		}
+		if valuePtr == 0 {
+			valuePtr, _ = r.readPtr(ptr + offsets["value"])
+		}
+		if valuePtr != 0 {
+			if v.Value, err = r.readInt32(valuePtr); err != nil {
+				return vars, err
+			}
+		}
+		vars = append(vars, v)
+	}
+	return vars, nil
+}
+
+// RedactEnv replaces the environment values with <redacted>, they are often
+// secrets. The names are kept.
+func (r *Runtime) RedactEnv() {
+	for i, kv := range r.Env {
+		name, _, _ := strings.Cut(kv, "=")
+		r.Env[i] = name + "=<redacted>"
+	}
+}
+
+// compactEnv drops entries cleared by os.Unsetenv
+func compactEnv(env []string) []string {
+	out := env[:0]
+	for _, kv := range env {
+		if kv != "" {
+			out = append(out, kv)
+		}
+	}
+	return out
+}
+
+// mergeGodebug parses comma separated key=value settings, later sources win
+// like internal/godebug does with the default and the GODEBUG environment
+func mergeGodebug(sources ...string) map[string]string {
+	settings := make(map[string]string)
+	for _, src := range sources {
+		for _, kv := range strings.Split(src, ",") {
+			k, v, ok := strings.Cut(strings.TrimSpace(kv), "=")
+			if ok && k != "" {
+				settings[k] = v
+			}
+		}
+	}
+	return settings
+}
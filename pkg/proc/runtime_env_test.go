@@ -0,0 +1,185 @@
+package proc
+
+import (
+	"encoding/binary"
+	"fmt"
+	"strings"
+	"testing"
+
+	bin "github.com/monsterxx03/gospy/pkg/binary"
+)
+
+// stubDWARF serves dbgVar layouts and the type of runtime.dbgvars
+type stubDWARF struct {
+	bin.DWARFLoader
+	varType string
+	size    uint64
+	offsets map[string]uint64
+}
+
+func (d *stubDWARF) GetVariableType(string) (string, error) { return d.varType, nil }
+func (d *stubDWARF) GetStructSize(string) (uint64, error)   { return d.size, nil }
+func (d *stubDWARF) GetStructOffset(_, field string) (uint64, error) {
+	if off, ok := d.offsets[field]; ok {
+		return off, nil
+	}
+	return 0, fmt.Errorf("field %s not found", field)
+}
+
+// stubVarLoader places runtime variables at fixed addresses of a 64-bit little endian target
+type stubVarLoader struct {
+	bin.BinaryLoader
+	vars  map[string]uint64
+	dwarf *stubDWARF
+}
+
+func (l *stubVarLoader) PtrSize() int                { return 8 }
+func (l *stubVarLoader) ByteOrder() binary.ByteOrder { return binary.LittleEndian }
+func (l *stubVarLoader) GetDWARFLoader() (bin.DWARFLoader, error) {
+	return l.dwarf, nil
+}
+func (l *stubVarLoader) FindVariableAddress(name string) (uint64, error) {
+	if addr, ok := l.vars[name]; ok {
+		return addr, nil
+	}
+	return 0, bin.ErrSymbolNotFound
+}
+
+type stubVarMemory struct {
+	fakeMemory
+	loader *stubVarLoader
+}
+
+func (m *stubVarMemory) GetBinaryLoader() bin.BinaryLoader { return m.loader }
+
+func (m *stubVarMemory) put(addr, v uint64) {
+	binary.LittleEndian.PutUint64(m.data[addr-m.base:], v)
+}
+
+// putString writes a string header at addr pointing to s copied at data
+func (m *stubVarMemory) putString(addr, data uint64, s string) {
+	copy(m.data[data-m.base:], s)
+	m.put(addr, data)
+	m.put(addr+8, uint64(len(s)))
+}
+
+func newStubVarMemory(dwarf *stubDWARF) *stubVarMemory {
+	m := &stubVarMemory{loader: &stubVarLoader{vars: map[string]uint64{"runtime.dbgvars": 0x1000}, dwarf: dwarf}}
+	m.base, m.data = 0x1000, make([]byte, 4096)
+	m.commonMemReader = commonMemReader{reader: m}
+	return m
+}
+
+func TestReadDebugVars(t *testing.T) {
+	want := []DebugVar{{"gctrace", 1}, {"madvdontneed", 0}, {"asyncpreemptoff", 7}}
+
+	// go1.18-1.20: []dbgVar{name string; value *int32}
+	values := newStubVarMemory(&stubDWARF{varType: "[]runtime.dbgVar", size: 24, offsets: map[string]uint64{"name": 0, "value": 16}})
+	values.put(0x1000, 0x1100)
+	values.put(0x1008, uint64(len(want)))
+	for i, v := range want {
+		elem := 0x1100 + uint64(i)*24
+		values.putString(elem, 0x1400+uint64(i)*32, v.Name)
+		values.put(elem+16, 0x1600+uint64(i)*4)
+		binary.LittleEndian.PutUint32(values.data[0x600+i*4:], uint32(v.Value))
+	}
+
+	// go1.21+: []*dbgVar{name string; value *int32; atomic *atomic.Int32; def int32}
+	ptrs := newStubVarMemory(&stubDWARF{varType: "[]*runtime.dbgVar", size: 40, offsets: map[string]uint64{"name": 0, "value": 16, "atomic": 24}})
+	ptrs.put(0x1000, 0x1080)
+	ptrs.put(0x1008, uint64(len(want)))
+	ptrs.put(0x1010, uint64(len(want)))
+	for i, v := range want {
+		elem := 0x1100 + uint64(i)*40
+		ptrs.put(0x1080+uint64(i)*8, elem)
+		ptrs.putString(elem, 0x1400+uint64(i)*32, v.Name)
+		if i%2 == 0 {
+			ptrs.put(elem+24, 0x1600+uint64(i)*4) // atomic
+		} else {
+			ptrs.put(elem+16, 0x1600+uint64(i)*4)
+		}
+		binary.LittleEndian.PutUint32(ptrs.data[0x600+i*4:], uint32(v.Value))
+	}
+
+	huge := newStubVarMemory(&stubDWARF{varType: "[]runtime.dbgVar", size: 24, offsets: map[string]uint64{"name": 0, "value": 16}})
+	huge.put(0x1000, 0x1100)
+	huge.put(0x1008, 1<<40)
+
+	unknown := newStubVarMemory(&stubDWARF{varType: "map[string]runtime.dbgVar"})
+
+	tests := []struct {
+		name    string
+		m       *stubVarMemory
+		wantErr string
+	}{
+		{"value slice", values, ""},
+		{"pointer slice", ptrs, ""},
+		{"implausible length", huge, "implausible"},
+		{"unknown type", unknown, "unexpected dbgvars type"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.m.readDebugVars()
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("got %v, %v, want error %q", got, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if fmt.Sprint(got) != fmt.Sprint(want) {
+				t.Errorf("got %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestReadProcessSettingsWarnings(t *testing.T) {
+	m := newStubVarMemory(&stubDWARF{varType: "[]runtime.dbgVar", size: 24})
+	m.put(0x1000, 0x1100)
+	m.put(0x1008, 1<<40)
+	m.loader.vars["runtime.gomaxprocs"] = 0x1800
+	binary.LittleEndian.PutUint32(m.data[0x800:], 4)
+
+	rt := &Runtime{}
+	m.readProcessSettings(rt)
+	if rt.GOMAXPROCS != 4 {
+		t.Errorf("GOMAXPROCS = %d, want 4", rt.GOMAXPROCS)
+	}
+	if len(rt.Warnings) != 1 || !strings.Contains(rt.Warnings[0], "dbgvars") {
+		t.Errorf("warnings = %q, want one about dbgvars", rt.Warnings)
+	}
+}
+
+func TestReadStringBounds(t *testing.T) {
+	m := newStubVarMemory(&stubDWARF{})
+	m.putString(0x1000, 0x1400, "GODEBUG=gctrace=1")
+	m.put(0x1010, 0x1400)
+	m.put(0x1018, 1<<40) // torn string header
+	// []string{"a=1", torn}
+	m.putString(0x1100, 0x1500, "a=1")
+	m.put(0x1110, 0x1500)
+	m.put(0x1118, 1<<40)
+	for _, slice := range []struct{ addr, data, len uint64 }{{0x1200, 0x1100, 1}, {0x1220, 0x1100, 2}, {0x1240, 0x1100, 1 << 40}} {
+		m.put(slice.addr, slice.data)
+		m.put(slice.addr+8, slice.len)
+		m.put(slice.addr+16, slice.len)
+	}
+
+	if s, err := m.readString(0x1000); err != nil || s != "GODEBUG=gctrace=1" {
+		t.Errorf("readString = %q, %v", s, err)
+	}
+	if s, err := m.readString(0x1010); err == nil {
+		t.Errorf("readString of a torn header = %d bytes, want error", len(s))
+	}
+	if s, err := m.readStringSlice(0x1200); err != nil || len(s) != 1 || s[0] != "a=1" {
+		t.Errorf("readStringSlice = %q, %v", s, err)
+	}
+	for _, addr := range []uint64{0x1220, 0x1240} {
+		if s, err := m.readStringSlice(addr); err == nil {
+			t.Errorf("readStringSlice(0x%x) = %d strings, want error", addr, len(s))
+		}
+	}
+}
@@ -0,0 +1,167 @@
+package proc
+
+import (
+	"errors"
+	"fmt"
+	"runtime"
+
+	bin "github.com/monsterxx03/gospy/pkg/binary"
+)
+
+// maxThreads bounds the runtime.allm walk in case the list is corrupt
+const maxThreads = 10000
+
+// errRegsUnsupported is returned by readers that can't read thread registers
+var errRegsUnsupported = errors.New("reading thread registers is not supported")
+
+// ErrNoFramePointers is returned by CheckThreadUnwinding for targets built for
+// an architecture without frame pointers
+var ErrNoFramePointers = errors.New("unwinding threads from registers needs frame pointers, which Go only maintains on amd64 and arm64")
+
+// CheckThreadUnwinding returns an error unless SampleThreads of reader unwinds
+// on-CPU threads from their registers, which needs a local live target built
+// for amd64 or arm64. Otherwise samples only have curg.sched, the place the
+// goroutine was last scheduled, and a CPU profile of them would be misleading.
+func CheckThreadUnwinding(reader ProcessMemReader) error {
+	r, ok := reader.(interface{ GetBinaryLoader() bin.BinaryLoader })
+	if !ok {
+		return errRegsUnsupported
+	}
+	switch arch := r.GetBinaryLoader().Arch(); arch {
+	case "amd64", "arm64":
+		if arch != runtime.GOARCH {
+			return fmt.Errorf("%w: target is %s, gospy %s", errRegsUnsupported, arch, runtime.GOARCH)
+		}
+	default:
+		return fmt.Errorf("%w, target is %s", ErrNoFramePointers, arch)
+	}
+	if _, ok := reader.(threadInspector); !ok {
+		return fmt.Errorf("%w by %T", errRegsUnsupported, reader)
+	}
+	return nil
+}
+
+// ThreadSample is what one thread (M) of the target was doing at sample time
+type ThreadSample struct {
+	TID    int          `json:"tid"`  // OS thread ID (m.procid)
+	Goid   int64        `json:"goid"` // goroutine running on the thread (m.curg)
+	G      G            `json:"-"`
+	OnCPU  bool         `json:"on_cpu"` // the kernel reported the thread running
+	Exact  bool         `json:"exact"`  // stack unwound from live registers, not curg.sched
+	Frames []StackFrame `json:"frames"`
+}
+
+// threadInspector is implemented by readers that can look at live threads
+type threadInspector interface {
+	// threadOnCPU reports whether the kernel has tid running or runnable
+	threadOnCPU(tid int) bool
+	// threadRegs returns the current pc, sp and frame pointer of tid
+	threadRegs(tid int) (pc, sp, fp uint64, err error)
+}
+
+// SampleThreads returns the goroutines currently running on a thread, found
+// through runtime.allm. Threads that are on CPU are unwound from their
+// registers when the reader can read them, otherwise from curg.sched, which is
+// where the goroutine was last scheduled and only approximates what it runs now.
+func (r *commonMemReader) SampleThreads() ([]ThreadSample, error) {
+	r.cache.refresh()
+	return r.sampleThreads()
+}
+
+// sampleThreads is SampleThreads within the current page cache generation
+func (r *commonMemReader) sampleThreads() ([]ThreadSample, error) {
+	_ = r.refreshModules()
+
+	loader := r.GetBinaryLoader()
+	dwarfLoader, err := loader.GetDWARFLoader()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get DWARF loader: %w", err)
+	}
+	allmAddr, err := loader.FindVariableAddress("runtime.allm")
+	if err != nil {
+		return nil, fmt.Errorf("find allm symbol: %w", err)
+	}
+	offsets := make(map[string]uint64)
+	for _, field := range []string{"g0", "procid", "curg", "alllink"} {
+		off, err := dwarfLoader.GetStructOffset("runtime.m", field)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get m.%s offset: %w", field, err)
+		}
+		offsets[field] = off
+	}
+	gSize, err := dwarfLoader.GetStructSize("runtime.g")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get runtime.g size: %w", err)
+	}
+
+	inspector, _ := r.reader.(threadInspector)
+	// registers are only meaningful when the target runs the arch we were built for
+	exactRegs := inspector != nil && loader.Arch() == runtime.GOARCH
+
+	m, err := r.readPtr(r.GetStaticBase() + allmAddr)
+	if err != nil {
+		return nil, fmt.Errorf("read allm: %w", err)
+	}
+	var samples []ThreadSample
+	for i := 0; m != 0 && i < maxThreads; i++ {
+		next, err := r.readPtr(m + offsets["alllink"])
+		if err != nil {
+			return nil, fmt.Errorf("read m at 0x%x: %w", m, err)
+		}
+		curg, err := r.readPtr(m + offsets["curg"])
+		if err != nil {
+			return nil, fmt.Errorf("read m at 0x%x: %w", m, err)
+		}
+		if curg == 0 {
+			// idle, spinning or in the scheduler
+			m = next
+			continue
+		}
+		procid, err := r.readUint64(m + offsets["procid"])
+		if err != nil {
+			return nil, fmt.Errorf("read m at 0x%x: %w", m, err)
+		}
+		g, err := r.readG(curg, gSize)
+		if err != nil {
+			return nil, err
+		}
+		s := ThreadSample{TID: int(procid), Goid: g.Goid, G: g}
+		if inspector != nil {
+			s.OnCPU = inspector.threadOnCPU(s.TID)
+		}
+		if s.OnCPU && exactRegs {
+			if pc, sp, fp, err := inspector.threadRegs(s.TID); err == nil {
+				stacks := []Stack{g.Stack}
+				// the thread may be on the system stack, e.g. in systemstack or cgo
+				if g0Addr, err := r.readPtr(m + offsets["g0"]); err == nil && g0Addr != 0 {
+					if g0, err := r.readG(g0Addr, gSize); err == nil {
+						stacks = append(stacks, g0.Stack)
+					}
+				}
+				s.Frames = r.unwindFrom(pc, sp, fp, stacks...)
+				s.Exact = len(s.Frames) > 0
+			}
+		}
+		// threads known to be off CPU are blocked in a syscall or parked,
+		// unwinding them costs more than the rest of the sample
+		if !s.Exact && (s.OnCPU || inspector == nil) {
+			s.Frames, _ = r.getGoroutineStackTrace(g)
+		}
+		samples = append(samples, s)
+		m = next
+	}
+	return samples, nil
+}
+
+// readG reads and parses a single runtime.g
+func (r *commonMemReader) readG(addr, gSize uint64) (G, error) {
+	data := make([]byte, gSize)
+	if _, err := r.ReadAt(data, int64(addr)); err != nil {
+		return G{}, fmt.Errorf("read g at 0x%x: %w", addr, err)
+	}
+	g, err := r.parseGoroutineFromBatch(data, addr, r.waitReasonMap())
+	if err != nil {
+		return G{}, fmt.Errorf("failed to parse goroutine at 0x%x: %w", addr, err)
+	}
+	return g, nil
+}
@@ -0,0 +1,122 @@
+//go:build linux
+
+package proc
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"runtime"
+
+	"golang.org/x/sys/unix"
+)
+
+// threadOnCPU reports whether the kernel has tid in the R state
+func (r *linuxMemReader) threadOnCPU(tid int) bool {
+	data, err := os.ReadFile(fmt.Sprintf("/proc/%d/task/%d/stat", r.pid, tid))
+	if err != nil {
+		return false
+	}
+	// the command may contain spaces and parentheses, the state follows the last ')'
+	i := bytes.LastIndexByte(data, ')')
+	if i < 0 || i+2 >= len(data) {
+		return false
+	}
+	return data[i+2] == 'R'
+}
+
+func (r *linuxMemReader) threadRegs(tid int) (pc, sp, fp uint64, err error) {
+	if !regsSupported {
+		return 0, 0, 0, errRegsUnsupported
+	}
+	r.tracerOnce.Do(func() { r.tracer = newRegsTracer() })
+	return r.tracer.regs(tid)
+}
+
+// regsTracer reads registers with ptrace. All requests for a tracee must come
+// from the thread that attached, so they're funneled through one locked goroutine.
+type regsTracer struct {
+	reqs chan regsRequest
+}
+
+type regsRequest struct {
+	tid   int
+	reply chan regsReply
+}
+
+type regsReply struct {
+	pc, sp, fp uint64
+	err        error
+}
+
+func newRegsTracer() *regsTracer {
+	t := &regsTracer{reqs: make(chan regsRequest)}
+	go func() {
+		runtime.LockOSThread()
+		defer runtime.UnlockOSThread()
+		for req := range t.reqs {
+			var rep regsReply
+			rep.pc, rep.sp, rep.fp, rep.err = stopAndReadRegs(req.tid)
+			req.reply <- rep
+		}
+	}()
+	return t
+}
+
+func (t *regsTracer) regs(tid int) (pc, sp, fp uint64, err error) {
+	reply := make(chan regsReply, 1)
+	t.reqs <- regsRequest{tid: tid, reply: reply}
+	rep := <-reply
+	return rep.pc, rep.sp, rep.fp, rep.err
+}
+
+func (t *regsTracer) close() {
+	close(t.reqs)
+}
+
+// stopAndReadRegs briefly stops a single thread. PTRACE_SEIZE doesn't stop the
+// thread itself and, unlike PTRACE_ATTACH, doesn't send it a SIGSTOP.
+func stopAndReadRegs(tid int) (pc, sp, fp uint64, err error) {
+	if err := unix.PtraceSeize(tid); err != nil {
+		return 0, 0, 0, fmt.Errorf("PTRACE_SEIZE %d: %w", tid, err)
+	}
+	sig := 0
+	defer func() {
+		if derr := ptraceDetach(tid, sig); derr != nil && err == nil && !errors.Is(derr, unix.ESRCH) {
+			err = fmt.Errorf("PTRACE_DETACH %d: %w", tid, derr)
+		}
+	}()
+	if err := unix.PtraceInterrupt(tid); err != nil {
+		return 0, 0, 0, fmt.Errorf("PTRACE_INTERRUPT %d: %w", tid, err)
+	}
+	var ws unix.WaitStatus
+	if _, err := unix.Wait4(tid, &ws, unix.WALL, nil); err != nil {
+		return 0, 0, 0, fmt.Errorf("wait for %d: %w", tid, err)
+	}
+	if !ws.Stopped() {
+		return 0, 0, 0, fmt.Errorf("thread %d exited", tid)
+	}
+	// a signal that arrived before the interrupt is reported first, it must be
+	// delivered on detach or the target would lose it. Interrupts and group
+	// stops are reported as PTRACE_EVENT_STOP and have nothing to deliver.
+	if int(ws>>16) != unix.PTRACE_EVENT_STOP {
+		sig = int(ws.StopSignal())
+	}
+	var regs unix.PtraceRegs
+	if err := unix.PtraceGetRegs(tid, &regs); err != nil {
+		return 0, 0, 0, fmt.Errorf("PTRACE_GETREGS %d: %w", tid, err)
+	}
+	pc, sp, fp = regsPCSPFP(&regs)
+	return pc, sp, fp, nil
+}
+
+// ptraceDetach detaches, delivering sig if it isn't 0. unix.PtraceDetach
+// always passes 0.
+func ptraceDetach(tid, sig int) error {
+	_, _, errno := unix.Syscall6(unix.SYS_PTRACE, unix.PTRACE_DETACH, uintptr(tid), 0, uintptr(sig), 0, 0)
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
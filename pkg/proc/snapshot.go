@@ -0,0 +1,394 @@
+package proc
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"time"
+
+	bin "github.com/monsterxx03/gospy/pkg/binary"
+)
+
+const (
+	snapshotMagic   = "GOSPYSNP"
+	snapshotVersion = 1
+
+	// maxSnapshotStack skips goroutine stacks larger than this when capturing
+	maxSnapshotStack = 64 << 20
+
+	// limits applied when opening a snapshot, sizes come from the file and
+	// must not be trusted for allocations
+	maxSnapshotHeader  = 16 << 20
+	maxSnapshotRegions = 1 << 24
+	maxSnapshotBytes   = 64 << 30
+	// maxGzipRatio bounds how much a gzip stream can expand, deflate tops out
+	// a little above 1000:1
+	maxGzipRatio = 1032
+)
+
+// SnapshotHeader describes a snapshot file, it's stored as JSON after the magic
+type SnapshotHeader struct {
+	Version    int       `json:"version"`
+	PID        int       `json:"pid"`
+	CreatedAt  time.Time `json:"created_at"`
+	GoVersion  string    `json:"go_version"`
+	ExePath    string    `json:"exe_path"`
+	GNUBuildID string    `json:"gnu_build_id,omitempty"`
+	GoBuildID  string    `json:"go_build_id,omitempty"`
+	StaticBase uint64    `json:"static_base"`
+	Nanotime   int64     `json:"nanotime,omitempty"` // target's runtime.nanotime when captured, 0 if unknown
+	Regions    int       `json:"regions"`
+	Bytes      uint64    `json:"bytes"`      // total captured memory
+	HasBinary  bool      `json:"has_binary"` // executable embedded after the regions
+}
+
+// memRegion is a captured range of target memory
+type memRegion struct {
+	addr uint64
+	data []byte
+}
+
+// recordingReader records every range read from the wrapped reader
+type recordingReader struct {
+	reader
+	regions []memRegion
+}
+
+func (r *recordingReader) ReadAt(p []byte, off int64) (int, error) {
+	n, err := r.reader.ReadAt(p, off)
+	if n > 0 {
+		r.regions = append(r.regions, memRegion{addr: uint64(off), data: append([]byte(nil), p[:n]...)})
+	}
+	return n, err
+}
+
+// targetNanotime passes on the clock of the wrapped reader
+func (r *recordingReader) targetNanotime() int64 {
+	if cr, ok := r.reader.(clockReader); ok {
+		return cr.targetNanotime()
+	}
+	return 0
+}
+
+// CaptureSnapshot reads everything gospy needs from src (runtime info, Ps,
+// memstats, all goroutines and their stacks) and writes it to w as a
+// gzip-compressed snapshot. With embedBinary the executable is included so the
+// snapshot can be analysed on a machine without it.
+func CaptureSnapshot(src ProcessMemReader, w io.Writer, embedBinary bool) (*SnapshotHeader, error) {
+	inner, ok := src.(reader)
+	if !ok {
+		return nil, fmt.Errorf("reader %T doesn't support snapshots", src)
+	}
+	rec := &recordingReader{reader: inner}
+	cr := &commonMemReader{reader: rec, pid: src.Pid()}
+
+	// bypass the runtime info cache so the reads get recorded, only the reads
+	// run with the target frozen, compressing and writing happen after resume
+	var rt *Runtime
+	var nanotime int64
+	err := src.Frozen(func() error {
+		// wait durations and uptime are measured against the clock at capture
+		nanotime = cr.clock()
+		rt = cr.readStaticRuntimeInfo()
+		cr.readProcessSettings(rt)
+		if _, err := cr.Ps(); err != nil {
+			return fmt.Errorf("failed to read processors: %w", err)
+		}
+		if _, err := cr.MemStat(); err != nil {
+			return fmt.Errorf("failed to read memstats: %w", err)
+		}
+		gs, err := cr.Goroutines(true)
+		if err != nil {
+			return fmt.Errorf("failed to read goroutines: %w", err)
+		}
+		for _, g := range gs {
+			if g.Stack.Hi <= g.Stack.Lo || g.Stack.Hi-g.Stack.Lo > maxSnapshotStack {
+				continue
+			}
+			buf := make([]byte, g.Stack.Hi-g.Stack.Lo)
+			cr.ReadAt(buf, int64(g.Stack.Lo)) // unreadable stacks are just left out
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	regions := mergeRegions(rec.regions)
+	loader := inner.GetBinaryLoader()
+	exePath := loader.Path()
+	h := &SnapshotHeader{
+		Version:    snapshotVersion,
+		PID:        src.Pid(),
+		CreatedAt:  time.Now().UTC(),
+		GoVersion:  rt.GoVersion,
+		ExePath:    exePath,
+		StaticBase: inner.GetStaticBase(),
+		Nanotime:   nanotime,
+		Regions:    len(regions),
+		HasBinary:  embedBinary,
+	}
+	h.GNUBuildID, h.GoBuildID = binaryIdentity(loader)
+	for _, region := range regions {
+		h.Bytes += uint64(len(region.data))
+	}
+
+	zw := gzip.NewWriter(w)
+	bw := bufio.NewWriter(zw)
+	if err := writeSnapshot(bw, h, regions, exePath); err != nil {
+		return nil, err
+	}
+	if err := bw.Flush(); err != nil {
+		return nil, err
+	}
+	return h, zw.Close()
+}
+
+func writeSnapshot(w io.Writer, h *SnapshotHeader, regions []memRegion, exePath string) error {
+	header, err := json.Marshal(h)
+	if err != nil {
+		return err
+	}
+	if _, err := io.WriteString(w, snapshotMagic); err != nil {
+		return err
+	}
+	if err := writeBlob(w, header); err != nil {
+		return err
+	}
+	for _, region := range regions {
+		if err := binary.Write(w, binary.LittleEndian, region.addr); err != nil {
+			return err
+		}
+		if err := writeBlob(w, region.data); err != nil {
+			return err
+		}
+	}
+	if !h.HasBinary {
+		return nil
+	}
+
+	f, err := os.Open(exePath)
+	if err != nil {
+		return fmt.Errorf("failed to open binary for embedding: %w", err)
+	}
+	defer f.Close()
+	st, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if err := binary.Write(w, binary.LittleEndian, uint64(st.Size())); err != nil {
+		return err
+	}
+	_, err = io.Copy(w, f)
+	return err
+}
+
+func writeBlob(w io.Writer, data []byte) error {
+	if err := binary.Write(w, binary.LittleEndian, uint64(len(data))); err != nil {
+		return err
+	}
+	_, err := w.Write(data)
+	return err
+}
+
+// readBlob reads a length prefixed blob of at most limit bytes. The buffer
+// grows with the data actually read, so a truncated file fails early instead
+// of allocating whatever length it claims.
+func readBlob(r io.Reader, limit uint64) ([]byte, error) {
+	var n uint64
+	if err := binary.Read(r, binary.LittleEndian, &n); err != nil {
+		return nil, err
+	}
+	if n > limit {
+		return nil, fmt.Errorf("blob of %d bytes exceeds the limit of %d", n, limit)
+	}
+	var buf bytes.Buffer
+	if _, err := io.CopyN(&buf, r, int64(n)); err != nil {
+		if errors.Is(err, io.EOF) {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// mergeRegions sorts regions and coalesces overlapping or adjacent ones
+func mergeRegions(regions []memRegion) []memRegion {
+	sort.SliceStable(regions, func(i, j int) bool { return regions[i].addr < regions[j].addr })
+	var merged []memRegion
+	for _, region := range regions {
+		if len(merged) > 0 {
+			last := &merged[len(merged)-1]
+			lastEnd := last.addr + uint64(len(last.data))
+			if region.addr <= lastEnd {
+				end := region.addr + uint64(len(region.data))
+				if end > lastEnd {
+					last.data = append(last.data, make([]byte, end-lastEnd)...)
+				}
+				copy(last.data[region.addr-last.addr:], region.data)
+				continue
+			}
+		}
+		merged = append(merged, memRegion{addr: region.addr, data: append([]byte(nil), region.data...)})
+	}
+	return merged
+}
+
+type snapshotMemReader struct {
+	commonMemReader
+	header  SnapshotHeader
+	regions []memRegion // sorted, non overlapping
+	bin     bin.BinaryLoader
+	tmpBin  string // extracted embedded binary, removed on Close
+}
+
+// NewSnapshotMemReader opens a snapshot written by CaptureSnapshot. binPath
+// overrides the embedded executable and is required when none was embedded.
+func NewSnapshotMemReader(path, binPath string) (ProcessMemReader, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open snapshot: %w", err)
+	}
+	defer f.Close()
+	st, err := f.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("failed to open snapshot: %w", err)
+	}
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open snapshot: %w", err)
+	}
+	rd := bufio.NewReader(zr)
+
+	magic := make([]byte, len(snapshotMagic))
+	if _, err := io.ReadFull(rd, magic); err != nil || string(magic) != snapshotMagic {
+		return nil, errors.New("not a gospy snapshot")
+	}
+	r := &snapshotMemReader{}
+	header, err := readBlob(rd, maxSnapshotHeader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read snapshot header: %w", err)
+	}
+	if err := json.Unmarshal(header, &r.header); err != nil {
+		return nil, fmt.Errorf("failed to parse snapshot header: %w", err)
+	}
+	if r.header.Version != snapshotVersion {
+		return nil, fmt.Errorf("unsupported snapshot version %d", r.header.Version)
+	}
+
+	// every region takes at least its address and length once decompressed
+	expanded := uint64(st.Size()) * maxGzipRatio
+	if r.header.Regions < 0 || r.header.Regions > maxSnapshotRegions || uint64(r.header.Regions) > expanded/16 {
+		return nil, fmt.Errorf("corrupt snapshot: %d regions in a %d byte file", r.header.Regions, st.Size())
+	}
+	if r.header.Bytes > maxSnapshotBytes || r.header.Bytes > expanded {
+		return nil, fmt.Errorf("corrupt snapshot: %d bytes of memory in a %d byte file", r.header.Bytes, st.Size())
+	}
+
+	r.regions = make([]memRegion, 0, min(r.header.Regions, 1024))
+	remaining := r.header.Bytes
+	for i := 0; i < r.header.Regions; i++ {
+		var region memRegion
+		if err := binary.Read(rd, binary.LittleEndian, &region.addr); err != nil {
+			return nil, fmt.Errorf("failed to read region %d: %w", i, err)
+		}
+		// regions can't add up to more than the header says was captured
+		if region.data, err = readBlob(rd, remaining); err != nil {
+			return nil, fmt.Errorf("failed to read region %d: %w", i, err)
+		}
+		remaining -= uint64(len(region.data))
+		r.regions = append(r.regions, region)
+	}
+
+	if binPath == "" {
+		if !r.header.HasBinary {
+			return nil, fmt.Errorf("snapshot has no embedded binary, pass the executable (%s)", r.header.ExePath)
+		}
+		if binPath, err = extractBinary(rd); err != nil {
+			return nil, err
+		}
+		r.tmpBin = binPath
+	}
+
+	r.bin = bin.NewBinaryLoader()
+	if err := r.bin.Load(binPath); err != nil {
+		r.Close()
+		return nil, fmt.Errorf("failed to load binary: %w", err)
+	}
+	if gnu, goid := binaryIdentity(r.bin); (r.header.GNUBuildID != "" && gnu != "" && gnu != r.header.GNUBuildID) ||
+		(r.header.GoBuildID != "" && goid != "" && goid != r.header.GoBuildID) {
+		r.Close()
+		return nil, fmt.Errorf("%w: %s doesn't match snapshot build ID", ErrBinaryMismatch, binPath)
+	}
+	r.commonMemReader = commonMemReader{reader: r, pid: r.header.PID}
+	return r, nil
+}
+
+func extractBinary(rd io.Reader) (string, error) {
+	var size uint64
+	if err := binary.Read(rd, binary.LittleEndian, &size); err != nil {
+		return "", fmt.Errorf("failed to read embedded binary: %w", err)
+	}
+	tmp, err := os.CreateTemp("", "gospy-snapshot-bin-*")
+	if err != nil {
+		return "", err
+	}
+	defer tmp.Close()
+	if _, err := io.CopyN(tmp, rd, int64(size)); err != nil {
+		os.Remove(tmp.Name())
+		return "", fmt.Errorf("failed to extract embedded binary: %w", err)
+	}
+	return tmp.Name(), nil
+}
+
+// Header returns the snapshot metadata
+func (r *snapshotMemReader) Header() SnapshotHeader {
+	return r.header
+}
+
+func (r *snapshotMemReader) ReadAt(p []byte, off int64) (int, error) {
+	addr := uint64(off)
+	i := sort.Search(len(r.regions), func(i int) bool {
+		return r.regions[i].addr+uint64(len(r.regions[i].data)) > addr
+	})
+	if i == len(r.regions) || r.regions[i].addr > addr {
+		return 0, fmt.Errorf("address 0x%x not captured in snapshot", addr)
+	}
+	region := r.regions[i]
+	n := copy(p, region.data[addr-region.addr:])
+	if n < len(p) {
+		return n, fmt.Errorf("address 0x%x not captured in snapshot", addr+uint64(n))
+	}
+	return n, nil
+}
+
+func (r *snapshotMemReader) Close() error {
+	if r.bin != nil {
+		r.closeModules()
+		r.bin.Close()
+	}
+	if r.tmpBin != "" {
+		return os.Remove(r.tmpBin)
+	}
+	return nil
+}
+
+func (r *snapshotMemReader) GetBinaryLoader() bin.BinaryLoader {
+	return r.bin
+}
+
+func (r *snapshotMemReader) GetStaticBase() uint64 {
+	return r.header.StaticBase
+}
+
+// targetNanotime is the target's clock when the snapshot was captured
+func (r *snapshotMemReader) targetNanotime() int64 {
+	return r.header.Nanotime
+}
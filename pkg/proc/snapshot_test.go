@@ -0,0 +1,89 @@
+package proc
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestMergeRegions(t *testing.T) {
+	regions := []memRegion{
+		{addr: 0x1010, data: []byte{5, 6}},
+		{addr: 0x1000, data: []byte{1, 2, 3, 4}},
+		{addr: 0x1004, data: []byte{9}},
+		{addr: 0x2000, data: []byte{7, 8}},
+		{addr: 0x1002, data: []byte{3, 4}},
+	}
+	merged := mergeRegions(regions)
+	if len(merged) != 3 {
+		t.Fatalf("mergeRegions() returned %d regions, want 3", len(merged))
+	}
+	if merged[0].addr != 0x1000 || !bytes.Equal(merged[0].data, []byte{1, 2, 3, 4, 9}) {
+		t.Errorf("merged[0] = 0x%x %v, want 0x1000 [1 2 3 4 9]", merged[0].addr, merged[0].data)
+	}
+
+	r := &snapshotMemReader{regions: merged}
+	buf := make([]byte, 3)
+	if _, err := r.ReadAt(buf, 0x1002); err != nil || !bytes.Equal(buf, []byte{3, 4, 9}) {
+		t.Errorf("ReadAt(0x1002) = %v, %v, want [3 4 9]", buf, err)
+	}
+	if _, err := r.ReadAt(buf, 0x1003); err == nil {
+		t.Errorf("ReadAt past captured region should fail")
+	}
+	if _, err := r.ReadAt(buf, 0x3000); err == nil {
+		t.Errorf("ReadAt of uncaptured address should fail")
+	}
+}
+
+func TestSnapshotSizeLimits(t *testing.T) {
+	write := func(t *testing.T, h SnapshotHeader, regions func(w *bytes.Buffer)) string {
+		var raw bytes.Buffer
+		raw.WriteString(snapshotMagic)
+		header, _ := json.Marshal(h)
+		writeBlob(&raw, header)
+		regions(&raw)
+		path := filepath.Join(t.TempDir(), "snap.gz")
+		f, err := os.Create(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		zw := gzip.NewWriter(f)
+		zw.Write(raw.Bytes())
+		zw.Close()
+		f.Close()
+		return path
+	}
+	none := func(w *bytes.Buffer) {}
+
+	for _, tc := range []struct {
+		name    string
+		header  SnapshotHeader
+		regions func(w *bytes.Buffer)
+		want    string
+	}{
+		{"negative regions", SnapshotHeader{Version: snapshotVersion, Regions: -1}, none, "regions"},
+		{"regions beyond file size", SnapshotHeader{Version: snapshotVersion, Regions: 1 << 30}, none, "regions"},
+		{"bytes beyond file size", SnapshotHeader{Version: snapshotVersion, Regions: 1, Bytes: 1 << 40}, none, "bytes of memory"},
+		{"region larger than header bytes", SnapshotHeader{Version: snapshotVersion, Regions: 1, Bytes: 4}, func(w *bytes.Buffer) {
+			binary.Write(w, binary.LittleEndian, uint64(0x1000))
+			binary.Write(w, binary.LittleEndian, uint64(1<<40))
+		}, "exceeds the limit"},
+		{"truncated region", SnapshotHeader{Version: snapshotVersion, Regions: 1, Bytes: 1 << 16}, func(w *bytes.Buffer) {
+			binary.Write(w, binary.LittleEndian, uint64(0x1000))
+			binary.Write(w, binary.LittleEndian, uint64(1<<16))
+			w.Write([]byte{1, 2, 3})
+		}, "unexpected EOF"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := NewSnapshotMemReader(write(t, tc.header, tc.regions), "/nonexistent")
+			if err == nil || !strings.Contains(err.Error(), tc.want) {
+				t.Errorf("NewSnapshotMemReader() error = %v, want it to mention %q", err, tc.want)
+			}
+		})
+	}
+}
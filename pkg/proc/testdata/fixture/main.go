@@ -0,0 +1,23 @@
+// Command fixture is cross-compiled by the architecture tests, its package
+// variables are statically initialized so they can be read from the ELF file.
+// With -wait it keeps running until stdin is closed, as a live target.
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+)
+
+var (
+	greeting = "hello from fixture"
+	words    = []string{"alpha", "beta", "gamma"}
+	magic    = uint64(0x0102030405060708)
+)
+
+func main() {
+	fmt.Println(greeting, words, magic)
+	if len(os.Args) > 1 && os.Args[1] == "-wait" {
+		io.Copy(io.Discard, os.Stdin)
+	}
+}
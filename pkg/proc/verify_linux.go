@@ -0,0 +1,89 @@
+//go:build linux
+
+package proc
+
+import (
+	"bytes"
+	"debug/elf"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	bin "github.com/monsterxx03/gospy/pkg/binary"
+)
+
+// binaryIdentity returns the hex GNU build ID and Go build ID of the loaded binary
+func binaryIdentity(loader bin.BinaryLoader) (string, string) {
+	file, ok := loader.GetFile().(*elf.File)
+	if !ok {
+		return "", ""
+	}
+	return hex.EncodeToString(bin.GNUBuildID(file)), bin.GoBuildID(file)
+}
+
+// textSampleSize is how many bytes from each end of .text are compared against memory
+const textSampleSize = 64 << 10
+
+// verifyBinary checks that the loaded binary is the one running as pid by comparing
+// build IDs against /proc/<pid>/exe and sampling .text against the mapped memory.
+func (r *linuxMemReader) verifyBinary() error {
+	file := r.bin.GetFile().(*elf.File)
+	var problems []string
+
+	exe, err := elf.Open(fmt.Sprintf("/proc/%d/exe", r.pid))
+	if err == nil {
+		defer exe.Close()
+		problems = buildIDProblems(file, bin.GNUBuildID(exe), bin.GoBuildID(exe))
+	}
+
+	if err := r.compareText(file); err != nil {
+		problems = append(problems, err.Error())
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("%w: %s", ErrBinaryMismatch, strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// buildIDProblems compares the build IDs of file with the target's, IDs
+// missing on either side can't be compared
+func buildIDProblems(file *elf.File, wantGNU []byte, wantGo string) []string {
+	var problems []string
+	if got := bin.GNUBuildID(file); len(wantGNU) > 0 && len(got) > 0 && !bytes.Equal(wantGNU, got) {
+		problems = append(problems, fmt.Sprintf("GNU build ID %x != process %x", got, wantGNU))
+	}
+	if got := bin.GoBuildID(file); wantGo != "" && got != "" && wantGo != got {
+		problems = append(problems, fmt.Sprintf("Go build ID %q != process %q", got, wantGo))
+	}
+	return problems
+}
+
+// compareText compares the head and tail of .text in the file with process memory
+func (r *linuxMemReader) compareText(file *elf.File) error {
+	text := file.Section(".text")
+	if text == nil || text.Type == elf.SHT_NOBITS {
+		return nil
+	}
+
+	size := text.Size
+	sample := uint64(textSampleSize)
+	if sample > size {
+		sample = size
+	}
+	for _, off := range []uint64{0, size - sample} {
+		want := make([]byte, sample)
+		if _, err := text.ReadAt(want, int64(off)); err != nil {
+			return fmt.Errorf("failed to read .text from binary: %w", err)
+		}
+		got := make([]byte, sample)
+		addr := r.staticBase + text.Addr + off
+		if _, err := r.ReadAt(got, int64(addr)); err != nil {
+			return fmt.Errorf(".text not mapped at 0x%x: %v", addr, err)
+		}
+		if !bytes.Equal(want, got) {
+			return fmt.Errorf(".text contents differ from process memory at 0x%x", addr)
+		}
+	}
+	return nil
+}
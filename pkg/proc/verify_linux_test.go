@@ -0,0 +1,57 @@
+//go:build linux
+
+package proc
+
+import (
+	"errors"
+	"os/exec"
+	"runtime"
+	"testing"
+)
+
+func TestVerifyBinary(t *testing.T) {
+	if testing.Short() {
+		t.Skip("builds fixtures")
+	}
+	pid := startFixture(t)
+	same := buildFixture(t, runtime.GOARCH)
+	// different code and build IDs, same Go version
+	other := buildFixture(t, runtime.GOARCH, "-gcflags=all=-N -l")
+
+	type testCase struct {
+		name    string
+		bin     string
+		opts    []Option
+		wantErr error
+	}
+	tests := []testCase{
+		{name: "same build", bin: same},
+		{name: "other build", bin: other, wantErr: ErrBinaryMismatch},
+		{name: "other build allowed", bin: other, opts: []Option{WithAllowBinaryMismatch()}},
+	}
+	if _, err := exec.LookPath("objcopy"); err == nil {
+		// without build IDs only the .text comparison can tell
+		noIDs := buildFixture(t, runtime.GOARCH, "-gcflags=all=-N -l")
+		cmd := exec.Command("objcopy", "--remove-section=.note.gnu.build-id", "--remove-section=.note.go.buildid", noIDs)
+		if output, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("objcopy: %v\n%s", err, output)
+		}
+		tests = append(tests, testCase{name: "other build without build IDs", bin: noIDs, wantErr: ErrBinaryMismatch})
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r, err := NewProcessMemReader(pid, tt.bin, tt.opts...)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("got %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			r.Close()
+		})
+	}
+}
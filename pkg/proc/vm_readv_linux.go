@@ -0,0 +1,76 @@
+//go:build linux
+
+package proc
+
+import (
+	"fmt"
+	"io"
+
+	"golang.org/x/sys/unix"
+)
+
+// maxIovecs is the per call iovec limit of process_vm_readv (IOV_MAX)
+const maxIovecs = 1024
+
+// probeVMReadv reports whether process_vm_readv works for the target, it's
+// commonly blocked by seccomp in containers while /proc/<pid>/mem still works
+func (r *linuxMemReader) probeVMReadv(addr uint64) bool {
+	buf := make([]byte, 8)
+	_, err := r.vmReadvChunk([]uint64{addr}, [][]byte{buf})
+	return err == nil
+}
+
+// readBatch reads bufs[i] from addrs[i]. With process_vm_readv up to maxIovecs
+// ranges are read per syscall, otherwise it falls back to one pread per range.
+// All bufs must be non-empty.
+func (r *linuxMemReader) readBatch(addrs []uint64, bufs [][]byte) error {
+	if !r.vmReadv {
+		for i, buf := range bufs {
+			if _, err := r.fd.ReadAt(buf, int64(addrs[i])); err != nil {
+				return fmt.Errorf("read at 0x%x: %w", addrs[i], err)
+			}
+		}
+		return nil
+	}
+
+	for start := 0; start < len(addrs); {
+		end := min(start+maxIovecs, len(addrs))
+		done, err := r.vmReadvChunk(addrs[start:end], bufs[start:end])
+		start += done
+		if err != nil {
+			// the kernel stops at the first unreadable range, pread it for a precise error
+			if _, err := r.fd.ReadAt(bufs[start], int64(addrs[start])); err != nil {
+				return fmt.Errorf("read at 0x%x: %w", addrs[start], err)
+			}
+			start++
+		}
+	}
+	return nil
+}
+
+// vmReadvChunk issues a single process_vm_readv and returns how many ranges were read completely
+func (r *linuxMemReader) vmReadvChunk(addrs []uint64, bufs [][]byte) (int, error) {
+	local := make([]unix.Iovec, len(bufs))
+	remote := make([]unix.RemoteIovec, len(bufs))
+	total := 0
+	for i, buf := range bufs {
+		local[i].Base = &buf[0]
+		local[i].SetLen(len(buf))
+		remote[i] = unix.RemoteIovec{Base: uintptr(addrs[i]), Len: len(buf)}
+		total += len(buf)
+	}
+
+	n, err := unix.ProcessVMReadv(r.pid, local, remote, 0)
+	if n == total {
+		return len(bufs), nil
+	}
+	if err == nil {
+		err = io.ErrUnexpectedEOF
+	}
+	done := 0
+	for done < len(bufs) && n >= len(bufs[done]) {
+		n -= len(bufs[done])
+		done++
+	}
+	return done, err
+}
@@ -0,0 +1,104 @@
+//go:build linux
+
+package proc
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"runtime"
+	"strings"
+	"testing"
+	"unsafe"
+)
+
+// gLikeSize approximates sizeof(runtime.g)
+const gLikeSize = 440
+
+// selfReaders returns a pread and a process_vm_readv reader for the test process
+// itself, plus n heap objects to read and their addresses
+func selfReaders(tb testing.TB, n int) (map[string]*linuxMemReader, [][]byte, []uint64) {
+	tb.Helper()
+	fd, err := os.Open("/proc/self/mem")
+	if err != nil {
+		tb.Skipf("/proc/self/mem unavailable: %v", err)
+	}
+	tb.Cleanup(func() { fd.Close() })
+
+	objs := make([][]byte, n)
+	addrs := make([]uint64, n)
+	for i := range objs {
+		objs[i] = bytes.Repeat([]byte{byte(i)}, gLikeSize)
+		addrs[i] = uint64(uintptr(unsafe.Pointer(&objs[i][0])))
+	}
+
+	vm := &linuxMemReader{pid: os.Getpid(), fd: fd, vmReadv: true}
+	if !vm.probeVMReadv(addrs[0]) {
+		tb.Skip("process_vm_readv not permitted")
+	}
+	return map[string]*linuxMemReader{
+		"pread":            {pid: os.Getpid(), fd: fd},
+		"process_vm_readv": vm,
+	}, objs, addrs
+}
+
+func TestReadBatch(t *testing.T) {
+	readers, objs, addrs := selfReaders(t, 3000) // spans several maxIovecs chunks
+	for name, r := range readers {
+		t.Run(name, func(t *testing.T) {
+			bufs := make([][]byte, len(addrs))
+			for i := range bufs {
+				bufs[i] = make([]byte, gLikeSize)
+			}
+			if err := r.readBatch(addrs, bufs); err != nil {
+				t.Fatal(err)
+			}
+			for i := range bufs {
+				if !bytes.Equal(bufs[i], objs[i]) {
+					t.Fatalf("object %d differs", i)
+				}
+			}
+		})
+	}
+	runtime.KeepAlive(objs)
+}
+
+func TestReadBatchUnmapped(t *testing.T) {
+	readers, objs, addrs := selfReaders(t, 10)
+	addrs[5] = 0x10 // never mapped
+	for name, r := range readers {
+		t.Run(name, func(t *testing.T) {
+			bufs := make([][]byte, len(addrs))
+			for i := range bufs {
+				bufs[i] = make([]byte, gLikeSize)
+			}
+			err := r.readBatch(addrs, bufs)
+			if want := fmt.Sprintf("0x%x", addrs[5]); err == nil || !strings.Contains(err.Error(), want) {
+				t.Fatalf("expected error mentioning %s, got %v", want, err)
+			}
+		})
+	}
+	runtime.KeepAlive(objs)
+}
+
+// BenchmarkReadBatch reads 100k G sized objects, roughly what a refresh of a
+// service with 100k goroutines costs
+func BenchmarkReadBatch(b *testing.B) {
+	readers, objs, addrs := selfReaders(b, 100000)
+	bufs := make([][]byte, len(addrs))
+	for i := range bufs {
+		bufs[i] = make([]byte, gLikeSize)
+	}
+	for _, name := range []string{"pread", "process_vm_readv"} {
+		r := readers[name]
+		b.Run(name, func(b *testing.B) {
+			b.SetBytes(int64(len(addrs) * gLikeSize))
+			for i := 0; i < b.N; i++ {
+				if err := r.readBatch(addrs, bufs); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+	runtime.KeepAlive(objs)
+}
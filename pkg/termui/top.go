@@ -303,9 +303,16 @@ func (t *TopUI) renderGoroutines(goroutines []proc.G) {
 }
 
 func (t *TopUI) renderTitle(rt *proc.Runtime, goroutineCount int) {
-	uptime := fmt.Sprintf(" [white]| [cyan]Uptime: %s", proc.FormatDuration(rt.Uptime()))
-	title := fmt.Sprintf("[yellow]PID: %d [white]| [green]Go: %s [white]| [blue]Goroutines: %d [white]| [purple]Refresh: %ds [white]| [orange]Update: %v%s",
-		t.pid, rt.GoVersion, goroutineCount, t.interval, t.lastDuration.Round(time.Microsecond), uptime)
+	uptime := ""
+	if d := rt.Uptime(); d > 0 {
+		uptime = fmt.Sprintf(" [white]| [cyan]Uptime: %s", proc.FormatDuration(d))
+	}
+	cache := ""
+	if stats := t.memReader.CacheStats(); stats.Reads > 0 {
+		cache = fmt.Sprintf(" [white]| [gray]Cache: %.0f%% hit", stats.HitRate()*100)
+	}
+	title := fmt.Sprintf("[yellow]PID: %d [white]| [green]Go: %s [white]| [blue]Goroutines: %d [white]| [purple]Refresh: %ds [white]| [orange]Update: %v%s%s",
+		t.pid, rt.GoVersion, goroutineCount, t.interval, t.lastDuration.Round(time.Microsecond), cache, uptime)
 	t.titleView.SetText(title)
 }
 
@@ -368,8 +375,23 @@ func (t *TopUI) renderMemStats(memStat *proc.MemStat, goroutines []proc.G, ps []
 }
 
 func (t *TopUI) update() {
-	// Fetch data first
-	rt, memStat, goroutines, err := t.fetchData()
+	// Fetch data first, processors in the same (optionally frozen) pass
+	var (
+		rt         *proc.Runtime
+		memStat    *proc.MemStat
+		goroutines []proc.G
+		ps         []proc.P
+		psErr      error
+	)
+	err := t.memReader.Frozen(func() error {
+		var err error
+		rt, memStat, goroutines, err = t.fetchData()
+		if err != nil {
+			return err
+		}
+		ps, psErr = t.memReader.Ps()
+		return nil
+	})
 	if err != nil {
 		t.app.Stop()
 		fmt.Fprintf(os.Stderr, "failed to get goroutines: %v\n", err)
@@ -377,9 +399,8 @@ func (t *TopUI) update() {
 	}
 
 	// Get processor info
-	ps, err := t.memReader.Ps()
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "failed to get processors: %v\n", err)
+	if psErr != nil {
+		fmt.Fprintf(os.Stderr, "failed to get processors: %v\n", psErr)
 		ps = nil
 	}
 